@@ -1,16 +1,36 @@
 package config
 
+import (
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+)
+
 type Config struct {
-	Name          string
-	AttachStdin   bool
-	AttachStdout  bool
-	AttachStderr  bool
-	Cmd           []string
-	Image         string
+	Name         string
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	Cmd          []string
+	Entrypoint   []string
+	Image        string
+	// One of Always, IfNotPresent or Never, empty means Always.
+	PullPolicy string
+	// RegistryAuth is the base64 encoded login sent along with the pull.
+	RegistryAuth  string
 	Memory        int64
 	Disk          int64
 	Env           []string
+	WorkingDir    string
+	User          string
 	RestartPolicy string
 	Cpus          float32
-	PortBindings  string
+	// Port bindings in docker run -p form.
+	PortBindings []string
+	Mounts       []mount.Mount
+	// Network is empty for Docker's default bridge.
+	Network        string
+	NetworkAliases []string
+	Labels         map[string]string
+	// Healthcheck is nil unless Docker runs the task's health check.
+	Healthcheck *container.HealthConfig
 }
@@ -9,10 +9,53 @@ import (
 type Application struct {
 	RunType string
 	Port    string
+	Role    string
 }
 
 var ApplicationSetting = &Application{}
 
+type Manager struct {
+	Workers []string
+}
+
+var ManagerSetting = &Manager{}
+
+type Worker struct {
+	Concurrency int
+	// ShutdownMode is what happens to the task containers when joyboy
+	// exits: stop, leave or detach.
+	ShutdownMode string
+}
+
+var WorkerSetting = &Worker{}
+
+type Volumes struct {
+	AllowedHostPaths []string
+	ExternalVolumes  []string
+}
+
+var VolumeSetting = &Volumes{}
+
+type Ports struct {
+	RangeStart int
+	RangeEnd   int
+}
+
+var PortSetting = &Ports{}
+
+type Strategy struct {
+	Placement string
+}
+
+var StrategySetting = &Strategy{}
+
+type Credentials struct {
+	// KeyFile holds the key registry passwords are encrypted with.
+	KeyFile string
+}
+
+var CredentialSetting = &Credentials{}
+
 type Database struct {
 	DbType     string
 	DbPort     int
@@ -44,6 +87,12 @@ func SetUp(path string) {
 
 	mapTo("application", ApplicationSetting)
 	mapTo("db", DatabaseSetting)
+	mapTo("manager", ManagerSetting)
+	mapTo("worker", WorkerSetting)
+	mapTo("volumes", VolumeSetting)
+	mapTo("ports", PortSetting)
+	mapTo("strategy", StrategySetting)
+	mapTo("credentials", CredentialSetting)
 }
 
 func mapTo(section string, v interface{}) {
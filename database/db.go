@@ -81,7 +81,9 @@ func handleDatabaseInit(dbType string, dbName string, dbPort int, dbUsername str
 		}
 		db = postgresDb
 	default:
-		sqlLiteGormDb, err := gorm.Open(sqlite.Open("gorm.db"), &gorm.Config{})
+		// Tasks are started from several goroutines at once, so writers wait
+		// for each other instead of failing with a locked database.
+		sqlLiteGormDb, err := gorm.Open(sqlite.Open("gorm.db?_busy_timeout=5000"), &gorm.Config{})
 		if err != nil {
 			log.Fatalln("Failed to open DB connection. Exiting ...")
 		}
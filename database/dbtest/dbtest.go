@@ -0,0 +1,34 @@
+// Package dbtest opens throwaway databases for tests.
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open opens an in-memory sqlite database no other test shares, migrates
+// the given models into it and closes it once the test is done, which drops
+// its rows.
+func Open(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+
+	sqlDb, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	t.Cleanup(func() { sqlDb.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("failed to migrate test db: %v", err)
+	}
+	return db
+}
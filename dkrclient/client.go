@@ -1,58 +1,50 @@
 package dkrclient
 
 import (
-	"encoding/json"
 	"log"
 
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 )
 
-var dockerClient *client.Client
+// ManagedLabel is set to "true" on the Docker objects joyboy created, and
+// only those are listed or removed through its API.
+const ManagedLabel = "joyboy.managed"
 
+// TaskIDLabel and TaskNameLabel tell which task a container was created for.
+const (
+	TaskIDLabel   = "joyboy.task.id"
+	TaskNameLabel = "joyboy.task.name"
+)
+
+// ManagedFilter lists only the Docker objects carrying ManagedLabel.
+func ManagedFilter() filters.Args {
+	return filters.NewArgs(filters.Arg("label", ManagedLabel+"=true"))
+}
+
+var dockerRuntime Runtime
+
+// InitPlainDockerClient sets up the one Docker client the process shares,
+// configured from the DOCKER_* environment variables.
 func InitPlainDockerClient() {
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		log.Fatalf("Error creating Docker client: %s", err)
 	}
 
-	dockerClient = cli
-}
-
-func GetPlainDockerClient() *client.Client {
-	return dockerClient
+	dockerRuntime = NewDockerRuntime(cli)
 }
 
-func ConstructNatPortSet(portsMap map[string]interface{}) (nat.PortSet, error) {
-	exposedPorts := make(nat.PortSet)
-	for port := range portsMap {
-		p, err := nat.NewPort("tcp", port)
-		if err != nil {
-			return nil, err
-		}
-		exposedPorts[p] = struct{}{}
-	}
-	return exposedPorts, nil
+// GetRuntime returns the shared runtime, nil until InitPlainDockerClient
+// has been called.
+func GetRuntime() Runtime {
+	return dockerRuntime
 }
 
-func ConstructNatPortMap(jsonBindings string) (nat.PortMap, error) {
-	var bindings map[string]string
-	err := json.Unmarshal([]byte(jsonBindings), &bindings)
-	if err != nil {
-		return nil, err
-	}
-
-	portMap := make(nat.PortMap)
-	for containerPort, hostPort := range bindings {
-		internalPort, err := nat.NewPort("tcp", containerPort)
-		if err != nil {
-			return nil, err
-		}
-		portMap[internalPort] = []nat.PortBinding{
-			{
-				HostPort: hostPort,
-			},
-		}
-	}
-	return portMap, nil
+// ConstructNatPorts turns port bindings in docker run -p form
+// (ip:hostPort:containerPort/protocol) into the exposed ports and port map
+// of a container.
+func ConstructNatPorts(specs []string) (nat.PortSet, nat.PortMap, error) {
+	return nat.ParsePortSpecs(specs)
 }
@@ -0,0 +1,613 @@
+package dkrclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	"github.com/shashank-mugiwara/joyboy/utils"
+)
+
+// FakeContainer is a container kept by FakeRuntime.
+type FakeContainer struct {
+	ID         string
+	Name       string
+	Config     container.Config
+	HostConfig container.HostConfig
+	// Endpoints are the networks the container was created on.
+	Endpoints map[string]*network.EndpointSettings
+	// Ports are the host ports bound when the container started.
+	Ports   nat.PortMap
+	Running bool
+	// ExitCode is what the container exited with once it is not running.
+	ExitCode int
+	// Restarting is set while Docker restarts the container, which Docker
+	// reports as running as well.
+	Restarting bool
+	// Health is what Docker reports of the container's health check.
+	Health  *types.Health
+	Created time.Time
+	// Stdout and Stderr are what Logs returns for the container.
+	Stdout string
+	Stderr string
+	Stats  types.StatsJSON
+}
+
+// FakeRuntime is an in-memory Runtime for tests. It keeps containers in a
+// map and never runs anything.
+type FakeRuntime struct {
+	mu         sync.Mutex
+	nextId     int
+	nextPort   int
+	pulled     map[string]bool
+	pulls      map[string][]image.PullOptions
+	containers map[string]*FakeContainer
+	volumes    map[string]*volume.Volume
+	networks   map[string]*types.NetworkResource
+	failures   map[string]error
+}
+
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		pulled:     make(map[string]bool),
+		pulls:      make(map[string][]image.PullOptions),
+		containers: make(map[string]*FakeContainer),
+		volumes:    make(map[string]*volume.Volume),
+		networks:   make(map[string]*types.NetworkResource),
+		failures:   make(map[string]error),
+	}
+}
+
+// FailOn makes every later call of the named method, such as "Pull" or
+// "Start", return err. A nil err makes the method succeed again.
+func (f *FakeRuntime) FailOn(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil {
+		delete(f.failures, method)
+		return
+	}
+	f.failures[method] = err
+}
+
+// Container returns a copy of the container with the given id or name.
+func (f *FakeRuntime) Container(idOrName string) (FakeContainer, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.find(idOrName)
+	if err != nil {
+		return FakeContainer{}, false
+	}
+	return *c, true
+}
+
+// Containers returns copies of all containers, running or not.
+func (f *FakeRuntime) Containers() []FakeContainer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var containers []FakeContainer
+	for _, c := range f.containers {
+		containers = append(containers, *c)
+	}
+	return containers
+}
+
+// SetContainer adds or replaces a container, for tests that need one the
+// code under test did not create.
+func (f *FakeRuntime) SetContainer(c FakeContainer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.containers[c.ID] = &c
+}
+
+// AddImage makes the image present without pulling it.
+func (f *FakeRuntime) AddImage(ref string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pulled[ref] = true
+}
+
+// Pulls returns the options of every pull of the image so far.
+func (f *FakeRuntime) Pulls(ref string) []image.PullOptions {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]image.PullOptions(nil), f.pulls[ref]...)
+}
+
+// fakePullProgress is what Pull returns, the messages of an image made of
+// two layers being downloaded.
+const fakePullProgress = `{"status":"Pulling from library/fake","id":"latest"}
+{"status":"Pulling fs layer","id":"a1"}
+{"status":"Pulling fs layer","id":"b2"}
+{"status":"Downloading","progressDetail":{"current":300,"total":1000},"id":"a1"}
+{"status":"Downloading","progressDetail":{"current":100,"total":1000},"id":"b2"}
+{"status":"Download complete","id":"a1"}
+{"status":"Downloading","progressDetail":{"current":500,"total":1000},"id":"b2"}
+{"status":"Download complete","id":"b2"}
+{"status":"Pull complete","id":"a1"}
+{"status":"Pull complete","id":"b2"}
+`
+
+func (f *FakeRuntime) Pull(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pulls[ref] = append(f.pulls[ref], options)
+	if err := f.failures["Pull"]; err != nil {
+		return nil, err
+	}
+
+	f.pulled[ref] = true
+	return io.NopCloser(strings.NewReader(fakePullProgress + `{"status":"Downloaded newer image for ` + ref + `"}` + "\n")), nil
+}
+
+func (f *FakeRuntime) InspectImage(ctx context.Context, ref string) (types.ImageInspect, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["InspectImage"]; err != nil {
+		return types.ImageInspect{}, err
+	}
+
+	if !f.pulled[ref] {
+		return types.ImageInspect{}, errdefs.NotFound(fmt.Errorf("no such image: %s", ref))
+	}
+	return types.ImageInspect{ID: "sha256:" + ref, RepoTags: []string{ref}}, nil
+}
+
+func (f *FakeRuntime) Create(ctx context.Context, name string, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["Create"]; err != nil {
+		return "", err
+	}
+
+	if !f.pulled[config.Image] {
+		return "", errdefs.NotFound(fmt.Errorf("no such image: %s", config.Image))
+	}
+
+	for _, c := range f.containers {
+		if name != "" && c.Name == name {
+			return "", errdefs.Conflict(fmt.Errorf("container name %q is already in use", name))
+		}
+	}
+
+	if networkingConfig != nil {
+		for name := range networkingConfig.EndpointsConfig {
+			if _, err := f.findNetwork(name); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// Docker creates the named volumes a container mounts when they are
+	// missing.
+	if hostConfig != nil {
+		for _, m := range hostConfig.Mounts {
+			if m.Type == mount.TypeVolume && f.volumes[m.Source] == nil {
+				f.volumes[m.Source] = &volume.Volume{Name: m.Source, Driver: "local", Scope: "local"}
+			}
+		}
+	}
+
+	f.nextId++
+	c := &FakeContainer{
+		ID:      fmt.Sprintf("container%04d", f.nextId),
+		Name:    name,
+		Config:  *config,
+		Created: time.Now().UTC(),
+	}
+	if hostConfig != nil {
+		c.HostConfig = *hostConfig
+	}
+	if networkingConfig != nil {
+		c.Endpoints = networkingConfig.EndpointsConfig
+	}
+
+	f.containers[c.ID] = c
+	return c.ID, nil
+}
+
+func (f *FakeRuntime) Start(ctx context.Context, id string) error {
+	return f.update("Start", id, func(c *FakeContainer) error {
+		c.Running = true
+		c.Ports = f.bindPorts(c.HostConfig.PortBindings)
+		return nil
+	})
+}
+
+// bindPorts binds ports the way Docker reports them: on 0.0.0.0 when no
+// address was asked for, the first port of a host range, and a port from
+// 32768 up when no host port was asked for.
+func (f *FakeRuntime) bindPorts(bindings nat.PortMap) nat.PortMap {
+	bound := make(nat.PortMap)
+	for port, portBindings := range bindings {
+		for _, b := range portBindings {
+			hostIP := utils.DefaultIfBlank(b.HostIP, "0.0.0.0")
+			hostPort, _, _ := strings.Cut(b.HostPort, "-")
+			if hostPort == "" {
+				hostPort = strconv.Itoa(32768 + f.nextPort)
+				f.nextPort++
+			}
+			bound[port] = append(bound[port], nat.PortBinding{HostIP: hostIP, HostPort: hostPort})
+		}
+	}
+	return bound
+}
+
+func (f *FakeRuntime) Stop(ctx context.Context, id string, options container.StopOptions) error {
+	return f.update("Stop", id, func(c *FakeContainer) error {
+		c.Running = false
+		return nil
+	})
+}
+
+func (f *FakeRuntime) Remove(ctx context.Context, id string, options container.RemoveOptions) error {
+	return f.update("Remove", id, func(c *FakeContainer) error {
+		if (c.Running || c.Restarting) && !options.Force {
+			return errdefs.Conflict(fmt.Errorf("container %s is running", c.ID))
+		}
+		delete(f.containers, c.ID)
+		return nil
+	})
+}
+
+func (f *FakeRuntime) Inspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["Inspect"]; err != nil {
+		return types.ContainerJSON{}, err
+	}
+
+	c, err := f.find(id)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+
+	status := "exited"
+	if c.Restarting {
+		status = "restarting"
+	} else if c.Running {
+		status = "running"
+	}
+
+	config := c.Config
+	hostConfig := c.HostConfig
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         c.ID,
+			Name:       "/" + c.Name,
+			Created:    c.Created.Format(time.RFC3339Nano),
+			Image:      c.Config.Image,
+			State:      &types.ContainerState{Status: status, Running: c.Running || c.Restarting, Restarting: c.Restarting, ExitCode: c.ExitCode, Health: c.Health},
+			HostConfig: &hostConfig,
+		},
+		Config: &config,
+		NetworkSettings: &types.NetworkSettings{
+			NetworkSettingsBase: types.NetworkSettingsBase{Ports: c.Ports},
+			Networks:            c.Endpoints,
+		},
+	}, nil
+}
+
+func (f *FakeRuntime) List(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["List"]; err != nil {
+		return nil, err
+	}
+
+	var containers []types.Container
+	for _, c := range f.containers {
+		if (!c.Running && !c.Restarting && !options.All) || !matchLabels(c.Config.Labels, options.Filters) {
+			continue
+		}
+
+		state := "exited"
+		if c.Restarting {
+			state = "restarting"
+		} else if c.Running {
+			state = "running"
+		}
+
+		containers = append(containers, types.Container{
+			ID:      c.ID,
+			Names:   []string{"/" + c.Name},
+			Image:   c.Config.Image,
+			Labels:  c.Config.Labels,
+			State:   state,
+			Created: c.Created.Unix(),
+		})
+	}
+	return containers, nil
+}
+
+func (f *FakeRuntime) Logs(ctx context.Context, id string, options container.LogsOptions) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["Logs"]; err != nil {
+		return nil, err
+	}
+
+	c, err := f.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like Docker, logs of a container without a tty come multiplexed.
+	var buf bytes.Buffer
+	if options.ShowStdout && c.Stdout != "" {
+		stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(c.Stdout))
+	}
+	if options.ShowStderr && c.Stderr != "" {
+		stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte(c.Stderr))
+	}
+	return io.NopCloser(&buf), nil
+}
+
+func (f *FakeRuntime) Stats(ctx context.Context, id string) (types.StatsJSON, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["Stats"]; err != nil {
+		return types.StatsJSON{}, err
+	}
+
+	c, err := f.find(id)
+	if err != nil {
+		return types.StatsJSON{}, err
+	}
+	return c.Stats, nil
+}
+
+func (f *FakeRuntime) CreateVolume(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["CreateVolume"]; err != nil {
+		return volume.Volume{}, err
+	}
+
+	// Like Docker, creating a volume that exists returns the existing one.
+	if v, ok := f.volumes[options.Name]; ok {
+		return *v, nil
+	}
+
+	v := &volume.Volume{
+		Name:       options.Name,
+		Driver:     "local",
+		Labels:     options.Labels,
+		Mountpoint: "/var/lib/docker/volumes/" + options.Name + "/_data",
+		Scope:      "local",
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	f.volumes[v.Name] = v
+	return *v, nil
+}
+
+func (f *FakeRuntime) InspectVolume(ctx context.Context, name string) (volume.Volume, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["InspectVolume"]; err != nil {
+		return volume.Volume{}, err
+	}
+
+	v, ok := f.volumes[name]
+	if !ok {
+		return volume.Volume{}, errdefs.NotFound(fmt.Errorf("no such volume: %s", name))
+	}
+	return *v, nil
+}
+
+func (f *FakeRuntime) ListVolumes(ctx context.Context, options volume.ListOptions) ([]*volume.Volume, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["ListVolumes"]; err != nil {
+		return nil, err
+	}
+
+	var volumes []*volume.Volume
+	for _, v := range f.volumes {
+		if matchLabels(v.Labels, options.Filters) {
+			copied := *v
+			volumes = append(volumes, &copied)
+		}
+	}
+	return volumes, nil
+}
+
+func (f *FakeRuntime) RemoveVolume(ctx context.Context, name string, force bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["RemoveVolume"]; err != nil {
+		return err
+	}
+
+	if _, ok := f.volumes[name]; !ok {
+		return errdefs.NotFound(fmt.Errorf("no such volume: %s", name))
+	}
+
+	// Docker refuses to remove a volume a container uses, even with force.
+	for _, c := range f.containers {
+		for _, m := range c.HostConfig.Mounts {
+			if m.Type == mount.TypeVolume && m.Source == name {
+				return errdefs.Conflict(fmt.Errorf("volume %s is in use by container %s", name, c.ID))
+			}
+		}
+	}
+
+	delete(f.volumes, name)
+	return nil
+}
+
+func (f *FakeRuntime) CreateNetwork(ctx context.Context, name string, options types.NetworkCreate) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["CreateNetwork"]; err != nil {
+		return "", err
+	}
+
+	if _, err := f.findNetwork(name); err == nil {
+		return "", errdefs.Conflict(fmt.Errorf("network with name %s already exists", name))
+	}
+
+	f.nextId++
+	n := &types.NetworkResource{
+		Name:    name,
+		ID:      fmt.Sprintf("network%04d", f.nextId),
+		Created: time.Now().UTC(),
+		Scope:   "local",
+		Driver:  utils.DefaultIfBlank(options.Driver, "bridge"),
+		Labels:  options.Labels,
+	}
+	f.networks[n.ID] = n
+	return n.ID, nil
+}
+
+func (f *FakeRuntime) InspectNetwork(ctx context.Context, name string) (types.NetworkResource, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["InspectNetwork"]; err != nil {
+		return types.NetworkResource{}, err
+	}
+
+	n, err := f.findNetwork(name)
+	if err != nil {
+		return types.NetworkResource{}, err
+	}
+	return f.withContainers(*n), nil
+}
+
+func (f *FakeRuntime) ListNetworks(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["ListNetworks"]; err != nil {
+		return nil, err
+	}
+
+	var networks []types.NetworkResource
+	for _, n := range f.networks {
+		if matchLabels(n.Labels, options.Filters) {
+			networks = append(networks, f.withContainers(*n))
+		}
+	}
+	return networks, nil
+}
+
+func (f *FakeRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["RemoveNetwork"]; err != nil {
+		return err
+	}
+
+	n, err := f.findNetwork(name)
+	if err != nil {
+		return err
+	}
+
+	if len(f.withContainers(*n).Containers) > 0 {
+		return errdefs.Forbidden(fmt.Errorf("error while removing network: network %s id %s has active endpoints", n.Name, n.ID))
+	}
+
+	delete(f.networks, n.ID)
+	return nil
+}
+
+func (f *FakeRuntime) findNetwork(idOrName string) (*types.NetworkResource, error) {
+	if n, ok := f.networks[idOrName]; ok {
+		return n, nil
+	}
+
+	for _, n := range f.networks {
+		if n.Name == idOrName {
+			return n, nil
+		}
+	}
+	return nil, errdefs.NotFound(fmt.Errorf("network %s not found", idOrName))
+}
+
+// withContainers fills in the containers attached to the network.
+func (f *FakeRuntime) withContainers(n types.NetworkResource) types.NetworkResource {
+	n.Containers = make(map[string]types.EndpointResource)
+	for _, c := range f.containers {
+		if _, ok := c.Endpoints[n.Name]; ok {
+			n.Containers[c.ID] = types.EndpointResource{Name: c.Name}
+		}
+	}
+	return n
+}
+
+// matchLabels reports whether labels satisfy every label filter, given as
+// either key or key=value.
+func matchLabels(labels map[string]string, args filters.Args) bool {
+	for _, filter := range args.Get("label") {
+		key, value, hasValue := strings.Cut(filter, "=")
+		got, ok := labels[key]
+		if !ok || (hasValue && got != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *FakeRuntime) update(method string, id string, change func(c *FakeContainer) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures[method]; err != nil {
+		return err
+	}
+
+	c, err := f.find(id)
+	if err != nil {
+		return err
+	}
+	return change(c)
+}
+
+// find looks a container up by id or name, like Docker does.
+func (f *FakeRuntime) find(idOrName string) (*FakeContainer, error) {
+	if c, ok := f.containers[idOrName]; ok {
+		return c, nil
+	}
+
+	for _, c := range f.containers {
+		if c.Name == strings.TrimPrefix(idOrName, "/") {
+			return c, nil
+		}
+	}
+	return nil, errdefs.NotFound(fmt.Errorf("no such container: %s", idOrName))
+}
@@ -0,0 +1,182 @@
+package dkrclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Runtime is everything joyboy asks of a container engine. The options are
+// Docker's own types, since Docker is the engine the rest is modelled on.
+type Runtime interface {
+	// Pull fetches the image and returns the engine's progress messages,
+	// which the caller must read to the end and close.
+	Pull(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error)
+	// InspectImage returns a NotFound error when the image is not present
+	// locally.
+	InspectImage(ctx context.Context, ref string) (types.ImageInspect, error)
+	Create(ctx context.Context, name string, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig) (string, error)
+	Start(ctx context.Context, id string) error
+	Stop(ctx context.Context, id string, options container.StopOptions) error
+	Remove(ctx context.Context, id string, options container.RemoveOptions) error
+	Inspect(ctx context.Context, id string) (types.ContainerJSON, error)
+	List(ctx context.Context, options container.ListOptions) ([]types.Container, error)
+	Logs(ctx context.Context, id string, options container.LogsOptions) (io.ReadCloser, error)
+	// Stats returns a single reading of the container's usage.
+	Stats(ctx context.Context, id string) (types.StatsJSON, error)
+
+	CreateVolume(ctx context.Context, options volume.CreateOptions) (volume.Volume, error)
+	InspectVolume(ctx context.Context, name string) (volume.Volume, error)
+	ListVolumes(ctx context.Context, options volume.ListOptions) ([]*volume.Volume, error)
+	RemoveVolume(ctx context.Context, name string, force bool) error
+
+	CreateNetwork(ctx context.Context, name string, options types.NetworkCreate) (string, error)
+	InspectNetwork(ctx context.Context, name string) (types.NetworkResource, error)
+	ListNetworks(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error)
+	RemoveNetwork(ctx context.Context, name string) error
+}
+
+var (
+	_ Runtime = (*DockerRuntime)(nil)
+	_ Runtime = (*FakeRuntime)(nil)
+)
+
+// DockerRuntime is the Runtime backed by a Docker daemon.
+type DockerRuntime struct {
+	Client *client.Client
+}
+
+func NewDockerRuntime(cli *client.Client) *DockerRuntime {
+	return &DockerRuntime{Client: cli}
+}
+
+func (d *DockerRuntime) Pull(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error) {
+	reader, err := d.Client.ImagePull(ctx, ref, options)
+	return reader, countError("pull", err)
+}
+
+func (d *DockerRuntime) InspectImage(ctx context.Context, ref string) (types.ImageInspect, error) {
+	info, _, err := d.Client.ImageInspectWithRaw(ctx, ref)
+	return info, countError("inspect_image", err)
+}
+
+func (d *DockerRuntime) Create(ctx context.Context, name string, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig) (string, error) {
+	resp, err := d.Client.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, name)
+	if err != nil {
+		return "", countError("create", err)
+	}
+	return resp.ID, nil
+}
+
+func (d *DockerRuntime) Start(ctx context.Context, id string) error {
+	return countError("start", d.Client.ContainerStart(ctx, id, container.StartOptions{}))
+}
+
+func (d *DockerRuntime) Stop(ctx context.Context, id string, options container.StopOptions) error {
+	return countError("stop", d.Client.ContainerStop(ctx, id, options))
+}
+
+func (d *DockerRuntime) Remove(ctx context.Context, id string, options container.RemoveOptions) error {
+	return countError("remove", d.Client.ContainerRemove(ctx, id, options))
+}
+
+func (d *DockerRuntime) Inspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	info, err := d.Client.ContainerInspect(ctx, id)
+	return info, countError("inspect", err)
+}
+
+func (d *DockerRuntime) List(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
+	containers, err := d.Client.ContainerList(ctx, options)
+	return containers, countError("list", err)
+}
+
+func (d *DockerRuntime) Logs(ctx context.Context, id string, options container.LogsOptions) (io.ReadCloser, error) {
+	logs, err := d.Client.ContainerLogs(ctx, id, options)
+	return logs, countError("logs", err)
+}
+
+func (d *DockerRuntime) Stats(ctx context.Context, id string) (types.StatsJSON, error) {
+	stats, err := d.Client.ContainerStats(ctx, id, false)
+	if err != nil {
+		return types.StatsJSON{}, countError("stats", err)
+	}
+	defer stats.Body.Close()
+
+	var stat types.StatsJSON
+	if err := json.NewDecoder(stats.Body).Decode(&stat); err != nil {
+		return types.StatsJSON{}, countError("stats", err)
+	}
+	return stat, nil
+}
+
+func (d *DockerRuntime) CreateVolume(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	v, err := d.Client.VolumeCreate(ctx, options)
+	return v, countError("create_volume", err)
+}
+
+func (d *DockerRuntime) InspectVolume(ctx context.Context, name string) (volume.Volume, error) {
+	v, err := d.Client.VolumeInspect(ctx, name)
+	return v, countError("inspect_volume", err)
+}
+
+func (d *DockerRuntime) ListVolumes(ctx context.Context, options volume.ListOptions) ([]*volume.Volume, error) {
+	resp, err := d.Client.VolumeList(ctx, options)
+	if err != nil {
+		return nil, countError("list_volumes", err)
+	}
+	return resp.Volumes, nil
+}
+
+func (d *DockerRuntime) RemoveVolume(ctx context.Context, name string, force bool) error {
+	return countError("remove_volume", d.Client.VolumeRemove(ctx, name, force))
+}
+
+func (d *DockerRuntime) CreateNetwork(ctx context.Context, name string, options types.NetworkCreate) (string, error) {
+	resp, err := d.Client.NetworkCreate(ctx, name, options)
+	if err != nil {
+		return "", countError("create_network", err)
+	}
+	return resp.ID, nil
+}
+
+func (d *DockerRuntime) InspectNetwork(ctx context.Context, name string) (types.NetworkResource, error) {
+	n, err := d.Client.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	return n, countError("inspect_network", err)
+}
+
+func (d *DockerRuntime) ListNetworks(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error) {
+	networks, err := d.Client.NetworkList(ctx, options)
+	return networks, countError("list_networks", err)
+}
+
+func (d *DockerRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	return countError("remove_network", d.Client.NetworkRemove(ctx, name))
+}
+
+// apiErrors counts the calls to Docker that failed, by operation.
+var apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "joyboy_docker_api_errors_total",
+	Help: "Calls to the Docker API that failed, by operation.",
+}, []string{"operation"})
+
+func init() {
+	prometheus.MustRegister(apiErrors)
+}
+
+// countError counts err as a failed call, unless it only says that what was
+// looked up does not exist, which joyboy asks about routinely.
+func countError(operation string, err error) error {
+	if err != nil && !errdefs.IsNotFound(err) {
+		apiErrors.WithLabelValues(operation).Inc()
+	}
+	return err
+}
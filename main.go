@@ -9,23 +9,41 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/golang-collections/collections/queue"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/shashank-mugiwara/joyboy/config"
 	"github.com/shashank-mugiwara/joyboy/database"
 	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/manager"
 	"github.com/shashank-mugiwara/joyboy/migrate"
+	credentialapi "github.com/shashank-mugiwara/joyboy/pkg/credential-api"
+	networkapi "github.com/shashank-mugiwara/joyboy/pkg/network-api"
 	taskapi "github.com/shashank-mugiwara/joyboy/pkg/task-api"
+	volumeapi "github.com/shashank-mugiwara/joyboy/pkg/volume-api"
+	workerapi "github.com/shashank-mugiwara/joyboy/pkg/worker-api"
+	"github.com/shashank-mugiwara/joyboy/portalloc"
 	"github.com/shashank-mugiwara/joyboy/router"
 	"github.com/shashank-mugiwara/joyboy/scheduler"
+	"github.com/shashank-mugiwara/joyboy/strategy"
 	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/taskqueue"
+	"github.com/shashank-mugiwara/joyboy/utils"
 	"github.com/shashank-mugiwara/joyboy/worker"
 	"gorm.io/gorm"
 )
 
-func HandleRoutes(r *echo.Echo, w worker.Worker, db *gorm.DB) {
-	taskapi.NewHandler(w, db).InitRoutes(r)
+func HandleRoutes(r *echo.Echo, b taskapi.Backend, services *scheduler.ServiceReconciler, db *gorm.DB) {
+	taskapi.NewHandler(b, services, db).InitRoutes(r)
+}
+
+func queueDepth(q taskqueue.TaskQueue) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "joyboy_queue_depth",
+		Help: "Tasks waiting in this node's queue.",
+	}, func() float64 {
+		return float64(q.Len())
+	})
 }
 
 func main() {
@@ -37,42 +55,137 @@ func main() {
 
 	database.InitDb()
 	migrate.AutoMigrate()
-	dkrclient.InitPlainDockerClient()
 
-	w := worker.Worker{
-		Queue: queue.New(),
-		DB:    database.GetDb(),
+	isManager := config.ApplicationSetting.Role == "manager"
+
+	// Cancelled on shutdown, so the task loop stops taking new work.
+	runCtx, stopRunning := context.WithCancel(context.Background())
+	tasksDone := make(chan struct{})
+
+	var backend taskapi.Backend
+	if isManager {
+		placement, err := strategy.GetImplementationStrategy(config.StrategySetting.Placement)
+		if err != nil {
+			log.Fatalf("Failed to set up placement strategy: %v\n", err)
+		}
+
+		m := manager.New(config.ManagerSetting.Workers, database.GetDb(), placement)
+		backend = m
+		prometheus.MustRegister(queueDepth(m.Pending))
+
+		r.Logger.Info("Manager initialized with workers: ", m.Workers)
+		go manager.RunSendWork(m)
+		go manager.RunUpdateTasks(m)
+	} else {
+		if err := task.ValidateShutdownMode(config.WorkerSetting.ShutdownMode); err != nil {
+			log.Fatalf("Failed to set up worker: %v\n", err)
+		}
+
+		credentialKey, err := task.LoadCredentialKey(config.CredentialSetting.KeyFile)
+		if err != nil {
+			log.Fatalf("Failed to set up worker: %v\n", err)
+		}
+
+		if credentialKey != nil {
+			if n, err := task.SealRegistryCredentials(database.GetDb(), credentialKey); err != nil {
+				log.Printf("Failed to encrypt registry passwords: %v\n", err)
+			} else if n > 0 {
+				log.Printf("Encrypted %d registry passwords\n", n)
+			}
+		}
+
+		dkrclient.InitPlainDockerClient()
+
+		queue := taskqueue.NewDbQueue(database.GetDb(), "worker")
+		w := &worker.Worker{
+			Queue:         queue,
+			DB:            database.GetDb(),
+			Runtime:       dkrclient.GetRuntime(),
+			Ports:         portalloc.New(database.GetDb(), config.PortSetting.RangeStart, config.PortSetting.RangeEnd),
+			CredentialKey: credentialKey,
+		}
+
+		// Containers are adopted first, so the tasks whose container was
+		// already created are not started a second time.
+		if n, err := w.AdoptContainers(); err != nil {
+			log.Printf("Failed to adopt task containers: %v\n", err)
+		} else if n > 0 {
+			log.Printf("Adopted %d task containers\n", n)
+		}
+
+		if n, err := queue.RequeueScheduled(); err != nil {
+			log.Printf("Failed to requeue scheduled tasks: %v\n", err)
+		} else if n > 0 {
+			log.Printf("Requeued %d scheduled tasks\n", n)
+		}
+
+		prometheus.MustRegister(queueDepth(queue))
+		backend = w
+		workerapi.NewHandler(w, database.GetDb()).InitRoutes(r)
+		volumeapi.NewHandler(dkrclient.GetRuntime(), database.GetDb()).InitRoutes(r)
+		networkapi.NewHandler(dkrclient.GetRuntime(), database.GetDb()).InitRoutes(r)
+		credentialapi.NewHandler(database.GetDb(), credentialKey).InitRoutes(r)
+
+		go worker.RunCollectStats(w, 15*time.Second)
+
+		r.Logger.Info("Worker initialized and are Ready...")
+		go func() {
+			worker.RunTasks(runCtx, w, config.WorkerSetting.Concurrency)
+			close(tasksDone)
+		}()
+		r.Logger.Info("Workers are now listening to their worker queue.")
+
+		r.Logger.Info("Running background scheduler")
+		containers := &scheduler.Scheduler{Runtime: dkrclient.GetRuntime(), DB: database.GetDb(), Worker: w}
+		prometheus.MustRegister(containers)
+		go scheduler.InitBackgroundScheduler(containers)
+
+		health := &scheduler.HealthChecker{DB: database.GetDb(), Runtime: dkrclient.GetRuntime(), Worker: w}
+		go scheduler.RunHealthChecks(health, time.Second)
+		r.Logger.Info("Initiated background scheduler.")
+	}
+
+	// On a manager the docker client is never set up, so dead replicas are
+	// only noticed once their worker marks them Failed and reports them.
+	services := &scheduler.ServiceReconciler{
+		DB:      database.GetDb(),
+		Runner:  backend,
+		Runtime: dkrclient.GetRuntime(),
 	}
+	go scheduler.RunServiceReconciler(services, 15*time.Second)
 
-	HandleRoutes(r, w, database.GetDb())
+	prometheus.MustRegister(task.StateCollector(database.GetDb()))
+	HandleRoutes(r, backend, services, database.GetDb())
 
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
 
 	// Start server
 	go func() {
-		if err := r.Start(":8070"); err != nil && err != http.ErrServerClosed {
+		if err := r.Start(":" + utils.DefaultIfBlank(config.ApplicationSetting.Port, "8070")); err != nil && err != http.ErrServerClosed {
 			r.Logger.Fatal("shutting down the server")
 		}
 	}()
 
-	r.Logger.Info("Worker initialized and are Ready...")
-	go worker.RunTasks(w)
-	r.Logger.Info("Workers are now listening to their worker queue.")
-
-	r.Logger.Info("Running background scheduler")
-	go scheduler.InitBackgroundScheduler()
-	r.Logger.Info("Initiated background scheduler.")
-
 	sig := <-signalCh
 	log.Printf("Received signal: %v\n", sig)
-	log.Printf("Stopping all running containers gracefully")
-
-	task.StopAllTasks()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	stopRunning()
+	if !isManager {
+		log.Printf("Waiting for tasks that are being started")
+		select {
+		case <-tasksDone:
+		case <-ctx.Done():
+			log.Printf("Gave up waiting for tasks that are being started")
+		}
+
+		log.Printf("Shutting down task containers, shutdown mode is %q", utils.DefaultIfBlank(config.WorkerSetting.ShutdownMode, task.ShutdownStop))
+		task.StopAllTasks(database.GetDb(), dkrclient.GetRuntime(), config.WorkerSetting.ShutdownMode)
+	}
+
 	// Shutdown the server gracefully
 	if err := r.Shutdown(ctx); err != nil {
 		log.Fatalf("Server shutdown failed: %v\n", err)
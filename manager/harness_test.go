@@ -0,0 +1,84 @@
+package manager
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	taskapi "github.com/shashank-mugiwara/joyboy/pkg/task-api"
+	workerapi "github.com/shashank-mugiwara/joyboy/pkg/worker-api"
+	"github.com/shashank-mugiwara/joyboy/scheduler"
+	placementstrategy "github.com/shashank-mugiwara/joyboy/strategy/placement_strategy"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/taskqueue"
+	"github.com/shashank-mugiwara/joyboy/worker"
+	"gorm.io/gorm"
+)
+
+type testWorker struct {
+	worker *worker.Worker
+	db     *gorm.DB
+	addr   string
+}
+
+// startWorkers starts n in-process joyboy workers, each with its own
+// database and its task and worker APIs served over a real HTTP listener.
+// The workers share the given runtime, as if they ran on one Docker host.
+func startWorkers(t *testing.T, n int, rt dkrclient.Runtime) []*testWorker {
+	t.Helper()
+
+	var workers []*testWorker
+	for i := 0; i < n; i++ {
+		db := newTestDb(t)
+		w := &worker.Worker{
+			Name:    fmt.Sprintf("worker%d", i),
+			Queue:   taskqueue.NewDbQueue(db, "worker"),
+			DB:      db,
+			Runtime: rt,
+		}
+
+		e := echo.New()
+		taskapi.NewHandler(w, &scheduler.ServiceReconciler{DB: db, Runner: w, Runtime: rt}, db).InitRoutes(e)
+		workerapi.NewHandler(w, db).InitRoutes(e)
+		srv := httptest.NewServer(e)
+		t.Cleanup(srv.Close)
+
+		workers = append(workers, &testWorker{
+			worker: w,
+			db:     db,
+			addr:   srv.Listener.Addr().String(),
+		})
+	}
+
+	return workers
+}
+
+// startManager starts a manager for the given workers and returns it along
+// with the base url of its task API.
+func startManager(t *testing.T, workers []*testWorker) (*Manager, string) {
+	t.Helper()
+
+	var addrs []string
+	for _, w := range workers {
+		addrs = append(addrs, w.addr)
+	}
+
+	db := newTestDb(t)
+	m := New(addrs, db, &placementstrategy.RoundRobin{})
+
+	e := echo.New()
+	taskapi.NewHandler(m, &scheduler.ServiceReconciler{DB: db, Runner: m}, db).InitRoutes(e)
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	return m, srv.URL
+}
+
+func newTestDb(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	return dbtest.Open(t, &task.Task{}, &task.Service{}, &task.ScalingEvent{}, &task.TaskEvent{}, &taskqueue.QueuedTask{})
+}
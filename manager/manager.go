@@ -1,30 +1,426 @@
 package manager
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
 
-	"github.com/golang-collections/collections/queue"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
 	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/node"
+	"github.com/shashank-mugiwara/joyboy/pkg/metrics"
+	workerapi "github.com/shashank-mugiwara/joyboy/pkg/worker-api"
+	placementstrategy "github.com/shashank-mugiwara/joyboy/strategy/placement_strategy"
 	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/taskqueue"
+	"github.com/shashank-mugiwara/joyboy/utils"
+	"gorm.io/gorm"
 )
 
+// Manager accepts tasks through the task API and spreads them over a set of
+// joyboy workers. Workers are plain joyboy instances addressed as host:port,
+// and the manager drives them through their worker API.
 type Manager struct {
-	Pending       queue.Queue
-	TaskDb        map[string][]task.Task
-	EventDb       map[string][]task.TaskEvent
+	Pending       taskqueue.TaskQueue
+	TaskDb        map[uuid.UUID]*task.Task
 	Workers       []string
 	WorkerTaskMap map[string][]uuid.UUID
 	TaskWorkerMap map[uuid.UUID]string
+	Strategy      placementstrategy.PlacementStrategy
+	DB            *gorm.DB
+	Client        *http.Client
+
+	mu sync.Mutex
 }
 
-func (m *Manager) SelectWorker() {
-	fmt.Println("I will select an appropriate worker")
+// New sets up a manager for the given workers. Tasks a previous run of the
+// manager sent to a worker are picked up again from the database, so they
+// keep being polled and can still be stopped. Scheduled tasks are queued
+// again, as the previous run may have stopped before delivering them, and
+// go back to the worker they were meant for if one was picked.
+func New(workers []string, db *gorm.DB, s placementstrategy.PlacementStrategy) *Manager {
+	workerTaskMap := make(map[string][]uuid.UUID)
+	for _, w := range workers {
+		workerTaskMap[w] = []uuid.UUID{}
+	}
+
+	queue := taskqueue.NewDbQueue(db, "manager")
+	if n, err := queue.RequeueScheduled(); err != nil {
+		log.Printf("Failed to requeue scheduled tasks: %v\n", err)
+	} else if n > 0 {
+		log.Printf("Requeued %d scheduled tasks\n", n)
+	}
+
+	m := &Manager{
+		Pending:       queue,
+		TaskDb:        make(map[uuid.UUID]*task.Task),
+		Workers:       workers,
+		WorkerTaskMap: workerTaskMap,
+		TaskWorkerMap: make(map[uuid.UUID]string),
+		Strategy:      s,
+		DB:            db,
+		Client:        &http.Client{Timeout: 30 * time.Second},
+	}
+
+	var sent []task.Task
+	if result := db.Where("worker <> ''").Find(&sent); result.Error != nil {
+		log.Printf("Failed to fetch the tasks sent to workers: %v\n", result.Error)
+		return m
+	}
+
+	for i := range sent {
+		t := &sent[i]
+		m.WorkerTaskMap[t.Worker] = append(m.WorkerTaskMap[t.Worker], t.ID)
+		m.TaskWorkerMap[t.ID] = t.Worker
+		m.TaskDb[t.ID] = t
+	}
+
+	return m
 }
 
-func (m *Manager) UpdateTasks() {
-	fmt.Println("I will update the tasks")
+// SelectWorker asks every worker for its latest stats and lets the placement
+// strategy pick one of the workers that answered.
+func (m *Manager) SelectWorker(t task.Task) (string, error) {
+	if len(m.Workers) == 0 {
+		return "", errors.New("no workers are configured for this manager")
+	}
+
+	var nodes []node.Node
+	for _, w := range m.Workers {
+		stats, err := m.workerClient(w).Stats()
+		if err != nil {
+			log.Printf("Failed to fetch stats from worker %v: %v\n", w, err)
+			continue
+		}
+		nodes = append(nodes, stats.Node(w))
+	}
+
+	if len(nodes) == 0 {
+		return "", errors.New("none of the workers could be reached")
+	}
+
+	selected, err := m.Strategy.SelectNode(t, nodes)
+	if err != nil {
+		return "", err
+	}
+
+	return selected.Name, nil
 }
 
+func (m *Manager) AddTask(t task.Task) error {
+	if err := m.Pending.Enqueue(t); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.TaskDb[t.ID] = &t
+	return nil
+}
+
+// SendWork sends every task that is pending at the time of the call to a
+// worker. Tasks that could not be delivered are queued again for the next
+// round, tasks a worker rejected are marked as failed.
 func (m *Manager) SendWork() {
-	fmt.Println("I will send work to workers")
+	pending := m.Pending.Len()
+	if pending == 0 {
+		log.Println("No work in the queue")
+		return
+	}
+
+	for i := 0; i < pending; i++ {
+		t, ok, err := m.Pending.Dequeue()
+		if err != nil {
+			log.Printf("Failed to take a task off the queue: %v\n", err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		m.sendTask(t)
+	}
+}
+
+// sendTask delivers the task to a worker. The worker is recorded before the
+// task is sent, and a task that already has one is only ever sent to that
+// worker, so a send that may or may not have arrived never leaves the task
+// on two workers.
+func (m *Manager) sendTask(t task.Task) {
+	if t.Worker == "" {
+		w, err := m.SelectWorker(t)
+		if errors.Is(err, placementstrategy.ErrNoCandidates) {
+			log.Printf("No worker can fit task %v: %v\n", t.ID, err)
+			m.markFailed(t, err.Error())
+			return
+		}
+
+		if err != nil {
+			log.Printf("Failed to select a worker for task %v: %v\n", t.ID, err)
+			m.requeue(t)
+			return
+		}
+
+		if err := m.assign(t.ID, w); err != nil {
+			log.Printf("Failed to record worker %v of task %v: %v\n", w, t.ID, err)
+			m.requeue(t)
+			return
+		}
+		t.Worker = w
+	}
+
+	w := t.Worker
+	client := m.workerClient(w)
+	status, err := client.SubmitTask(t)
+
+	// The worker already has the task when an earlier send did arrive.
+	var apiErr *workerapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == workerapi.ErrTaskConflict {
+		if existing, getErr := client.GetTask(t.ID); getErr == nil {
+			status, err = existing, nil
+		}
+	}
+
+	if err != nil {
+		if errors.As(err, &apiErr) {
+			log.Printf("Worker %v rejected task %v: %v\n", w, t.ID, apiErr)
+			if err := m.assign(t.ID, ""); err != nil {
+				log.Printf("Failed to clear worker %v of task %v: %v\n", w, t.ID, err)
+			}
+			m.markFailed(t, "rejected by worker "+w+": "+apiErr.Error())
+			return
+		}
+
+		log.Printf("Error connecting to worker %v: %v\n", w, err)
+		m.requeue(t)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.TaskWorkerMap[t.ID]; !ok {
+		m.WorkerTaskMap[w] = append(m.WorkerTaskMap[w], t.ID)
+		m.TaskWorkerMap[t.ID] = w
+	}
+	t.State = status.State
+	m.TaskDb[t.ID] = &t
+	log.Printf("Sent task %v to worker %v\n", t.ID, w)
+}
+
+// assign records the worker the task is sent to, or that it has none when w
+// is empty.
+func (m *Manager) assign(id uuid.UUID, w string) error {
+	return m.DB.Model(&task.Task{ID: id}).Update("worker", w).Error
+}
+
+// UpdateTasks asks every worker for the tasks it was given and copies their
+// current state into the manager's own records.
+func (m *Manager) UpdateTasks() {
+	for _, w := range m.Workers {
+		m.mu.Lock()
+		taskIds := append([]uuid.UUID{}, m.WorkerTaskMap[w]...)
+		m.mu.Unlock()
+
+		client := m.workerClient(w)
+		for _, id := range taskIds {
+			status, err := client.GetTask(id)
+			if err != nil {
+				var apiErr *workerapi.Error
+				if errors.As(err, &apiErr) {
+					log.Printf("Failed to fetch task %v from worker %v: %v\n", id, w, apiErr)
+					continue
+				}
+
+				log.Printf("Error connecting to worker %v: %v\n", w, err)
+				break
+			}
+
+			m.updateTask(status)
+		}
+	}
+}
+
+func (m *Manager) updateTask(status workerapi.TaskStatus) {
+	id, err := uuid.Parse(status.ID)
+	if err != nil {
+		log.Printf("Worker reported a task with an improper id %v\n", status.ID)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var t task.Task
+	if result := m.DB.Where(&task.Task{ID: id}).Take(&t); result.Error != nil {
+		log.Printf("Failed to fetch task %v from DB: %v\n", id, result.Error)
+		return
+	}
+
+	t.ContainerID = status.ContainerID
+	t.StartTime = status.StartTime
+	t.FinishTime = status.FinishTime
+	t.PullProgress = status.PullProgress
+	t.Health = status.Health
+	t.HealthMessage = status.HealthMessage
+	m.TaskDb[id] = &t
+
+	if t.State == status.State {
+		result := m.DB.Model(&task.Task{ID: id}).Select("container_id", "start_time", "finish_time", "pull_progress", "health", "health_message").Updates(task.Task{
+			ContainerID:   t.ContainerID,
+			StartTime:     t.StartTime,
+			FinishTime:    t.FinishTime,
+			PullProgress:  t.PullProgress,
+			Health:        t.Health,
+			HealthMessage: t.HealthMessage,
+		})
+		if result.Error != nil {
+			log.Printf("Failed to update task %v in DB: %v\n", id, result.Error)
+		}
+		return
+	}
+
+	state, ok := task.ParseState(status.State)
+	if !ok {
+		log.Printf("Worker reported task %v in unknown state %v\n", id, status.State)
+		return
+	}
+
+	reason := utils.DefaultIfBlank(status.Message, "reported by worker")
+	if err := task.TransitionDb(m.DB, &t, state, reason, "container_id", "pull_progress", "health", "health_message"); err != nil {
+		log.Printf("Failed to move task %v to %v: %v\n", id, status.State, err)
+	}
+}
+
+// StopTask asks the worker that runs the task to stop it.
+func (m *Manager) StopTask(t *task.Task) task.DockerResult {
+	m.mu.Lock()
+	w, ok := m.TaskWorkerMap[t.ID]
+	m.mu.Unlock()
+
+	if !ok {
+		return task.DockerResult{
+			Error:   errors.New("no worker is running the given task"),
+			Message: "Failed to stop task. No worker found for task id: " + t.ID.String(),
+		}
+	}
+
+	status, err := m.workerClient(w).StopTask(t.ID)
+	if err != nil {
+		log.Printf("Worker %v failed to stop task %v: %v\n", w, t.ID, err)
+		return task.DockerResult{
+			Error:   err,
+			Action:  "stop",
+			Result:  "failure",
+			Message: "Please check the container might still be running on worker " + w,
+		}
+	}
+
+	m.forget(t.ID, w)
+	deleteResult := m.DB.Delete(&task.Task{ID: t.ID})
+	if deleteResult.Error != nil {
+		log.Printf("Failed to delete task %v in DB after stopping it: %v\n", t.ID, deleteResult.Error)
+	}
+
+	return task.DockerResult{
+		Action:      "stop",
+		ContainerId: status.ContainerID,
+		Result:      "success",
+		Message:     status.Message,
+	}
+}
+
+// TaskLogs streams the task's logs from the worker that runs it.
+func (m *Manager) TaskLogs(ctx context.Context, t task.Task, options container.LogsOptions) (io.ReadCloser, error) {
+	m.mu.Lock()
+	w, ok := m.TaskWorkerMap[t.ID]
+	m.mu.Unlock()
+
+	if !ok {
+		return nil, errdefs.NotFound(errors.New("no worker is running the given task"))
+	}
+
+	logs, err := m.workerClient(w).TaskLogs(ctx, t.ID, options)
+	return logs, asRuntimeError(err)
+}
+
+// TaskUsage reads the task's usage on the worker that runs it.
+func (m *Manager) TaskUsage(ctx context.Context, t task.Task) (metrics.Usage, error) {
+	m.mu.Lock()
+	w, ok := m.TaskWorkerMap[t.ID]
+	m.mu.Unlock()
+
+	if !ok {
+		return metrics.Usage{}, errdefs.NotFound(errors.New("no worker is running the given task"))
+	}
+
+	usage, err := m.workerClient(w).TaskUsage(t.ID)
+	return usage, asRuntimeError(err)
+}
+
+// asRuntimeError passes on a worker's refusal as the errors the task API
+// answers the same way for workers and managers.
+func asRuntimeError(err error) error {
+	var apiErr *workerapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Status() {
+		case http.StatusNotFound:
+			return errdefs.NotFound(apiErr)
+		case http.StatusConflict:
+			return errdefs.Conflict(apiErr)
+		}
+	}
+	return err
+}
+
+func (m *Manager) forget(id uuid.UUID, w string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.TaskWorkerMap, id)
+	delete(m.TaskDb, id)
+	ids := m.WorkerTaskMap[w]
+	for i, taskId := range ids {
+		if taskId == id {
+			m.WorkerTaskMap[w] = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+}
+
+func (m *Manager) requeue(t task.Task) {
+	if err := m.Pending.Enqueue(t); err != nil {
+		log.Printf("Failed to queue task %v again: %v\n", t.ID, err)
+	}
+}
+
+func (m *Manager) markFailed(t task.Task, reason string) {
+	status := workerapi.NewTaskStatus(t)
+	status.State = task.Failed.String()
+	status.Message = reason
+	m.updateTask(status)
+}
+
+func (m *Manager) workerClient(w string) *workerapi.Client {
+	return &workerapi.Client{Addr: w, HTTP: m.Client}
+}
+
+func RunSendWork(m *Manager) {
+	for {
+		m.SendWork()
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func RunUpdateTasks(m *Manager) {
+	for {
+		m.UpdateTasks()
+		time.Sleep(15 * time.Second)
+	}
 }
@@ -0,0 +1,286 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	taskapi "github.com/shashank-mugiwara/joyboy/pkg/task-api"
+	placementstrategy "github.com/shashank-mugiwara/joyboy/strategy/placement_strategy"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+func submitTask(t *testing.T, managerUrl string, req taskapi.TaskRequest) taskapi.TaskResponse {
+	t.Helper()
+
+	data, _ := json.Marshal(req)
+	resp, err := http.Post(managerUrl+"/api/v1/task/add", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("failed to submit task: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("submit task status = %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+
+	var taskResponse taskapi.TaskResponse
+	if err := json.NewDecoder(resp.Body).Decode(&taskResponse); err != nil {
+		t.Fatalf("failed to decode task response: %v", err)
+	}
+	return taskResponse
+}
+
+func TestSelectWorker(t *testing.T) {
+	workers := startWorkers(t, 3, dkrclient.NewFakeRuntime())
+	m, _ := startManager(t, workers)
+
+	for i := 0; i < 4; i++ {
+		got, err := m.SelectWorker(task.Task{Name: "nginx"})
+		if err != nil {
+			t.Fatalf("SelectWorker() error = %v", err)
+		}
+		if want := workers[i%3].addr; got != want {
+			t.Errorf("SelectWorker() call %d = %v, want %v", i, got, want)
+		}
+	}
+
+	if _, err := m.SelectWorker(task.Task{Name: "huge", Memory: 1 << 40}); err == nil {
+		t.Errorf("SelectWorker() for a task no worker can fit error = nil, want error")
+	}
+
+	m.Workers = []string{"127.0.0.1:1"}
+	if _, err := m.SelectWorker(task.Task{Name: "nginx"}); err == nil {
+		t.Errorf("SelectWorker() with no reachable worker error = nil, want error")
+	}
+
+	m.Workers = nil
+	if _, err := m.SelectWorker(task.Task{Name: "nginx"}); err == nil {
+		t.Errorf("SelectWorker() with no workers error = nil, want error")
+	}
+}
+
+func TestManagerRunsTasksOnWorkers(t *testing.T) {
+	docker := dkrclient.NewFakeRuntime()
+	workers := startWorkers(t, 3, docker)
+	m, managerUrl := startManager(t, workers)
+
+	var ids []uuid.UUID
+	for _, name := range []string{"nginx-1", "nginx-2", "nginx-3"} {
+		resp := submitTask(t, managerUrl, taskapi.TaskRequest{
+			Name:        name,
+			Image:       "nginx:stable",
+			PortMapping: map[string]string{"80": "8211"},
+		})
+		ids = append(ids, uuid.MustParse(resp.ID))
+	}
+
+	m.SendWork()
+
+	if m.Pending.Len() != 0 {
+		t.Fatalf("pending tasks after SendWork = %d, want 0", m.Pending.Len())
+	}
+
+	for _, w := range workers {
+		if got := len(m.WorkerTaskMap[w.addr]); got != 1 {
+			t.Errorf("tasks on worker %s = %d, want 1", w.addr, got)
+		}
+	}
+
+	for _, id := range ids {
+		w, ok := m.TaskWorkerMap[id]
+		if !ok {
+			t.Fatalf("task %v was not assigned to a worker", id)
+		}
+
+		var workerTask task.Task
+		owner := workers[0]
+		for _, tw := range workers {
+			if tw.addr == w {
+				owner = tw
+			}
+		}
+		if err := owner.db.First(&workerTask, "id = ?", id).Error; err != nil {
+			t.Errorf("worker %s has no row for task %v: %v", w, id, err)
+		}
+	}
+
+	for _, w := range workers {
+		if result := w.worker.RunTask(); result.Error != nil {
+			t.Fatalf("worker %s failed to run task: %v", w.addr, result.Error)
+		}
+	}
+
+	if got := len(docker.Containers()); got != 3 {
+		t.Fatalf("containers created = %d, want 3", got)
+	}
+
+	// A manager started again picks up the tasks sent by the previous one
+	// and keeps polling them.
+	restarted := New(m.Workers, m.DB, &placementstrategy.RoundRobin{})
+	if !reflect.DeepEqual(restarted.TaskWorkerMap, m.TaskWorkerMap) {
+		t.Errorf("restarted manager's task workers = %v, want %v", restarted.TaskWorkerMap, m.TaskWorkerMap)
+	}
+	restarted.UpdateTasks()
+
+	for _, id := range ids {
+		var managerTask task.Task
+		if err := m.DB.First(&managerTask, "id = ?", id).Error; err != nil {
+			t.Fatalf("manager lost task %v: %v", id, err)
+		}
+		if managerTask.State != task.Running.String() {
+			t.Errorf("task %v state = %v, want %v", id, managerTask.State, task.Running.String())
+		}
+		if managerTask.ContainerID == "" {
+			t.Errorf("task %v has no container id", id)
+		}
+	}
+
+	var first task.Task
+	m.DB.First(&first, "id = ?", ids[0])
+	c, _ := docker.Container(first.ContainerID)
+	c.Stdout = "ready for start up\n"
+	docker.SetContainer(c)
+
+	logs, err := http.Get(managerUrl + "/api/v1/task/" + ids[0].String() + "/logs")
+	if err != nil {
+		t.Fatalf("failed to fetch task logs: %v", err)
+	}
+	body, _ := io.ReadAll(logs.Body)
+	logs.Body.Close()
+	if logs.StatusCode != http.StatusOK || string(body) != c.Stdout {
+		t.Errorf("task logs = %d %q, want 200 %q", logs.StatusCode, body, c.Stdout)
+	}
+
+	usage, err := http.Get(managerUrl + "/api/v1/task/" + ids[0].String() + "/metrics")
+	if err != nil {
+		t.Fatalf("failed to fetch task metrics: %v", err)
+	}
+	usage.Body.Close()
+	if usage.StatusCode != http.StatusOK {
+		t.Errorf("task metrics status = %d, want 200", usage.StatusCode)
+	}
+
+	resp, err := http.Get(managerUrl + "/api/v1/task/" + ids[0].String() + "/events")
+	if err != nil {
+		t.Fatalf("failed to fetch task events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var events []task.TaskEvent
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		t.Fatalf("failed to decode task events: %v", err)
+	}
+
+	wantStates := [][2]string{{"", task.Scheduled.String()}, {task.Scheduled.String(), task.Running.String()}}
+	if len(events) != len(wantStates) {
+		t.Fatalf("task events = %+v, want %d events", events, len(wantStates))
+	}
+	for i, want := range wantStates {
+		if events[i].OldState != want[0] || events[i].NewState != want[1] || events[i].Reason == "" {
+			t.Errorf("task event %d = %+v, want %q to %q with a reason", i, events[i], want[0], want[1])
+		}
+	}
+
+	result := m.StopTask(&task.Task{ID: ids[0]})
+	if result.Error != nil {
+		t.Fatalf("StopTask() error = %v", result.Error)
+	}
+
+	if got := len(docker.Containers()); got != 2 {
+		t.Errorf("containers after stop = %d, want 2", got)
+	}
+	if _, ok := m.TaskWorkerMap[ids[0]]; ok {
+		t.Errorf("stopped task %v is still mapped to a worker", ids[0])
+	}
+	var count int64
+	m.DB.Model(&task.Task{}).Where("id = ?", ids[0]).Count(&count)
+	if count != 0 {
+		t.Errorf("stopped task %v is still in the manager db", ids[0])
+	}
+}
+
+func TestSendWorkRequeuesWhenWorkerIsDown(t *testing.T) {
+	workers := startWorkers(t, 1, dkrclient.NewFakeRuntime())
+	m, managerUrl := startManager(t, workers)
+	m.Workers = []string{"127.0.0.1:1"}
+
+	submitTask(t, managerUrl, taskapi.TaskRequest{Name: "nginx", Image: "nginx:stable"})
+	m.SendWork()
+
+	if m.Pending.Len() != 1 {
+		t.Errorf("pending tasks = %d, want 1", m.Pending.Len())
+	}
+	if len(m.TaskWorkerMap) != 0 {
+		t.Errorf("task was assigned to a worker that is down")
+	}
+}
+
+func TestSendWorkMarksRejectedTaskFailed(t *testing.T) {
+	workers := startWorkers(t, 1, dkrclient.NewFakeRuntime())
+	m, managerUrl := startManager(t, workers)
+
+	// The worker already runs a task with this name, so it refuses a second one.
+	existing := task.Task{ID: uuid.New(), Name: "nginx", State: task.Running.String()}
+	workers[0].db.Create(&existing)
+
+	resp := submitTask(t, managerUrl, taskapi.TaskRequest{Name: "nginx", Image: "nginx:stable"})
+	m.SendWork()
+
+	var managerTask task.Task
+	m.DB.First(&managerTask, "id = ?", resp.ID)
+	if managerTask.State != task.Failed.String() {
+		t.Errorf("rejected task state = %v, want %v", managerTask.State, task.Failed.String())
+	}
+}
+
+func TestNewResendsScheduledTasksToTheirWorker(t *testing.T) {
+	workers := startWorkers(t, 2, dkrclient.NewFakeRuntime())
+	m, managerUrl := startManager(t, workers)
+
+	resp := submitTask(t, managerUrl, taskapi.TaskRequest{Name: "web", Image: "nginx:stable"})
+	delivered := uuid.MustParse(resp.ID)
+	m.SendWork()
+
+	var stored task.Task
+	m.DB.First(&stored, "id = ?", delivered)
+	if stored.Worker != workers[0].addr {
+		t.Fatalf("worker recorded for the sent task = %q, want %q", stored.Worker, workers[0].addr)
+	}
+
+	// The previous run picked the second worker for this one, but stopped
+	// before sending it.
+	undelivered := task.Task{ID: uuid.New(), Name: "api", Image: "nginx:stable", State: task.Scheduled.String(), Worker: workers[1].addr}
+	m.DB.Create(&undelivered)
+
+	restarted := New(m.Workers, m.DB, &placementstrategy.RoundRobin{})
+	if n := restarted.Pending.Len(); n != 2 {
+		t.Fatalf("pending tasks after restart = %d, want 2", n)
+	}
+	restarted.SendWork()
+
+	for id, w := range map[uuid.UUID]*testWorker{delivered: workers[0], undelivered.ID: workers[1]} {
+		if got := restarted.TaskWorkerMap[id]; got != w.addr {
+			t.Errorf("task %v is on worker %q, want %q", id, got, w.addr)
+		}
+		if got := restarted.WorkerTaskMap[w.addr]; len(got) != 1 {
+			t.Errorf("tasks of worker %v = %v, want one", w.addr, got)
+		}
+
+		var count int64
+		w.db.Model(&task.Task{}).Where("id = ?", id).Count(&count)
+		if count != 1 {
+			t.Errorf("worker %v has task %v %d times, want once", w.addr, id, count)
+		}
+
+		m.DB.First(&stored, "id = ?", id)
+		if stored.State == task.Failed.String() {
+			t.Errorf("task %v failed when it was sent again", id)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package migrate
 import (
 	"github.com/shashank-mugiwara/joyboy/database"
 	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/taskqueue"
 )
 
 func AutoMigrate() error {
@@ -16,5 +17,30 @@ func AutoMigrate() error {
 		return err
 	}
 
+	err = database.GetDb().AutoMigrate(&task.Service{})
+	if err != nil {
+		return err
+	}
+
+	err = database.GetDb().AutoMigrate(&task.ScalingEvent{})
+	if err != nil {
+		return err
+	}
+
+	err = database.GetDb().AutoMigrate(&task.TaskEvent{})
+	if err != nil {
+		return err
+	}
+
+	err = database.GetDb().AutoMigrate(&taskqueue.QueuedTask{})
+	if err != nil {
+		return err
+	}
+
+	err = database.GetDb().AutoMigrate(&task.RegistryCredential{})
+	if err != nil {
+		return err
+	}
+
 	return err
 }
@@ -1,5 +1,7 @@
 package node
 
+// Node is a machine tasks can be placed on. Memory and disk are in MiB, Load
+// is the one minute load average.
 type Node struct {
 	Name            string
 	Ip              string
@@ -8,6 +10,7 @@ type Node struct {
 	MemoryAllocated int
 	Disk            int
 	DiskAllocated   int
+	Load            float64
 	Role            string
 	TaskCount       int
 }
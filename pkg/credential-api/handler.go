@@ -0,0 +1,30 @@
+package credentialapi
+
+import (
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Handler manages the registry credentials tasks pull private images with.
+// Passwords can be set but are never sent back.
+type Handler struct {
+	DB *gorm.DB
+	// Key encrypts the passwords before they are stored.
+	Key []byte
+}
+
+func NewHandler(db *gorm.DB, key []byte) *Handler {
+	return &Handler{
+		DB:  db,
+		Key: key,
+	}
+}
+
+func (h *Handler) InitRoutes(e *echo.Echo) {
+	credential_route := e.Group("/api/v1/credentials")
+	credential_route.GET("", h.GetListOfCredentials)
+	credential_route.POST("", h.CreateCredential)
+	credential_route.GET("/:name", h.GetSingleCredentialInformation)
+	credential_route.PUT("/:name", h.UpdateCredential)
+	credential_route.DELETE("/:name", h.RemoveCredential)
+}
@@ -0,0 +1,28 @@
+package credentialapi
+
+import (
+	"errors"
+
+	"github.com/shashank-mugiwara/joyboy/utils"
+)
+
+type CredentialRequest struct {
+	Name string `json:"name"`
+	// Server is the registry's address, such as registry.gitlab.com.
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	// Password can also be an access token, such as a GitLab deploy token.
+	Password string `json:"password"`
+}
+
+func (r CredentialRequest) validate() error {
+	if utils.IsBlank(r.Server) {
+		return errors.New("server field is mandatory")
+	}
+
+	if utils.IsBlank(r.Username) || r.Password == "" {
+		return errors.New("username and password fields are mandatory")
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package credentialapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+func (h *Handler) GetListOfCredentials(c echo.Context) error {
+	var creds []task.RegistryCredential
+	result := h.DB.Order("name").Find(&creds)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error)
+	}
+
+	return c.JSON(http.StatusOK, creds)
+}
+
+func (h *Handler) CreateCredential(c echo.Context) error {
+	req := CredentialRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, errors.New(err.Error()))
+	}
+
+	if err := task.ValidateCredentialName(req.Name); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	_, err := task.FindRegistryCredential(h.DB, req.Name)
+	if err == nil {
+		return c.JSON(http.StatusConflict, "Registry credential with name: "+req.Name+" already exists.")
+	}
+
+	if !errors.Is(err, task.ErrCredentialNotFound) {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	cred := task.RegistryCredential{
+		ID:        uuid.New(),
+		Name:      req.Name,
+		Server:    req.Server,
+		Username:  req.Username,
+		CreatedAt: time.Now().UTC(),
+	}
+	if status, err := h.setPassword(&cred, req.Password); err != nil {
+		return c.JSON(status, err.Error())
+	}
+
+	if result := h.DB.Create(&cred); result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error)
+	}
+
+	return c.JSON(http.StatusCreated, cred)
+}
+
+func (h *Handler) GetSingleCredentialInformation(c echo.Context) error {
+	cred, status, err := h.findCredential(c.Param("name"))
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, cred)
+}
+
+// UpdateCredential replaces the login of a credential, for example when a
+// token is rotated. Tasks that already pulled their image are not affected.
+func (h *Handler) UpdateCredential(c echo.Context) error {
+	cred, status, err := h.findCredential(c.Param("name"))
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+
+	req := CredentialRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, errors.New(err.Error()))
+	}
+
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	cred.Server = req.Server
+	cred.Username = req.Username
+	if status, err := h.setPassword(&cred, req.Password); err != nil {
+		return c.JSON(status, err.Error())
+	}
+
+	if result := h.DB.Save(&cred); result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error)
+	}
+
+	return c.JSON(http.StatusOK, cred)
+}
+
+// RemoveCredential deletes a credential no scheduled task or service pulls
+// with any more.
+func (h *Handler) RemoveCredential(c echo.Context) error {
+	cred, status, err := h.findCredential(c.Param("name"))
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+
+	users, err := h.credentialUsers(cred.Name)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	if len(users) > 0 {
+		return c.JSON(http.StatusConflict, "Registry credential "+cred.Name+" is used by "+strings.Join(users, ", ")+". Please stop them and try again.")
+	}
+
+	if result := h.DB.Delete(&cred); result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error)
+	}
+
+	return c.JSON(http.StatusOK, cred)
+}
+
+// findCredential looks up a credential, answering with the status to send
+// when there is none.
+func (h *Handler) findCredential(name string) (task.RegistryCredential, int, error) {
+	cred, err := task.FindRegistryCredential(h.DB, name)
+	if errors.Is(err, task.ErrCredentialNotFound) {
+		return cred, http.StatusNotFound, errors.New("No registry credential found with name " + name + ".")
+	}
+
+	if err != nil {
+		return cred, http.StatusInternalServerError, err
+	}
+
+	return cred, http.StatusOK, nil
+}
+
+// setPassword encrypts the password onto the credential, answering with the
+// status to send when it cannot be.
+func (h *Handler) setPassword(cred *task.RegistryCredential, password string) (int, error) {
+	err := cred.SetPassword(h.Key, password)
+	if errors.Is(err, task.ErrNoCredentialKey) {
+		return http.StatusServiceUnavailable, errors.New("Registry credentials cannot be stored until KeyFile under [credentials] is configured.")
+	}
+
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// credentialUsers returns the scheduled tasks and the services that still
+// have to pull an image with the credential.
+func (h *Handler) credentialUsers(name string) ([]string, error) {
+	var tasks []task.Task
+	result := h.DB.Where("registry_credential = ? AND state = ?", name, task.Scheduled.String()).Find(&tasks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var services []task.Service
+	result = h.DB.Where("registry_credential = ?", name).Find(&services)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var users []string
+	for _, t := range tasks {
+		users = append(users, "task "+t.Name)
+	}
+	for _, s := range services {
+		users = append(users, "service "+s.Name)
+	}
+	return users, nil
+}
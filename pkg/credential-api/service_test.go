@@ -0,0 +1,110 @@
+package credentialapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+func TestCredentialApi(t *testing.T) {
+	db := dbtest.Open(t, &task.Task{}, &task.Service{}, &task.RegistryCredential{})
+
+	db.Create(&task.Task{ID: uuid.New(), Name: "api", State: task.Scheduled.String(), RegistryCredential: "in-use"})
+	db.Create(&task.Task{ID: uuid.New(), Name: "web", State: task.Running.String(), RegistryCredential: "gitlab"})
+
+	e := echo.New()
+	NewHandler(db, make([]byte, 32)).InitRoutes(e)
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{name: "create", method: http.MethodPost, body: `{"name":"gitlab","server":"registry.gitlab.com","username":"deploy","password":"s3cret"}`, want: http.StatusCreated},
+		{name: "create existing", method: http.MethodPost, body: `{"name":"gitlab","server":"registry.gitlab.com","username":"deploy","password":"s3cret"}`, want: http.StatusConflict},
+		{name: "create without password", method: http.MethodPost, body: `{"name":"quay","server":"quay.io","username":"robot"}`, want: http.StatusBadRequest},
+		{name: "create invalid name", method: http.MethodPost, body: `{"name":"my/registry","server":"quay.io","username":"robot","password":"x"}`, want: http.StatusBadRequest},
+		{name: "create used one", method: http.MethodPost, body: `{"name":"in-use","server":"ghcr.io","username":"bot","password":"x"}`, want: http.StatusCreated},
+		{name: "inspect", method: http.MethodGet, path: "/gitlab", want: http.StatusOK},
+		{name: "inspect missing", method: http.MethodGet, path: "/nope", want: http.StatusNotFound},
+		{name: "update", method: http.MethodPut, path: "/gitlab", body: `{"server":"registry.gitlab.com","username":"deploy","password":"rotated"}`, want: http.StatusOK},
+		{name: "update missing", method: http.MethodPut, path: "/nope", body: `{"server":"quay.io","username":"robot","password":"x"}`, want: http.StatusNotFound},
+		{name: "remove in use", method: http.MethodDelete, path: "/in-use", want: http.StatusConflict},
+		{name: "remove used by running task", method: http.MethodDelete, path: "/gitlab", want: http.StatusOK},
+		{name: "removed", method: http.MethodGet, path: "/gitlab", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, srv.URL+"/api/v1/credentials"+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d: %s", resp.StatusCode, tt.want, body)
+			}
+			if strings.Contains(string(body), "s3cret") || strings.Contains(string(body), "rotated") {
+				t.Errorf("response leaks the password: %s", body)
+			}
+		})
+	}
+
+	resp, err := http.Get(srv.URL + "/api/v1/credentials")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var creds []task.RegistryCredential
+	if err := json.NewDecoder(resp.Body).Decode(&creds); err != nil {
+		t.Fatalf("failed to decode credentials: %v", err)
+	}
+	if len(creds) != 1 || creds[0].Name != "in-use" || creds[0].Server != "ghcr.io" {
+		t.Errorf("credentials = %+v, want only in-use", creds)
+	}
+
+	var stored task.RegistryCredential
+	db.Take(&stored, "name = ?", "in-use")
+	if !strings.HasPrefix(stored.SealedPassword, "sealed:") {
+		t.Errorf("password stored as %q, want it encrypted", stored.SealedPassword)
+	}
+}
+
+func TestCreateCredentialWithoutKey(t *testing.T) {
+	db := dbtest.Open(t, &task.RegistryCredential{})
+
+	e := echo.New()
+	NewHandler(db, nil).InitRoutes(e)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/credentials", strings.NewReader(`{"name":"gitlab","server":"registry.gitlab.com","username":"deploy","password":"s3cret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusServiceUnavailable, rec.Body)
+	}
+
+	var n int64
+	db.Model(&task.RegistryCredential{}).Count(&n)
+	if n != 0 {
+		t.Errorf("stored %d credentials without a key, want none", n)
+	}
+}
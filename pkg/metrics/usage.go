@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// CpuPercent is the cpu used by the container between the two samples in a
+// stats reading, as a percentage of one core. A container busy on two cores
+// reports 200.
+func CpuPercent(stat types.StatsJSON) float64 {
+	cpuDelta := float64(stat.CPUStats.CPUUsage.TotalUsage) - float64(stat.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stat.CPUStats.SystemUsage) - float64(stat.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	return cpuDelta / systemDelta * float64(OnlineCpus(stat)) * 100
+}
+
+// OnlineCpus is the number of cpus the container could run on when the
+// stats were read.
+func OnlineCpus(stat types.StatsJSON) int {
+	if stat.CPUStats.OnlineCPUs > 0 {
+		return int(stat.CPUStats.OnlineCPUs)
+	}
+	return len(stat.CPUStats.CPUUsage.PercpuUsage)
+}
+
+// MemoryUsed is the container's memory usage without the page cache, the
+// same figure `docker stats` shows.
+func MemoryUsed(stat types.StatsJSON) uint64 {
+	used := stat.MemoryStats.Usage
+
+	// cgroup v2 reports the cache as inactive_file, cgroup v1 as cache.
+	cache, ok := stat.MemoryStats.Stats["inactive_file"]
+	if !ok {
+		cache = stat.MemoryStats.Stats["cache"]
+	}
+
+	if cache > used {
+		return 0
+	}
+	return used - cache
+}
+
+// MemoryPercent is MemoryUsed as a percentage of the container's limit.
+func MemoryPercent(stat types.StatsJSON) float64 {
+	if stat.MemoryStats.Limit == 0 {
+		return 0
+	}
+	return float64(MemoryUsed(stat)) / float64(stat.MemoryStats.Limit) * 100
+}
+
+// NetworkBytes adds up what the container received and sent over all its
+// networks.
+func NetworkBytes(stat types.StatsJSON) (rx uint64, tx uint64) {
+	for _, n := range stat.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	return rx, tx
+}
+
+// BlockIOBytes adds up what the container read from and wrote to block
+// devices.
+func BlockIOBytes(stat types.StatsJSON) (read uint64, write uint64) {
+	for _, e := range stat.BlkioStats.IoServiceBytesRecursive {
+		// cgroup v1 capitalises the operations, cgroup v2 does not.
+		switch strings.ToLower(e.Op) {
+		case "read":
+			read += e.Value
+		case "write":
+			write += e.Value
+		}
+	}
+	return read, write
+}
+
+// Usage is what a container used, computed from a single stats reading.
+// Memory, network and block I/O figures are in bytes, the latter two counted
+// since the container started.
+type Usage struct {
+	CpuPercent      float64   `json:"cpuPercent"`
+	OnlineCpus      int       `json:"onlineCpus"`
+	MemoryUsage     uint64    `json:"memoryUsage"`
+	MemoryLimit     uint64    `json:"memoryLimit"`
+	MemoryPercent   float64   `json:"memoryPercent"`
+	NetworkRxBytes  uint64    `json:"networkRxBytes"`
+	NetworkTxBytes  uint64    `json:"networkTxBytes"`
+	BlockReadBytes  uint64    `json:"blockReadBytes"`
+	BlockWriteBytes uint64    `json:"blockWriteBytes"`
+	ReadAt          time.Time `json:"readAt"`
+}
+
+func NewUsage(stat types.StatsJSON) Usage {
+	rx, tx := NetworkBytes(stat)
+	read, write := BlockIOBytes(stat)
+
+	return Usage{
+		CpuPercent:      CpuPercent(stat),
+		OnlineCpus:      OnlineCpus(stat),
+		MemoryUsage:     MemoryUsed(stat),
+		MemoryLimit:     stat.MemoryStats.Limit,
+		MemoryPercent:   MemoryPercent(stat),
+		NetworkRxBytes:  rx,
+		NetworkTxBytes:  tx,
+		BlockReadBytes:  read,
+		BlockWriteBytes: write,
+		ReadAt:          stat.Read,
+	}
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestNewUsage(t *testing.T) {
+	read := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	var stat types.StatsJSON
+	stat.Read = read
+	stat.PreCPUStats.CPUUsage.TotalUsage = 1_000_000_000
+	stat.PreCPUStats.SystemUsage = 10_000_000_000
+	stat.CPUStats.CPUUsage.TotalUsage = 1_500_000_000
+	stat.CPUStats.SystemUsage = 14_000_000_000
+	stat.CPUStats.OnlineCPUs = 4
+	stat.MemoryStats.Usage = 300 * 1024 * 1024
+	stat.MemoryStats.Limit = 1024 * 1024 * 1024
+	stat.MemoryStats.Stats = map[string]uint64{"inactive_file": 44 * 1024 * 1024}
+	stat.Networks = map[string]types.NetworkStats{
+		"eth0": {RxBytes: 1000, TxBytes: 200},
+		"eth1": {RxBytes: 24, TxBytes: 56},
+	}
+	stat.BlkioStats.IoServiceBytesRecursive = []types.BlkioStatEntry{
+		{Op: "Read", Value: 4096},
+		{Op: "Write", Value: 8192},
+		{Op: "read", Value: 4096},
+		{Op: "Total", Value: 16384},
+	}
+
+	got := NewUsage(stat)
+	want := Usage{
+		CpuPercent:      50,
+		OnlineCpus:      4,
+		MemoryUsage:     256 * 1024 * 1024,
+		MemoryLimit:     1024 * 1024 * 1024,
+		MemoryPercent:   25,
+		NetworkRxBytes:  1024,
+		NetworkTxBytes:  256,
+		BlockReadBytes:  8192,
+		BlockWriteBytes: 8192,
+		ReadAt:          read,
+	}
+	if got != want {
+		t.Errorf("NewUsage() = %+v, want %+v", got, want)
+	}
+}
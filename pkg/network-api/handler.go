@@ -0,0 +1,29 @@
+package networkapi
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"gorm.io/gorm"
+)
+
+// Handler manages the project networks tasks are attached to. Networks joyboy
+// did not create are neither listed nor removed.
+type Handler struct {
+	runtime dkrclient.Runtime
+	DB      *gorm.DB
+}
+
+func NewHandler(rt dkrclient.Runtime, db *gorm.DB) *Handler {
+	return &Handler{
+		runtime: rt,
+		DB:      db,
+	}
+}
+
+func (h *Handler) InitRoutes(e *echo.Echo) {
+	network_route := e.Group("/api/v1/networks")
+	network_route.GET("", h.GetListOfNetworks)
+	network_route.POST("", h.CreateNetwork)
+	network_route.GET("/:name", h.GetSingleNetworkInformation)
+	network_route.DELETE("/:name", h.RemoveNetwork)
+}
@@ -0,0 +1,40 @@
+package networkapi
+
+import (
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+type NetworkRequest struct {
+	Name string `json:"name"`
+	// Internal networks have no route to the outside world.
+	Internal bool `json:"internal"`
+}
+
+type NetworkResponse struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Driver    string            `json:"driver"`
+	Internal  bool              `json:"internal"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Labels    map[string]string `json:"labels"`
+	// Names of the scheduled and running tasks attached to the network.
+	Tasks []string `json:"tasks"`
+}
+
+func NewNetworkResponse(n types.NetworkResource, tasks []string) NetworkResponse {
+	if tasks == nil {
+		tasks = []string{}
+	}
+
+	return NetworkResponse{
+		ID:        n.ID,
+		Name:      n.Name,
+		Driver:    n.Driver,
+		Internal:  n.Internal,
+		CreatedAt: n.Created,
+		Labels:    n.Labels,
+		Tasks:     tasks,
+	}
+}
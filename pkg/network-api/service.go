@@ -0,0 +1,154 @@
+package networkapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+func (h *Handler) GetListOfNetworks(c echo.Context) error {
+	networks, err := h.runtime.ListNetworks(context.Background(), types.NetworkListOptions{
+		Filters: dkrclient.ManagedFilter(),
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, "Failed to list networks. Error is: "+err.Error())
+	}
+
+	tasks, err := h.networkTasks()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Name < networks[j].Name })
+
+	responses := make([]NetworkResponse, 0, len(networks))
+	for _, n := range networks {
+		responses = append(responses, NewNetworkResponse(n, tasks[n.Name]))
+	}
+
+	return c.JSON(http.StatusOK, responses)
+}
+
+// CreateNetwork creates a network ahead of the tasks that join it. Tasks
+// naming a network that does not exist create it themselves, so this is
+// only needed for networks with non default settings.
+func (h *Handler) CreateNetwork(c echo.Context) error {
+	req := NetworkRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, errors.New(err.Error()))
+	}
+
+	if err := task.ValidateNetworkName(req.Name); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	_, err := h.runtime.InspectNetwork(context.Background(), req.Name)
+	if err == nil {
+		return c.JSON(http.StatusConflict, "Network with name: "+req.Name+" already exists.")
+	}
+
+	if !errdefs.IsNotFound(err) {
+		return c.JSON(http.StatusBadGateway, "Failed to inspect network. Error is: "+err.Error())
+	}
+
+	_, err = h.runtime.CreateNetwork(context.Background(), req.Name, types.NetworkCreate{
+		Driver:   "bridge",
+		Internal: req.Internal,
+		Labels:   map[string]string{dkrclient.ManagedLabel: "true"},
+	})
+	if errdefs.IsConflict(err) {
+		return c.JSON(http.StatusConflict, "Network with name: "+req.Name+" already exists.")
+	}
+
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, "Failed to create network. Error is: "+err.Error())
+	}
+
+	n, err := h.runtime.InspectNetwork(context.Background(), req.Name)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, "Failed to inspect network. Error is: "+err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, NewNetworkResponse(n, nil))
+}
+
+func (h *Handler) GetSingleNetworkInformation(c echo.Context) error {
+	n, status, err := h.findNetwork(c.Param("name"))
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+
+	tasks, err := h.networkTasks()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, NewNetworkResponse(n, tasks[n.Name]))
+}
+
+// RemoveNetwork deletes a network no task is attached to any more.
+func (h *Handler) RemoveNetwork(c echo.Context) error {
+	n, status, err := h.findNetwork(c.Param("name"))
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+
+	tasks, err := h.networkTasks()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	if len(tasks[n.Name]) > 0 {
+		return c.JSON(http.StatusConflict, "Network "+n.Name+" is used by tasks "+strings.Join(tasks[n.Name], ", ")+". Please stop them and try again.")
+	}
+
+	err = h.runtime.RemoveNetwork(context.Background(), n.ID)
+	if errdefs.IsForbidden(err) || errdefs.IsConflict(err) {
+		return c.JSON(http.StatusConflict, "Network "+n.Name+" still has containers attached. Error is: "+err.Error())
+	}
+
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, "Failed to remove network. Error is: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, NewNetworkResponse(n, nil))
+}
+
+// findNetwork looks up a network joyboy created, answering with the status
+// to send when there is none.
+func (h *Handler) findNetwork(name string) (types.NetworkResource, int, error) {
+	n, err := h.runtime.InspectNetwork(context.Background(), name)
+	if errdefs.IsNotFound(err) || (err == nil && n.Labels[dkrclient.ManagedLabel] != "true") {
+		return types.NetworkResource{}, http.StatusNotFound, errors.New("No network managed by joyboy found with name " + name + ".")
+	}
+
+	if err != nil {
+		return types.NetworkResource{}, http.StatusBadGateway, err
+	}
+
+	return n, http.StatusOK, nil
+}
+
+// networkTasks maps network names to the scheduled and running tasks on
+// them.
+func (h *Handler) networkTasks() (map[string][]string, error) {
+	var tasks []task.Task
+	result := h.DB.Where("state IN ? AND network <> ''", []string{task.Scheduled.String(), task.Running.String()}).Find(&tasks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	byNetwork := make(map[string][]string)
+	for _, t := range tasks {
+		byNetwork[t.Network] = append(byNetwork[t.Network], t.Name)
+	}
+	return byNetwork, nil
+}
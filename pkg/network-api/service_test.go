@@ -0,0 +1,79 @@
+package networkapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+func TestNetworkApi(t *testing.T) {
+	db := dbtest.Open(t, &task.Task{})
+
+	rt := dkrclient.NewFakeRuntime()
+	rt.CreateNetwork(context.Background(), "shop", types.NetworkCreate{Labels: map[string]string{dkrclient.ManagedLabel: "true"}})
+	rt.CreateNetwork(context.Background(), "someone-elses", types.NetworkCreate{})
+
+	db.Create(&task.Task{ID: uuid.New(), Name: "postgres", State: task.Running.String(), Network: "shop"})
+
+	e := echo.New()
+	NewHandler(rt, db).InitRoutes(e)
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{name: "create", method: http.MethodPost, body: `{"name":"backoffice","internal":true}`, want: http.StatusCreated},
+		{name: "create existing", method: http.MethodPost, body: `{"name":"backoffice"}`, want: http.StatusConflict},
+		{name: "create reserved", method: http.MethodPost, body: `{"name":"host"}`, want: http.StatusBadRequest},
+		{name: "create invalid", method: http.MethodPost, body: `{"name":"-shop"}`, want: http.StatusBadRequest},
+		{name: "inspect", method: http.MethodGet, path: "/shop", want: http.StatusOK},
+		{name: "inspect unmanaged", method: http.MethodGet, path: "/someone-elses", want: http.StatusNotFound},
+		{name: "remove in use", method: http.MethodDelete, path: "/shop", want: http.StatusConflict},
+		{name: "remove unmanaged", method: http.MethodDelete, path: "/someone-elses", want: http.StatusNotFound},
+		{name: "remove", method: http.MethodDelete, path: "/backoffice", want: http.StatusOK},
+		{name: "removed", method: http.MethodGet, path: "/backoffice", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, srv.URL+"/api/v1/networks"+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	resp, err := http.Get(srv.URL + "/api/v1/networks")
+	if err != nil {
+		t.Fatalf("failed to list networks: %v", err)
+	}
+	var networks []NetworkResponse
+	json.NewDecoder(resp.Body).Decode(&networks)
+	resp.Body.Close()
+
+	if len(networks) != 1 || networks[0].Name != "shop" || len(networks[0].Tasks) != 1 || networks[0].Tasks[0] != "postgres" {
+		t.Errorf("networks = %+v, want shop with postgres", networks)
+	}
+}
@@ -1,20 +1,48 @@
 package taskapi
 
 import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types/container"
 	"github.com/labstack/echo/v4"
-	"github.com/shashank-mugiwara/joyboy/worker"
+	"github.com/shashank-mugiwara/joyboy/pkg/metrics"
+	"github.com/shashank-mugiwara/joyboy/scheduler"
+	"github.com/shashank-mugiwara/joyboy/task"
 	"gorm.io/gorm"
 )
 
+// Backend is whatever accepted tasks are handed to. A worker runs them on
+// this machine, a manager forwards them to one of its workers.
+type Backend interface {
+	AddTask(t task.Task) error
+	StopTask(t *task.Task) task.DockerResult
+}
+
+// LogStreamer is implemented by backends that can read the logs of the tasks
+// they run. The logs come multiplexed the way Docker sends them, and are read
+// until ctx is cancelled when following them.
+type LogStreamer interface {
+	TaskLogs(ctx context.Context, t task.Task, options container.LogsOptions) (io.ReadCloser, error)
+}
+
+// UsageReader is implemented by backends that can read what the tasks they
+// run are using.
+type UsageReader interface {
+	TaskUsage(ctx context.Context, t task.Task) (metrics.Usage, error)
+}
+
 type Handler struct {
-	worker worker.Worker
-	DB     *gorm.DB
+	backend  Backend
+	services *scheduler.ServiceReconciler
+	DB       *gorm.DB
 }
 
-func NewHandler(w worker.Worker, db *gorm.DB) *Handler {
+func NewHandler(b Backend, services *scheduler.ServiceReconciler, db *gorm.DB) *Handler {
 	return &Handler{
-		worker: w,
-		DB:     db,
+		backend:  b,
+		services: services,
+		DB:       db,
 	}
 }
 
@@ -24,4 +52,16 @@ func (h *Handler) InitRoutes(e *echo.Echo) {
 	task_route.POST("/add", h.StartTask)
 	task_route.POST("/stop", h.StopTask)
 	task_route.GET("/:id", h.GetSingleTaskInformation)
+	task_route.GET("/:id/events", h.GetTaskEvents)
+	task_route.GET("/:id/logs", h.GetTaskLogs)
+	task_route.GET("/:id/metrics", h.GetTaskMetrics)
+
+	metrics_route := e.Group("/api/v1/metrics")
+	metrics_route.GET("", h.GetMetricsSummary)
+
+	service_route := e.Group("/api/v1/service")
+	service_route.GET("/services", h.GetListOfServices)
+	service_route.GET("/:id", h.GetSingleServiceInformation)
+	service_route.GET("/:id/events", h.GetServiceEvents)
+	service_route.DELETE("/:id", h.StopService)
 }
@@ -0,0 +1,110 @@
+package taskapi
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+// GetTaskLogs streams the logs of a running task as plain text, or as server
+// sent events with an event per line when the client accepts
+// text/event-stream. See task.ParseLogsOptions for the query parameters.
+func (h *Handler) GetTaskLogs(c echo.Context) error {
+	streamer, ok := h.backend.(LogStreamer)
+	if !ok {
+		return c.JSON(http.StatusNotImplemented, "Logs are not available on this node.")
+	}
+
+	taskUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "Failed to parse UUID")
+	}
+
+	var t task.Task
+	result := h.DB.Where(&task.Task{ID: taskUUID}).Find(&t)
+	if result.Error != nil {
+		return c.JSON(http.StatusBadRequest, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, "No task found for the given taskId.")
+	}
+
+	if t.ContainerID == "" {
+		return c.JSON(http.StatusConflict, "Task "+t.Name+" is "+t.State+" and has no container to read logs from.")
+	}
+
+	options, err := task.ParseLogsOptions(c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	logs, err := streamer.TaskLogs(ctx, t, options)
+	if errdefs.IsNotFound(err) {
+		return c.JSON(http.StatusNotFound, "The container of task "+t.Name+" is gone. Error is: "+err.Error())
+	}
+
+	if errdefs.IsConflict(err) {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, "Failed to read logs. Error is: "+err.Error())
+	}
+	defer logs.Close()
+
+	sse := strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream")
+
+	resp := c.Response()
+	if sse {
+		resp.Header().Set(echo.HeaderContentType, "text/event-stream")
+		resp.Header().Set("Cache-Control", "no-cache")
+	} else {
+		resp.Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+	}
+	resp.WriteHeader(http.StatusOK)
+	resp.Flush()
+
+	stdout := &logWriter{resp: resp, event: "stdout", sse: sse}
+	stderr := &logWriter{resp: resp, event: "stderr", sse: sse}
+	if _, err := stdcopy.StdCopy(stdout, stderr, logs); err != nil && ctx.Err() == nil {
+		log.Printf("Failed to stream logs of task %v: %v\n", t.ID, err)
+	}
+
+	return nil
+}
+
+// logWriter writes one of a container's streams to the response, flushing
+// it after every write so followed logs show up as they come.
+type logWriter struct {
+	resp  *echo.Response
+	event string
+	sse   bool
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	if !w.sse {
+		if _, err := w.resp.Write(p); err != nil {
+			return 0, err
+		}
+		w.resp.Flush()
+		return len(p), nil
+	}
+
+	for _, line := range bytes.Split(bytes.TrimSuffix(p, []byte("\n")), []byte("\n")) {
+		if _, err := fmt.Fprintf(w.resp, "event: %s\ndata: %s\n\n", w.event, bytes.TrimSuffix(line, []byte("\r"))); err != nil {
+			return 0, err
+		}
+	}
+	w.resp.Flush()
+	return len(p), nil
+}
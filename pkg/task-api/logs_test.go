@@ -0,0 +1,79 @@
+package taskapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/worker"
+)
+
+func TestGetTaskLogs(t *testing.T) {
+	db := dbtest.Open(t, &task.Task{})
+
+	rt := dkrclient.NewFakeRuntime()
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c1", Name: "web", Running: true, Stdout: "GET /\nGET /health\n", Stderr: "slow request\n"})
+
+	running := task.Task{ID: uuid.New(), Name: "web", State: task.Running.String(), ContainerID: "c1"}
+	scheduled := task.Task{ID: uuid.New(), Name: "api", State: task.Scheduled.String()}
+	gone := task.Task{ID: uuid.New(), Name: "db", State: task.Running.String(), ContainerID: "c2"}
+	db.Create(&running)
+	db.Create(&scheduled)
+	db.Create(&gone)
+
+	e := echo.New()
+	NewHandler(&worker.Worker{DB: db, Runtime: rt}, nil, db).InitRoutes(e)
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name     string
+		id       string
+		query    string
+		sse      bool
+		want     int
+		wantBody string
+	}{
+		{name: "both streams", id: running.ID.String(), want: http.StatusOK, wantBody: "GET /\nGET /health\nslow request\n"},
+		{name: "stdout only", id: running.ID.String(), query: "?stderr=false", want: http.StatusOK, wantBody: "GET /\nGET /health\n"},
+		{
+			name:     "server sent events",
+			id:       running.ID.String(),
+			sse:      true,
+			want:     http.StatusOK,
+			wantBody: "event: stdout\ndata: GET /\n\nevent: stdout\ndata: GET /health\n\nevent: stderr\ndata: slow request\n\n",
+		},
+		{name: "bad options", id: running.ID.String(), query: "?tail=lots", want: http.StatusBadRequest},
+		{name: "not started", id: scheduled.ID.String(), want: http.StatusConflict},
+		{name: "container gone", id: gone.ID.String(), want: http.StatusNotFound},
+		{name: "unknown task", id: uuid.NewString(), want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/task/"+tt.id+"/logs"+tt.query, nil)
+			if tt.sse {
+				req.Header.Set("Accept", "text/event-stream")
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.want, body)
+			}
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
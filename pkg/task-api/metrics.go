@@ -0,0 +1,119 @@
+package taskapi
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/docker/docker/errdefs"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+// GetTaskMetrics reads what a running task's container is using right now.
+func (h *Handler) GetTaskMetrics(c echo.Context) error {
+	reader, ok := h.backend.(UsageReader)
+	if !ok {
+		return c.JSON(http.StatusNotImplemented, "Metrics are not available on this node.")
+	}
+
+	taskUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "Failed to parse UUID")
+	}
+
+	var t task.Task
+	result := h.DB.Where(&task.Task{ID: taskUUID}).Find(&t)
+	if result.Error != nil {
+		return c.JSON(http.StatusBadRequest, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, "No task found for the given taskId.")
+	}
+
+	if t.State != task.Running.String() || t.ContainerID == "" {
+		return c.JSON(http.StatusConflict, "Task "+t.Name+" is "+t.State+" and has no running container to read metrics from.")
+	}
+
+	usage, err := reader.TaskUsage(c.Request().Context(), t)
+	if errdefs.IsNotFound(err) {
+		return c.JSON(http.StatusNotFound, "The container of task "+t.Name+" is gone. Error is: "+err.Error())
+	}
+
+	if errdefs.IsConflict(err) {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, "Failed to read metrics. Error is: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, TaskMetrics{
+		TaskID:      t.ID.String(),
+		TaskName:    t.Name,
+		ContainerId: t.ContainerID,
+		Usage:       usage,
+	})
+}
+
+// GetMetricsSummary reads the usage of every running task and adds it up.
+// Tasks whose usage cannot be read are listed rather than failing the whole
+// summary.
+func (h *Handler) GetMetricsSummary(c echo.Context) error {
+	reader, ok := h.backend.(UsageReader)
+	if !ok {
+		return c.JSON(http.StatusNotImplemented, "Metrics are not available on this node.")
+	}
+
+	var tasks []task.Task
+	result := h.DB.Where("state = ? AND container_id <> ''", task.Running.String()).Find(&tasks)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error)
+	}
+
+	summary := MetricsSummary{
+		RunningTasks: len(tasks),
+		Tasks:        []TaskMetrics{},
+		Unavailable:  []string{},
+	}
+
+	// Docker takes a moment to sample a container's cpu, so the tasks are
+	// read all at once.
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		wg.Add(1)
+		go func(t task.Task) {
+			defer wg.Done()
+
+			usage, err := reader.TaskUsage(c.Request().Context(), t)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				if c.Request().Context().Err() == nil {
+					log.Printf("Failed to read metrics of task %v: %v\n", t.Name, err)
+				}
+				summary.Unavailable = append(summary.Unavailable, t.Name)
+				return
+			}
+
+			summary.add(TaskMetrics{
+				TaskID:      t.ID.String(),
+				TaskName:    t.Name,
+				ContainerId: t.ContainerID,
+				Usage:       usage,
+			})
+		}(t)
+	}
+	wg.Wait()
+
+	sort.Slice(summary.Tasks, func(i, j int) bool { return summary.Tasks[i].TaskName < summary.Tasks[j].TaskName })
+	sort.Strings(summary.Unavailable)
+
+	return c.JSON(http.StatusOK, summary)
+}
@@ -0,0 +1,106 @@
+package taskapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/worker"
+)
+
+func fakeStats(cpuNanos uint64, memory uint64, rx uint64) types.StatsJSON {
+	var stat types.StatsJSON
+	stat.CPUStats.CPUUsage.TotalUsage = cpuNanos
+	stat.CPUStats.SystemUsage = 1e9
+	stat.CPUStats.OnlineCPUs = 2
+	stat.MemoryStats.Usage = memory
+	stat.MemoryStats.Limit = 4 * memory
+	stat.Networks = map[string]types.NetworkStats{"eth0": {RxBytes: rx}}
+	return stat
+}
+
+func TestTaskMetrics(t *testing.T) {
+	db := dbtest.Open(t, &task.Task{})
+
+	rt := dkrclient.NewFakeRuntime()
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c1", Name: "web", Running: true, Stats: fakeStats(250e6, 100, 10)})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c2", Name: "api", Running: true, Stats: fakeStats(500e6, 300, 5)})
+
+	web := task.Task{ID: uuid.New(), Name: "web", State: task.Running.String(), ContainerID: "c1"}
+	api := task.Task{ID: uuid.New(), Name: "api", State: task.Running.String(), ContainerID: "c2"}
+	gone := task.Task{ID: uuid.New(), Name: "db", State: task.Running.String(), ContainerID: "c3"}
+	scheduled := task.Task{ID: uuid.New(), Name: "worker", State: task.Scheduled.String()}
+	for _, tk := range []*task.Task{&web, &api, &gone, &scheduled} {
+		db.Create(tk)
+	}
+
+	e := echo.New()
+	NewHandler(&worker.Worker{DB: db, Runtime: rt}, nil, db).InitRoutes(e)
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name string
+		id   string
+		want int
+	}{
+		{name: "running", id: web.ID.String(), want: http.StatusOK},
+		{name: "not started", id: scheduled.ID.String(), want: http.StatusConflict},
+		{name: "container gone", id: gone.ID.String(), want: http.StatusNotFound},
+		{name: "unknown task", id: uuid.NewString(), want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/api/v1/task/" + tt.id + "/metrics")
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var m TaskMetrics
+			if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+				t.Fatalf("failed to decode metrics: %v", err)
+			}
+			if m.TaskName != "web" || m.Usage.CpuPercent != 50 || m.Usage.MemoryUsage != 100 || m.Usage.NetworkRxBytes != 10 {
+				t.Errorf("metrics = %+v", m)
+			}
+		})
+	}
+
+	resp, err := http.Get(srv.URL + "/api/v1/metrics")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var summary MetricsSummary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+
+	if summary.RunningTasks != 3 || summary.CpuPercent != 150 || summary.MemoryUsage != 400 || summary.MemoryLimit != 1600 || summary.NetworkRxBytes != 15 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if len(summary.Tasks) != 2 || summary.Tasks[0].TaskName != "api" || summary.Tasks[1].TaskName != "web" {
+		t.Errorf("summary tasks = %+v, want api and web", summary.Tasks)
+	}
+	if !reflect.DeepEqual(summary.Unavailable, []string{"db"}) {
+		t.Errorf("unavailable = %v, want [db]", summary.Unavailable)
+	}
+}
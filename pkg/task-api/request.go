@@ -1,6 +1,17 @@
 package taskapi
 
-import "github.com/docker/docker/api/types"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shashank-mugiwara/joyboy/pkg/metrics"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/utils"
+)
 
 type TaskRequest struct {
 	Name        string            `json:"name"`
@@ -9,6 +20,59 @@ type TaskRequest struct {
 	PortMapping map[string]string `json:"portMapping"`
 	Resources   Resources         `json:"resources"`
 	ScaleConfig ScaleConfig       `json:"scaleConfig"`
+	Command     []string          `json:"command"`
+	Entrypoint  []string          `json:"entrypoint"`
+	Env         EnvVars           `json:"env"`
+	WorkingDir  string            `json:"workingDir"`
+	User        string            `json:"user"`
+	// One of no, always, unless-stopped or on-failure:N.
+	RestartPolicy string       `json:"restartPolicy"`
+	Mounts        []task.Mount `json:"mounts"`
+	// The project network the task joins, created when missing. Tasks on
+	// the same network reach each other by task name.
+	Network string `json:"network"`
+	// One of Always, IfNotPresent or Never, empty means Always.
+	PullPolicy string `json:"pullPolicy"`
+	// Name of the registry credential to pull a private image with.
+	RegistryCredential string `json:"registryCredential"`
+	// How the task's health is checked, see task.HealthCheck.
+	HealthCheck *task.HealthCheck `json:"healthCheck"`
+}
+
+// EnvVars holds environment variables as KEY=value strings. They can be
+// given either as a list of such strings or as an object of names to
+// values.
+type EnvVars []string
+
+func (e *EnvVars) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, v := range list {
+			if strings.HasPrefix(v, "=") || utils.IsBlank(v) {
+				return fmt.Errorf("invalid environment variable %q", v)
+			}
+		}
+		*e = list
+		return nil
+	}
+
+	var vars map[string]string
+	if err := json.Unmarshal(data, &vars); err != nil {
+		return errors.New("env must be a list of KEY=value strings or an object of names to values")
+	}
+
+	list = make([]string, 0, len(vars))
+	for name, value := range vars {
+		if utils.IsBlank(name) || strings.Contains(name, "=") {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+		list = append(list, name+"="+value)
+	}
+	// Map order is random, keep the task's env stable.
+	sort.Strings(list)
+
+	*e = list
+	return nil
 }
 
 type TaskResponse struct {
@@ -16,11 +80,28 @@ type TaskResponse struct {
 	Name  string `json:"name"`
 	Image string `json:"image"`
 	State string `json:"state"`
+	// Includes the host ports handed out for ports the request left empty.
+	PortBindings task.PortBindings `json:"portBindings,omitempty"`
 }
 
+type ServiceResponse struct {
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	Image           string         `json:"image"`
+	MinTaskScale    int            `json:"minTaskScale"`
+	MaxTaskScale    int            `json:"maxTaskScale"`
+	Replicas        int            `json:"replicas"`
+	ScalingStrategy string         `json:"scalingStrategy"`
+	LastScaledAt    time.Time      `json:"lastScaledAt"`
+	Tasks           []TaskResponse `json:"tasks"`
+}
+
+// Resources limits what a task may use. Memory and disk are in MiB, cpus in
+// cores.
 type Resources struct {
 	Memory int64   `json:"memory"`
 	Cpus   float32 `json:"cpus"`
+	Disk   int64   `json:"disk"`
 }
 
 type ScaleConfig struct {
@@ -28,10 +109,43 @@ type ScaleConfig struct {
 	MinTaskScale    int    `json:"minTaskScale"`
 	MaxTaskScale    int    `json:"maxTaskScale"`
 	ScalingStrategy string `json:"scalingStrategy"`
+	// Only used by the dynamic scaling strategy.
+	TargetCpuUtilization     float64 `json:"targetCpuUtilization"`
+	TargetMemoryUtilization  float64 `json:"targetMemoryUtilization"`
+	ScaleUpCooldownSeconds   int     `json:"scaleUpCooldownSeconds"`
+	ScaleDownCooldownSeconds int     `json:"scaleDownCooldownSeconds"`
 }
 
 type TaskMetrics struct {
-	ContainerId string          `json:"containerId"`
-	TaskName    string          `json:"taskName"`
-	Stats       types.StatsJSON `json:"stats"`
+	TaskID      string        `json:"taskId"`
+	TaskName    string        `json:"taskName"`
+	ContainerId string        `json:"containerId"`
+	Usage       metrics.Usage `json:"usage"`
+}
+
+// MetricsSummary adds up the usage of all running tasks. Memory, network and
+// block I/O figures are in bytes, cpuPercent is in percent of one core.
+type MetricsSummary struct {
+	RunningTasks    int           `json:"runningTasks"`
+	CpuPercent      float64       `json:"cpuPercent"`
+	MemoryUsage     uint64        `json:"memoryUsage"`
+	MemoryLimit     uint64        `json:"memoryLimit"`
+	NetworkRxBytes  uint64        `json:"networkRxBytes"`
+	NetworkTxBytes  uint64        `json:"networkTxBytes"`
+	BlockReadBytes  uint64        `json:"blockReadBytes"`
+	BlockWriteBytes uint64        `json:"blockWriteBytes"`
+	Tasks           []TaskMetrics `json:"tasks"`
+	// Names of the running tasks whose usage could not be read.
+	Unavailable []string `json:"unavailable"`
+}
+
+func (s *MetricsSummary) add(m TaskMetrics) {
+	s.CpuPercent += m.Usage.CpuPercent
+	s.MemoryUsage += m.Usage.MemoryUsage
+	s.MemoryLimit += m.Usage.MemoryLimit
+	s.NetworkRxBytes += m.Usage.NetworkRxBytes
+	s.NetworkTxBytes += m.Usage.NetworkTxBytes
+	s.BlockReadBytes += m.Usage.BlockReadBytes
+	s.BlockWriteBytes += m.Usage.BlockWriteBytes
+	s.Tasks = append(s.Tasks, m)
 }
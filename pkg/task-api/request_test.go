@@ -0,0 +1,39 @@
+package taskapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEnvVarsUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    EnvVars
+		wantErr bool
+	}{
+		{name: "list", json: `["B=2","A=1"]`, want: EnvVars{"B=2", "A=1"}},
+		{name: "map sorted by name", json: `{"B":"2","A":"1=x"}`, want: EnvVars{"A=1=x", "B=2"}},
+		{name: "empty value", json: `{"A":""}`, want: EnvVars{"A="}},
+		{name: "null", json: `null`, want: nil},
+		{name: "blank list entry", json: `[""]`, wantErr: true},
+		{name: "list entry without name", json: `["=1"]`, wantErr: true},
+		{name: "blank name", json: `{"":"1"}`, wantErr: true},
+		{name: "name with equals", json: `{"A=B":"1"}`, wantErr: true},
+		{name: "not a list or map", json: `"A=1"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got EnvVars
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
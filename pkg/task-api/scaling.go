@@ -0,0 +1,222 @@
+package taskapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/portalloc"
+	"github.com/shashank-mugiwara/joyboy/strategy"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"gorm.io/gorm"
+)
+
+func (s ScaleConfig) IsSet() bool {
+	return s.MinTaskScale != 0 || s.MaxTaskScale != 0 || s.ScalingStrategy != ""
+}
+
+// startService creates a service for a task request that came with a scale
+// config, and starts its first replicas.
+func (h *Handler) startService(c echo.Context, req TaskRequest) error {
+	if h.services == nil {
+		return c.JSON(http.StatusBadRequest, "Scaling is not available on this joyboy instance.")
+	}
+
+	scale := req.ScaleConfig
+	if scale.MinTaskScale < 1 {
+		return c.JSON(http.StatusBadRequest, "scaleConfig.minTaskScale must be at least 1")
+	}
+
+	if scale.MaxTaskScale == 0 {
+		scale.MaxTaskScale = scale.MinTaskScale
+	}
+
+	if scale.MaxTaskScale < scale.MinTaskScale {
+		return c.JSON(http.StatusBadRequest, "scaleConfig.maxTaskScale cannot be lower than scaleConfig.minTaskScale")
+	}
+
+	if _, err := strategy.GetScalingStrategy(scale.ScalingStrategy, nil); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	if scale.TargetCpuUtilization < 0 || scale.TargetMemoryUtilization < 0 || scale.ScaleUpCooldownSeconds < 0 || scale.ScaleDownCooldownSeconds < 0 {
+		return c.JSON(http.StatusBadRequest, "scaleConfig targets and cooldowns cannot be negative")
+	}
+
+	if scale.ScalingStrategy == "dynamic" && scale.TargetCpuUtilization == 0 && scale.TargetMemoryUtilization == 0 {
+		return c.JSON(http.StatusBadRequest, "Dynamic scaling needs scaleConfig.targetCpuUtilization or scaleConfig.targetMemoryUtilization")
+	}
+
+	var existingService task.Service
+	result := h.DB.Where(&task.Service{Name: req.Name}).Take(&existingService)
+	if result.Error == nil {
+		return c.JSON(http.StatusBadRequest, "Service with name: "+req.Name+" already exists. Please remove the service and try again.")
+	}
+
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		c.Logger().Info("Failed to fetch entries from db. Error is: ", result.Error.Error())
+		return c.JSON(http.StatusBadRequest, result.Error)
+	}
+
+	portBindings, err := task.ParsePortMapping(req.PortMapping)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid portMapping. Error is: "+err.Error())
+	}
+
+	// Every replica must get valid and free host ports before anything is
+	// started.
+	reserver, canReserve := h.backend.(portalloc.Reserver)
+	for i := 0; i < scale.MaxTaskScale; i++ {
+		replicaBindings, err := portBindings.ForReplica(i)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "Failed to assign host ports to replicas. Error is: "+err.Error())
+		}
+
+		if canReserve {
+			if err := reserver.CheckPorts(replicaBindings); err != nil {
+				return c.JSON(http.StatusConflict, "Failed to assign host ports to replica "+task.ReplicaName(req.Name, i)+". Error is: "+err.Error())
+			}
+		}
+	}
+
+	svc := task.Service{
+		ID:              uuid.New(),
+		Name:            req.Name,
+		Image:           req.Image,
+		Memory:          req.Resources.Memory,
+		Cpus:            req.Resources.Cpus,
+		Disk:            req.Resources.Disk,
+		RestartPolicy:   req.RestartPolicy,
+		PortBindings:    portBindings,
+		MinTaskScale:    scale.MinTaskScale,
+		MaxTaskScale:    scale.MaxTaskScale,
+		ScalingStrategy: scale.ScalingStrategy,
+
+		TargetCpuUtilization:    scale.TargetCpuUtilization,
+		TargetMemoryUtilization: scale.TargetMemoryUtilization,
+		ScaleUpCooldown:         scale.ScaleUpCooldownSeconds,
+		ScaleDownCooldown:       scale.ScaleDownCooldownSeconds,
+
+		Command:            req.Command,
+		Entrypoint:         req.Entrypoint,
+		Env:                req.Env,
+		WorkingDir:         req.WorkingDir,
+		User:               req.User,
+		Mounts:             req.Mounts,
+		Network:            req.Network,
+		PullPolicy:         req.PullPolicy,
+		RegistryCredential: req.RegistryCredential,
+		HealthCheck:        req.HealthCheck,
+	}
+
+	if _, err := h.services.CreateService(&svc); err != nil {
+		c.Logger().Info("Failed to create service. Error is: ", err.Error())
+		if errors.Is(err, portalloc.ErrPortConflict) {
+			return c.JSON(http.StatusConflict, "Failed to create service. Error is: "+err.Error())
+		}
+		return c.JSON(http.StatusBadRequest, "Failed to create service. Error is: "+err.Error())
+	}
+
+	c.Logger().Info("Service successfully created.")
+	return c.JSON(http.StatusAccepted, h.newServiceResponse(svc))
+}
+
+func (h *Handler) GetListOfServices(c echo.Context) error {
+	var services []task.Service
+	if result := h.DB.Find(&services); result.Error != nil {
+		return c.JSON(http.StatusBadRequest, result.Error)
+	}
+
+	responses := make([]ServiceResponse, 0, len(services))
+	for _, svc := range services {
+		responses = append(responses, h.newServiceResponse(svc))
+	}
+
+	return c.JSON(http.StatusOK, responses)
+}
+
+func (h *Handler) GetSingleServiceInformation(c echo.Context) error {
+	serviceUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "Failed to parse UUID")
+	}
+
+	var svc task.Service
+	result := h.DB.Where(&task.Service{ID: serviceUUID}).Find(&svc)
+	if result.Error != nil {
+		return c.JSON(http.StatusBadRequest, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusBadRequest, "No service found for the given serviceId.")
+	}
+
+	return c.JSON(http.StatusOK, h.newServiceResponse(svc))
+}
+
+// GetServiceEvents lists the changes of the service's replica count, oldest
+// first.
+func (h *Handler) GetServiceEvents(c echo.Context) error {
+	serviceUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "Failed to parse UUID")
+	}
+
+	var events []task.ScalingEvent
+	result := h.DB.Where(&task.ScalingEvent{ServiceID: serviceUUID}).Order("timestamp").Find(&events)
+	if result.Error != nil {
+		return c.JSON(http.StatusBadRequest, result.Error)
+	}
+
+	return c.JSON(http.StatusOK, events)
+}
+
+func (h *Handler) StopService(c echo.Context) error {
+	if h.services == nil {
+		return c.JSON(http.StatusBadRequest, "Scaling is not available on this joyboy instance.")
+	}
+
+	serviceUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "Failed to parse UUID")
+	}
+
+	results, err := h.services.DeleteService(serviceUUID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusBadRequest, "No service found for the given serviceId.")
+	}
+
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "Failed to remove service. Error is: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+func (h *Handler) newServiceResponse(svc task.Service) ServiceResponse {
+	var replicas []task.Task
+	h.DB.Where("service_id = ? AND state IN ?", svc.ID, []string{task.Scheduled.String(), task.Running.String()}).Order("replica").Find(&replicas)
+
+	tasks := make([]TaskResponse, 0, len(replicas))
+	for _, t := range replicas {
+		tasks = append(tasks, TaskResponse{
+			ID:    t.ID.String(),
+			Name:  t.Name,
+			Image: t.Image,
+			State: t.State,
+		})
+	}
+
+	return ServiceResponse{
+		ID:              svc.ID.String(),
+		Name:            svc.Name,
+		Image:           svc.Image,
+		MinTaskScale:    svc.MinTaskScale,
+		MaxTaskScale:    svc.MaxTaskScale,
+		Replicas:        svc.Replicas,
+		ScalingStrategy: svc.ScalingStrategy,
+		LastScaledAt:    svc.LastScaledAt,
+		Tasks:           tasks,
+	}
+}
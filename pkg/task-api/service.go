@@ -1,12 +1,13 @@
 package taskapi
 
 import (
-	"encoding/json"
 	"errors"
 	"net/http"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/config"
+	"github.com/shashank-mugiwara/joyboy/portalloc"
 	"github.com/shashank-mugiwara/joyboy/task"
 	"github.com/shashank-mugiwara/joyboy/utils"
 	"gorm.io/gorm"
@@ -26,8 +27,16 @@ func (h *Handler) StartTask(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, errors.New("name field is mandatory"))
 	}
 
+	if err := validateRunConfig(req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	if req.ScaleConfig.IsSet() {
+		return h.startService(c, req)
+	}
+
 	var existingTask task.Task
-	result := h.DB.Where(&task.Task{Name: req.Name, State: "Scheduled"}).Take(&existingTask)
+	result := h.DB.Where(&task.Task{Name: req.Name, State: task.Scheduled.String()}).Take(&existingTask)
 
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		result.Error = nil
@@ -42,7 +51,7 @@ func (h *Handler) StartTask(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, "Container with name: "+req.Name+" is already Scheduled to run. Please wait for the container to start or remove the scheduled container and try again.")
 	}
 
-	result = h.DB.Where(&task.Task{Name: req.Name, State: "Running"}).Take(&existingTask)
+	result = h.DB.Where(&task.Task{Name: req.Name, State: task.Running.String()}).Take(&existingTask)
 
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		result.Error = nil
@@ -57,39 +66,129 @@ func (h *Handler) StartTask(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, "Container with name: "+req.Name+" is already running. Please stop this container and try again")
 	}
 
-	port_mapping_string, err := json.Marshal(req.PortMapping)
+	taskId := uuid.New()
+	if !utils.IsBlank(req.ID) {
+		parsedId, err := uuid.Parse(req.ID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "given uuid of task is improper")
+		}
+		taskId = parsedId
+	}
+
+	portBindings, err := task.ParsePortMapping(req.PortMapping)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, "Failed to marshall portMapping. Error is: "+err.Error())
+		return c.JSON(http.StatusBadRequest, "Invalid portMapping. Error is: "+err.Error())
 	}
 
 	newTask := task.Task{
-		Image:        req.Image,
-		Name:         req.Name,
-		ID:           uuid.New(),
-		State:        task.Scheduled.String(),
-		PortBindings: string(port_mapping_string),
-		Memory:       req.Resources.Memory,
-		Cpus:         req.Resources.Cpus,
+		Image:              req.Image,
+		Name:               req.Name,
+		ID:                 taskId,
+		State:              task.Scheduled.String(),
+		PortBindings:       portBindings,
+		Memory:             req.Resources.Memory,
+		Cpus:               req.Resources.Cpus,
+		Disk:               req.Resources.Disk,
+		RestartPolicy:      req.RestartPolicy,
+		Command:            req.Command,
+		Entrypoint:         req.Entrypoint,
+		Env:                req.Env,
+		WorkingDir:         req.WorkingDir,
+		User:               req.User,
+		Mounts:             req.Mounts,
+		Network:            req.Network,
+		PullPolicy:         req.PullPolicy,
+		RegistryCredential: req.RegistryCredential,
+		HealthCheck:        req.HealthCheck,
 	}
 
-	result = h.DB.Save(newTask)
-	if result.Error != nil {
-		c.Logger().Info("Failed to save entried to db. Error is: ", result.Error.Error())
-		return c.JSON(http.StatusBadRequest, result.Error)
+	save := func() error { return h.DB.Save(&newTask).Error }
+	if admitter, ok := h.backend.(task.Admitter); ok {
+		err = admitter.Admit(&newTask, save)
+	} else if reserver, ok := h.backend.(portalloc.Reserver); ok {
+		err = reserver.ReservePorts(&newTask, save)
+	} else {
+		err = save()
+	}
+
+	if errors.Is(err, portalloc.ErrPortConflict) {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+
+	if errors.Is(err, task.ErrNoCapacity) {
+		return c.JSON(http.StatusUnprocessableEntity, "Not enough resources to run the task. "+err.Error())
+	}
+
+	if err != nil {
+		c.Logger().Info("Failed to save entried to db. Error is: ", err.Error())
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	if err := task.RecordEvent(h.DB, newTask.ID, "", newTask.State, "task submitted"); err != nil {
+		c.Logger().Info("Failed to record task event. Error is: ", err.Error())
+	}
+
+	if err := h.backend.AddTask(newTask); err != nil {
+		c.Logger().Info("Failed to queue task. Error is: ", err.Error())
+		return c.JSON(http.StatusInternalServerError, "Failed to queue task. Error is: "+err.Error())
 	}
 
-	h.worker.AddTask(newTask)
 	c.Logger().Info("Task successfully submitted to queue.")
 
 	taskResponse := TaskResponse{
-		Image: newTask.Image,
-		Name:  newTask.Name,
-		ID:    newTask.ID.String(),
-		State: newTask.State,
+		Image:        newTask.Image,
+		Name:         newTask.Name,
+		ID:           newTask.ID.String(),
+		State:        newTask.State,
+		PortBindings: newTask.PortBindings,
 	}
 	return c.JSON(http.StatusAccepted, taskResponse)
 }
 
+// validateRunConfig checks the parts of a task request that are only looked
+// at by Docker, so a bad request fails here rather than on the worker.
+func validateRunConfig(req TaskRequest) error {
+	if req.Resources.Memory < 0 || req.Resources.Cpus < 0 || req.Resources.Disk < 0 {
+		return errors.New("resources cannot be negative")
+	}
+
+	if _, err := task.ParseRestartPolicy(req.RestartPolicy); err != nil {
+		return err
+	}
+
+	if err := task.ValidateMounts(req.Mounts, config.VolumeSetting.AllowedHostPaths); err != nil {
+		return err
+	}
+
+	if !utils.IsBlank(req.Network) {
+		if err := task.ValidateNetworkName(req.Network); err != nil {
+			return err
+		}
+	}
+
+	if err := task.ValidatePullPolicy(req.PullPolicy); err != nil {
+		return err
+	}
+
+	if !utils.IsBlank(req.RegistryCredential) {
+		if err := task.ValidateCredentialName(req.RegistryCredential); err != nil {
+			return err
+		}
+	}
+
+	if req.HealthCheck != nil {
+		bindings, err := task.ParsePortMapping(req.PortMapping)
+		if err != nil {
+			return err
+		}
+		if err := req.HealthCheck.Validate(bindings); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (h *Handler) StopTask(c echo.Context) error {
 	req := TaskRequest{}
 	if err := c.Bind(&req); err != nil {
@@ -109,7 +208,7 @@ func (h *Handler) StopTask(c echo.Context) error {
 		ID: task_id,
 	}
 
-	result := h.worker.StopTask(&newTask)
+	result := h.backend.StopTask(&newTask)
 
 	if result.Error != nil && !utils.IsBlank(result.Error.Error()) {
 		return c.JSON(http.StatusBadRequest, result)
@@ -121,7 +220,7 @@ func (h *Handler) StopTask(c echo.Context) error {
 func (h *Handler) GetListOfRunningTasks(c echo.Context) error {
 	state := c.QueryParam("state")
 	if utils.IsBlank(state) {
-		state = "Running"
+		state = task.Running.String()
 	}
 
 	_, ok := task.KnownContainerStateMap[state]
@@ -152,3 +251,24 @@ func (h *Handler) GetSingleTaskInformation(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, runningTask)
 }
+
+// GetTaskEvents returns the state changes of a task, oldest first. The
+// history outlives the task, so stopped and failed tasks can still be
+// looked up.
+func (h *Handler) GetTaskEvents(c echo.Context) error {
+	taskUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "Failed to parse UUID")
+	}
+
+	events, err := task.GetTaskEvents(h.DB, taskUUID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	if len(events) == 0 {
+		return c.JSON(http.StatusNotFound, "No events found for the given taskId.")
+	}
+
+	return c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,28 @@
+package volumeapi
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"gorm.io/gorm"
+)
+
+// Handler serves the volumes joyboy created for its tasks. Volumes it did
+// not create are neither listed nor removed.
+type Handler struct {
+	runtime dkrclient.Runtime
+	DB      *gorm.DB
+}
+
+func NewHandler(rt dkrclient.Runtime, db *gorm.DB) *Handler {
+	return &Handler{
+		runtime: rt,
+		DB:      db,
+	}
+}
+
+func (h *Handler) InitRoutes(e *echo.Echo) {
+	volume_route := e.Group("/api/v1/volumes")
+	volume_route.GET("", h.GetListOfVolumes)
+	volume_route.GET("/:name", h.GetSingleVolumeInformation)
+	volume_route.DELETE("/:name", h.RemoveVolume)
+}
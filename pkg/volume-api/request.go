@@ -0,0 +1,30 @@
+package volumeapi
+
+import (
+	"github.com/docker/docker/api/types/volume"
+)
+
+type VolumeResponse struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Mountpoint string            `json:"mountpoint"`
+	CreatedAt  string            `json:"createdAt"`
+	Labels     map[string]string `json:"labels"`
+	// Names of the scheduled and running tasks that mount the volume.
+	UsedBy []string `json:"usedBy"`
+}
+
+func NewVolumeResponse(v volume.Volume, usedBy []string) VolumeResponse {
+	if usedBy == nil {
+		usedBy = []string{}
+	}
+
+	return VolumeResponse{
+		Name:       v.Name,
+		Driver:     v.Driver,
+		Mountpoint: v.Mountpoint,
+		CreatedAt:  v.CreatedAt,
+		Labels:     v.Labels,
+		UsedBy:     usedBy,
+	}
+}
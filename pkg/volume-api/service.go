@@ -0,0 +1,117 @@
+package volumeapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+func (h *Handler) GetListOfVolumes(c echo.Context) error {
+	volumes, err := h.runtime.ListVolumes(context.Background(), volume.ListOptions{
+		Filters: dkrclient.ManagedFilter(),
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, "Failed to list volumes. Error is: "+err.Error())
+	}
+
+	usedBy, err := h.volumeUsers()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+
+	responses := make([]VolumeResponse, 0, len(volumes))
+	for _, v := range volumes {
+		responses = append(responses, NewVolumeResponse(*v, usedBy[v.Name]))
+	}
+
+	return c.JSON(http.StatusOK, responses)
+}
+
+func (h *Handler) GetSingleVolumeInformation(c echo.Context) error {
+	v, status, err := h.findVolume(c.Param("name"))
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+
+	usedBy, err := h.volumeUsers()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, NewVolumeResponse(v, usedBy[v.Name]))
+}
+
+// RemoveVolume deletes a volume along with its data. Volumes still mounted
+// by a task are kept.
+func (h *Handler) RemoveVolume(c echo.Context) error {
+	v, status, err := h.findVolume(c.Param("name"))
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+
+	usedBy, err := h.volumeUsers()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	if len(usedBy[v.Name]) > 0 {
+		return c.JSON(http.StatusConflict, "Volume "+v.Name+" is used by tasks "+strings.Join(usedBy[v.Name], ", ")+". Please stop them and try again.")
+	}
+
+	err = h.runtime.RemoveVolume(context.Background(), v.Name, false)
+	if errdefs.IsConflict(err) {
+		return c.JSON(http.StatusConflict, "Volume "+v.Name+" is in use. Error is: "+err.Error())
+	}
+
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, "Failed to remove volume. Error is: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, NewVolumeResponse(v, nil))
+}
+
+// findVolume looks up a volume joyboy created, answering with the status to
+// send when there is none.
+func (h *Handler) findVolume(name string) (volume.Volume, int, error) {
+	v, err := h.runtime.InspectVolume(context.Background(), name)
+	if errdefs.IsNotFound(err) || (err == nil && v.Labels[dkrclient.ManagedLabel] != "true") {
+		return volume.Volume{}, http.StatusNotFound, errors.New("No volume managed by joyboy found with name " + name + ".")
+	}
+
+	if err != nil {
+		return volume.Volume{}, http.StatusBadGateway, err
+	}
+
+	return v, http.StatusOK, nil
+}
+
+// volumeUsers maps volume names to the scheduled and running tasks that
+// mount them.
+func (h *Handler) volumeUsers() (map[string][]string, error) {
+	var tasks []task.Task
+	result := h.DB.Where("state IN ?", []string{task.Scheduled.String(), task.Running.String()}).Find(&tasks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	usedBy := make(map[string][]string)
+	for _, t := range tasks {
+		for _, m := range t.Mounts {
+			if m.Type == string(mount.TypeVolume) {
+				usedBy[m.Source] = append(usedBy[m.Source], t.Name)
+			}
+		}
+	}
+	return usedBy, nil
+}
@@ -0,0 +1,84 @@
+package volumeapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/docker/api/types/volume"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+func TestVolumeApi(t *testing.T) {
+	db := dbtest.Open(t, &task.Task{})
+
+	rt := dkrclient.NewFakeRuntime()
+	managed := map[string]string{dkrclient.ManagedLabel: "true"}
+	for _, name := range []string{"pgdata", "cache"} {
+		rt.CreateVolume(context.Background(), volume.CreateOptions{Name: name, Labels: managed})
+	}
+	rt.CreateVolume(context.Background(), volume.CreateOptions{Name: "someone-elses"})
+
+	db.Create(&task.Task{
+		ID:     uuid.New(),
+		Name:   "postgres",
+		State:  task.Running.String(),
+		Mounts: []task.Mount{{Type: "volume", Source: "pgdata", Target: "/var/lib/postgresql/data"}},
+	})
+
+	e := echo.New()
+	NewHandler(rt, db).InitRoutes(e)
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/api/v1/volumes")
+	if err != nil {
+		t.Fatalf("failed to list volumes: %v", err)
+	}
+	var volumes []VolumeResponse
+	json.NewDecoder(resp.Body).Decode(&volumes)
+	resp.Body.Close()
+
+	if len(volumes) != 2 || volumes[0].Name != "cache" || volumes[1].Name != "pgdata" {
+		t.Fatalf("volumes = %+v, want cache and pgdata", volumes)
+	}
+	if len(volumes[1].UsedBy) != 1 || volumes[1].UsedBy[0] != "postgres" {
+		t.Errorf("pgdata used by %v, want postgres", volumes[1].UsedBy)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		volume string
+		want   int
+	}{
+		{name: "inspect", method: http.MethodGet, volume: "pgdata", want: http.StatusOK},
+		{name: "inspect unmanaged", method: http.MethodGet, volume: "someone-elses", want: http.StatusNotFound},
+		{name: "inspect missing", method: http.MethodGet, volume: "nope", want: http.StatusNotFound},
+		{name: "remove in use", method: http.MethodDelete, volume: "pgdata", want: http.StatusConflict},
+		{name: "remove unmanaged", method: http.MethodDelete, volume: "someone-elses", want: http.StatusNotFound},
+		{name: "remove", method: http.MethodDelete, volume: "cache", want: http.StatusOK},
+		{name: "removed", method: http.MethodGet, volume: "cache", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, srv.URL+"/api/v1/volumes/"+tt.volume, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
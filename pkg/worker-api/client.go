@@ -0,0 +1,135 @@
+package workerapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/pkg/metrics"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+// Client talks to the worker API of a single worker. Failures reported by
+// the worker come back as *Error, anything else means the worker could not
+// be reached or answered with something that is not the worker API.
+type Client struct {
+	Addr string
+	HTTP *http.Client
+}
+
+func NewClient(addr string) *Client {
+	return &Client{
+		Addr: addr,
+		HTTP: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *Client) SubmitTask(t task.Task) (TaskStatus, error) {
+	var status TaskStatus
+	err := c.do(http.MethodPost, "/worker/tasks", t, http.StatusAccepted, &status)
+	return status, err
+}
+
+func (c *Client) StopTask(id uuid.UUID) (TaskStatus, error) {
+	var status TaskStatus
+	err := c.do(http.MethodDelete, "/worker/tasks/"+id.String(), nil, http.StatusOK, &status)
+	return status, err
+}
+
+func (c *Client) GetTask(id uuid.UUID) (TaskStatus, error) {
+	var status TaskStatus
+	err := c.do(http.MethodGet, "/worker/tasks/"+id.String(), nil, http.StatusOK, &status)
+	return status, err
+}
+
+func (c *Client) ListTasks(state string) ([]TaskStatus, error) {
+	path := "/worker/tasks"
+	if state != "" {
+		path += "?state=" + url.QueryEscape(state)
+	}
+
+	var statuses []TaskStatus
+	err := c.do(http.MethodGet, path, nil, http.StatusOK, &statuses)
+	return statuses, err
+}
+
+// TaskLogs returns the logs of the task as the worker streams them, see
+// Handler.GetTaskLogs. They are read until ctx is cancelled or the worker
+// ends the stream, whatever the client's timeout.
+func (c *Client) TaskLogs(ctx context.Context, id uuid.UUID, options container.LogsOptions) (io.ReadCloser, error) {
+	path := "/worker/tasks/" + id.String() + "/logs?" + task.LogsQuery(options).Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+c.Addr+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	streaming := &http.Client{Transport: c.HTTP.Transport}
+	resp, err := streaming.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+
+		var apiErr Error
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Code == "" {
+			return nil, fmt.Errorf("worker %s answered GET %s with status %d", c.Addr, path, resp.StatusCode)
+		}
+		return nil, &apiErr
+	}
+
+	return resp.Body, nil
+}
+
+func (c *Client) TaskUsage(id uuid.UUID) (metrics.Usage, error) {
+	var usage metrics.Usage
+	err := c.do(http.MethodGet, "/worker/tasks/"+id.String()+"/metrics", nil, http.StatusOK, &usage)
+	return usage, err
+}
+
+func (c *Client) Stats() (StatsResponse, error) {
+	var stats StatsResponse
+	err := c.do(http.MethodGet, "/worker/stats", nil, http.StatusOK, &stats)
+	return stats, err
+}
+
+func (c *Client) do(method string, path string, body interface{}, want int, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequest(method, "http://"+c.Addr+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		var apiErr Error
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Code == "" {
+			return fmt.Errorf("worker %s answered %s %s with status %d", c.Addr, method, path, resp.StatusCode)
+		}
+		return &apiErr
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,66 @@
+package workerapi
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type ErrorCode string
+
+const (
+	// The request body or path could not be understood.
+	ErrInvalidRequest ErrorCode = "invalid_request"
+	// The worker has no task with the given id.
+	ErrTaskNotFound ErrorCode = "task_not_found"
+	// A task with the same id or name is already scheduled or running.
+	ErrTaskConflict ErrorCode = "task_conflict"
+	// A host port the task asks for is taken on this worker.
+	ErrPortConflict ErrorCode = "port_conflict"
+	// The worker does not have enough memory, disk or cpu left for the task.
+	ErrInsufficientResources ErrorCode = "insufficient_resources"
+	// Docker failed while acting on the task.
+	ErrRuntime ErrorCode = "runtime_error"
+	// Anything else, usually the worker's database.
+	ErrInternal ErrorCode = "internal_error"
+)
+
+var errorStatus = map[ErrorCode]int{
+	ErrInvalidRequest:        http.StatusBadRequest,
+	ErrTaskNotFound:          http.StatusNotFound,
+	ErrTaskConflict:          http.StatusConflict,
+	ErrPortConflict:          http.StatusConflict,
+	ErrInsufficientResources: http.StatusUnprocessableEntity,
+	ErrRuntime:               http.StatusBadGateway,
+	ErrInternal:              http.StatusInternalServerError,
+}
+
+// Error is the body of every failed worker API call.
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	TaskID  string    `json:"taskId,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.TaskID != "" {
+		return fmt.Sprintf("%s: %s (task %s)", e.Code, e.Message, e.TaskID)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Status is the HTTP status code the error is sent with.
+func (e *Error) Status() int {
+	status, ok := errorStatus[e.Code]
+	if !ok {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+func NewError(code ErrorCode, taskId string, format string, args ...interface{}) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+		TaskID:  taskId,
+	}
+}
@@ -0,0 +1,32 @@
+package workerapi
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/worker"
+	"gorm.io/gorm"
+)
+
+// Handler serves the worker side REST surface a manager uses to drive this
+// worker from another host.
+type Handler struct {
+	worker *worker.Worker
+	DB     *gorm.DB
+}
+
+func NewHandler(w *worker.Worker, db *gorm.DB) *Handler {
+	return &Handler{
+		worker: w,
+		DB:     db,
+	}
+}
+
+func (h *Handler) InitRoutes(e *echo.Echo) {
+	worker_route := e.Group("/worker")
+	worker_route.POST("/tasks", h.AddTask)
+	worker_route.GET("/tasks", h.ListTasks)
+	worker_route.GET("/tasks/:id", h.GetTask)
+	worker_route.DELETE("/tasks/:id", h.StopTask)
+	worker_route.GET("/tasks/:id/logs", h.GetTaskLogs)
+	worker_route.GET("/tasks/:id/metrics", h.GetTaskMetrics)
+	worker_route.GET("/stats", h.GetStats)
+}
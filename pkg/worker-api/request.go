@@ -0,0 +1,112 @@
+package workerapi
+
+import (
+	"time"
+
+	"github.com/shashank-mugiwara/joyboy/node"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/worker"
+)
+
+// The worker API speaks JSON in both directions, except for logs.
+//
+//	POST   /worker/tasks           body: task.Task          202: TaskStatus
+//	GET    /worker/tasks           query: state (optional)  200: []TaskStatus
+//	GET    /worker/tasks/:id                                200: TaskStatus
+//	DELETE /worker/tasks/:id                                200: TaskStatus
+//	GET    /worker/tasks/:id/logs  query: log options       200: LogsContentType
+//	GET    /worker/tasks/:id/metrics                        200: metrics.Usage
+//	GET    /worker/stats                                    200: StatsResponse
+//
+// The body of POST /worker/tasks is the task exactly as the manager stored
+// it. id, name and image are required, state and containerId are ignored and
+// the task always starts out Scheduled on the worker. Logs are sent as
+// Docker multiplexes them, with the options task.ParseLogsOptions reads.
+// Every non 2xx response carries an Error.
+
+// LogsContentType is the content type of the log stream, Docker's own.
+const LogsContentType = "application/vnd.docker.multiplexed-stream"
+
+// TaskStatus is how a worker reports a task back.
+type TaskStatus struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Image        string    `json:"image"`
+	State        string    `json:"state"`
+	ContainerID  string    `json:"containerId"`
+	StartTime    time.Time `json:"startTime"`
+	FinishTime   time.Time `json:"finishTime"`
+	PullProgress int       `json:"pullProgress"`
+	// Health and HealthMessage are as on task.Task.
+	Health        string `json:"health,omitempty"`
+	HealthMessage string `json:"healthMessage,omitempty"`
+	Message       string `json:"message,omitempty"`
+}
+
+// StatsResponse is the body of GET /worker/stats. Memory and disk sizes
+// are in MiB, cpuUsage is the host's busy percentage since the previous
+// snapshot.
+type StatsResponse struct {
+	Name            string         `json:"name"`
+	QueueLength     int            `json:"queueLength"`
+	TaskCount       int            `json:"taskCount"`
+	Cores           int            `json:"cores"`
+	Memory          int            `json:"memory"`
+	MemoryAllocated int            `json:"memoryAllocated"`
+	MemoryAvailable int            `json:"memoryAvailable"`
+	Disk            int            `json:"disk"`
+	DiskAllocated   int            `json:"diskAllocated"`
+	DiskAvailable   int            `json:"diskAvailable"`
+	CpuUsage        float64        `json:"cpuUsage"`
+	Load            worker.LoadAvg `json:"load"`
+	CollectedAt     time.Time      `json:"collectedAt"`
+}
+
+func NewTaskStatus(t task.Task) TaskStatus {
+	return TaskStatus{
+		ID:            t.ID.String(),
+		Name:          t.Name,
+		Image:         t.Image,
+		State:         t.State,
+		ContainerID:   t.ContainerID,
+		StartTime:     t.StartTime,
+		FinishTime:    t.FinishTime,
+		PullProgress:  t.PullProgress,
+		Health:        t.Health,
+		HealthMessage: t.HealthMessage,
+	}
+}
+
+// Node describes the worker at addr the way placement strategies see it.
+func (s StatsResponse) Node(addr string) node.Node {
+	return node.Node{
+		Name:            addr,
+		Ip:              addr,
+		Cores:           s.Cores,
+		Memory:          s.Memory,
+		MemoryAllocated: s.MemoryAllocated,
+		Disk:            s.Disk,
+		DiskAllocated:   s.DiskAllocated,
+		Load:            s.Load.Last1Min,
+		Role:            "worker",
+		TaskCount:       s.TaskCount,
+	}
+}
+
+func NewStatsResponse(stats worker.Stats) StatsResponse {
+	return StatsResponse{
+		Name:            stats.Name,
+		QueueLength:     stats.QueueLength,
+		TaskCount:       stats.TaskCount,
+		Cores:           stats.Node.Cores,
+		Memory:          stats.Node.Memory,
+		MemoryAllocated: stats.Node.MemoryAllocated,
+		MemoryAvailable: int(stats.Mem.AvailableKb / 1024),
+		Disk:            stats.Node.Disk,
+		DiskAllocated:   stats.Node.DiskAllocated,
+		DiskAvailable:   int(stats.Disk.Free / (1024 * 1024)),
+		CpuUsage:        stats.CpuUsage,
+		Load:            stats.Load,
+		CollectedAt:     stats.CollectedAt,
+	}
+}
@@ -0,0 +1,272 @@
+package workerapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/errdefs"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/config"
+	"github.com/shashank-mugiwara/joyboy/portalloc"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/utils"
+	"gorm.io/gorm"
+)
+
+func sendError(c echo.Context, e *Error) error {
+	return c.JSON(e.Status(), e)
+}
+
+func (h *Handler) AddTask(c echo.Context) error {
+	var t task.Task
+	if err := c.Bind(&t); err != nil {
+		return sendError(c, NewError(ErrInvalidRequest, "", "failed to parse task: %v", err))
+	}
+
+	if t.ID == uuid.Nil {
+		return sendError(c, NewError(ErrInvalidRequest, "", "id field is mandatory"))
+	}
+
+	if utils.IsBlank(t.Image) {
+		return sendError(c, NewError(ErrInvalidRequest, t.ID.String(), "image field is mandatory"))
+	}
+
+	if utils.IsBlank(t.Name) {
+		return sendError(c, NewError(ErrInvalidRequest, t.ID.String(), "name field is mandatory"))
+	}
+
+	if err := task.ValidateMounts(t.Mounts, config.VolumeSetting.AllowedHostPaths); err != nil {
+		return sendError(c, NewError(ErrInvalidRequest, t.ID.String(), "%v", err))
+	}
+
+	for _, m := range t.Mounts {
+		if m.Type != string(mount.TypeBind) {
+			continue
+		}
+		if _, err := task.ResolveHostPath(m.Source, config.VolumeSetting.AllowedHostPaths); err != nil {
+			return sendError(c, NewError(ErrInvalidRequest, t.ID.String(), "mount on %s: %v", m.Target, err))
+		}
+	}
+
+	if err := t.PortBindings.Validate(); err != nil {
+		return sendError(c, NewError(ErrInvalidRequest, t.ID.String(), "%v", err))
+	}
+
+	if !utils.IsBlank(t.Network) {
+		if err := task.ValidateNetworkName(t.Network); err != nil {
+			return sendError(c, NewError(ErrInvalidRequest, t.ID.String(), "%v", err))
+		}
+	}
+
+	if err := task.ValidatePullPolicy(t.PullPolicy); err != nil {
+		return sendError(c, NewError(ErrInvalidRequest, t.ID.String(), "%v", err))
+	}
+
+	if t.HealthCheck != nil {
+		if err := t.HealthCheck.Validate(t.PortBindings); err != nil {
+			return sendError(c, NewError(ErrInvalidRequest, t.ID.String(), "%v", err))
+		}
+	}
+
+	var existingTask task.Task
+	result := h.DB.Where(&task.Task{ID: t.ID}).Find(&existingTask)
+	if result.Error != nil {
+		return sendError(c, NewError(ErrInternal, t.ID.String(), "failed to fetch task from db: %v", result.Error))
+	}
+
+	if result.RowsAffected != 0 {
+		return sendError(c, NewError(ErrTaskConflict, t.ID.String(), "task already exists on this worker"))
+	}
+
+	result = h.DB.Where("name = ? AND state IN ?", t.Name, []string{task.Scheduled.String(), task.Running.String()}).Take(&existingTask)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return sendError(c, NewError(ErrInternal, t.ID.String(), "failed to fetch task from db: %v", result.Error))
+	}
+
+	if result.Error == nil {
+		return sendError(c, NewError(ErrTaskConflict, t.ID.String(), "task with name %s is already %s", t.Name, existingTask.State))
+	}
+
+	t.State = task.Scheduled.String()
+	t.ContainerID = ""
+
+	err := h.worker.Admit(&t, func() error { return h.DB.Save(&t).Error })
+	if errors.Is(err, portalloc.ErrPortConflict) {
+		return sendError(c, NewError(ErrPortConflict, t.ID.String(), "%v", err))
+	}
+
+	if errors.Is(err, task.ErrNoCapacity) {
+		return sendError(c, NewError(ErrInsufficientResources, t.ID.String(), "%v", err))
+	}
+
+	if err != nil {
+		return sendError(c, NewError(ErrInternal, t.ID.String(), "failed to save task to db: %v", err))
+	}
+
+	if err := task.RecordEvent(h.DB, t.ID, "", t.State, "task submitted"); err != nil {
+		c.Logger().Info("Failed to record task event. Error is: ", err.Error())
+	}
+
+	if err := h.worker.AddTask(t); err != nil {
+		return sendError(c, NewError(ErrInternal, t.ID.String(), "failed to queue task: %v", err))
+	}
+
+	c.Logger().Info("Task successfully submitted to queue.")
+
+	return c.JSON(http.StatusAccepted, NewTaskStatus(t))
+}
+
+func (h *Handler) ListTasks(c echo.Context) error {
+	state := c.QueryParam("state")
+
+	query := h.DB
+	if !utils.IsBlank(state) {
+		if _, ok := task.KnownContainerStateMap[state]; !ok {
+			return sendError(c, NewError(ErrInvalidRequest, "", "invalid state %s", state))
+		}
+		query = query.Where("state = ?", state)
+	}
+
+	var tasks []task.Task
+	if result := query.Find(&tasks); result.Error != nil {
+		return sendError(c, NewError(ErrInternal, "", "failed to fetch tasks from db: %v", result.Error))
+	}
+
+	statuses := make([]TaskStatus, 0, len(tasks))
+	for _, t := range tasks {
+		statuses = append(statuses, NewTaskStatus(t))
+	}
+
+	return c.JSON(http.StatusOK, statuses)
+}
+
+func (h *Handler) GetTask(c echo.Context) error {
+	t, apiErr := h.findTask(c.Param("id"))
+	if apiErr != nil {
+		return sendError(c, apiErr)
+	}
+
+	return c.JSON(http.StatusOK, NewTaskStatus(t))
+}
+
+func (h *Handler) StopTask(c echo.Context) error {
+	t, apiErr := h.findTask(c.Param("id"))
+	if apiErr != nil {
+		return sendError(c, apiErr)
+	}
+
+	stopped := task.Task{ID: t.ID}
+	result := h.worker.StopTask(&stopped)
+
+	status := NewTaskStatus(t)
+	status.Message = result.Message
+
+	// Stopping a failed task only removes its record, which the worker
+	// reports as an error even though the request did what was asked.
+	if t.State == task.Failed.String() {
+		return c.JSON(http.StatusOK, status)
+	}
+
+	if result.Error != nil {
+		return sendError(c, NewError(ErrRuntime, t.ID.String(), "%v. %s", result.Error, result.Message))
+	}
+
+	status.State = stopped.State
+	status.FinishTime = stopped.FinishTime
+	return c.JSON(http.StatusOK, status)
+}
+
+// GetTaskLogs streams the logs of the task's container as Docker sends them,
+// stdout and stderr multiplexed into one stream. The query is the one
+// task.ParseLogsOptions reads.
+func (h *Handler) GetTaskLogs(c echo.Context) error {
+	t, apiErr := h.findTask(c.Param("id"))
+	if apiErr != nil {
+		return sendError(c, apiErr)
+	}
+
+	if t.ContainerID == "" {
+		return sendError(c, NewError(ErrTaskConflict, t.ID.String(), "task is %s and has no container to read logs from", t.State))
+	}
+
+	options, err := task.ParseLogsOptions(c.QueryParams())
+	if err != nil {
+		return sendError(c, NewError(ErrInvalidRequest, t.ID.String(), "%v", err))
+	}
+
+	logs, err := h.worker.TaskLogs(c.Request().Context(), t, options)
+	if errdefs.IsNotFound(err) {
+		return sendError(c, NewError(ErrTaskNotFound, t.ID.String(), "container of the task is gone: %v", err))
+	}
+
+	if err != nil {
+		return sendError(c, NewError(ErrRuntime, t.ID.String(), "failed to read logs: %v", err))
+	}
+	defer logs.Close()
+
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, LogsContentType)
+	resp.WriteHeader(http.StatusOK)
+	resp.Flush()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := logs.Read(buf)
+		if n > 0 {
+			if _, err := resp.Write(buf[:n]); err != nil {
+				return nil
+			}
+			resp.Flush()
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+func (h *Handler) GetTaskMetrics(c echo.Context) error {
+	t, apiErr := h.findTask(c.Param("id"))
+	if apiErr != nil {
+		return sendError(c, apiErr)
+	}
+
+	if t.State != task.Running.String() || t.ContainerID == "" {
+		return sendError(c, NewError(ErrTaskConflict, t.ID.String(), "task is %s and has no running container to read metrics from", t.State))
+	}
+
+	usage, err := h.worker.TaskUsage(c.Request().Context(), t)
+	if errdefs.IsNotFound(err) {
+		return sendError(c, NewError(ErrTaskNotFound, t.ID.String(), "container of the task is gone: %v", err))
+	}
+
+	if err != nil {
+		return sendError(c, NewError(ErrRuntime, t.ID.String(), "failed to read metrics: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, usage)
+}
+
+func (h *Handler) GetStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, NewStatsResponse(h.worker.LatestStats()))
+}
+
+func (h *Handler) findTask(id string) (task.Task, *Error) {
+	taskId, err := uuid.Parse(id)
+	if err != nil {
+		return task.Task{}, NewError(ErrInvalidRequest, id, "given uuid of task is improper")
+	}
+
+	var t task.Task
+	result := h.DB.Where(&task.Task{ID: taskId}).Find(&t)
+	if result.Error != nil {
+		return task.Task{}, NewError(ErrInternal, id, "failed to fetch task from db: %v", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return task.Task{}, NewError(ErrTaskNotFound, id, "no task found for the given id")
+	}
+
+	return t, nil
+}
@@ -0,0 +1,152 @@
+package workerapi
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/portalloc"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/taskqueue"
+	"github.com/shashank-mugiwara/joyboy/worker"
+	"gorm.io/gorm"
+)
+
+func startWorkerApi(t *testing.T) (*Client, *gorm.DB) {
+	t.Helper()
+
+	db := dbtest.Open(t, &task.Task{}, &task.TaskEvent{}, &taskqueue.QueuedTask{})
+
+	ports := portalloc.New(db, 0, 0)
+	ports.Free = func(protocol string, hostIP string, port int) bool { return true }
+
+	w := &worker.Worker{Name: "test", Queue: taskqueue.NewDbQueue(db, "worker"), DB: db, Ports: ports}
+	e := echo.New()
+	NewHandler(w, db).InitRoutes(e)
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	return NewClient(srv.Listener.Addr().String()), db
+}
+
+func TestWorkerApiErrors(t *testing.T) {
+	client, db := startWorkerApi(t)
+
+	running := task.Task{ID: uuid.New(), Name: "nginx", Image: "nginx", State: task.Running.String(), PortBindings: task.PortBindings{{ContainerPort: "80", HostPort: "8211"}}}
+	db.Create(&running)
+
+	tests := []struct {
+		name string
+		call func() error
+		want ErrorCode
+	}{
+		{
+			name: "missing id",
+			call: func() error {
+				_, err := client.SubmitTask(task.Task{Name: "redis", Image: "redis"})
+				return err
+			},
+			want: ErrInvalidRequest,
+		},
+		{
+			name: "missing image",
+			call: func() error {
+				_, err := client.SubmitTask(task.Task{ID: uuid.New(), Name: "redis"})
+				return err
+			},
+			want: ErrInvalidRequest,
+		},
+		{
+			name: "duplicate id",
+			call: func() error {
+				_, err := client.SubmitTask(task.Task{ID: running.ID, Name: "other", Image: "nginx"})
+				return err
+			},
+			want: ErrTaskConflict,
+		},
+		{
+			name: "duplicate name",
+			call: func() error {
+				_, err := client.SubmitTask(task.Task{ID: uuid.New(), Name: "nginx", Image: "nginx"})
+				return err
+			},
+			want: ErrTaskConflict,
+		},
+		{
+			name: "host port taken",
+			call: func() error {
+				_, err := client.SubmitTask(task.Task{ID: uuid.New(), Name: "other", Image: "nginx", PortBindings: task.PortBindings{{ContainerPort: "8080", HostPort: "8211"}}})
+				return err
+			},
+			want: ErrPortConflict,
+		},
+		{
+			name: "unknown task",
+			call: func() error {
+				_, err := client.GetTask(uuid.New())
+				return err
+			},
+			want: ErrTaskNotFound,
+		},
+		{
+			name: "stop unknown task",
+			call: func() error {
+				_, err := client.StopTask(uuid.New())
+				return err
+			},
+			want: ErrTaskNotFound,
+		},
+		{
+			name: "invalid state filter",
+			call: func() error {
+				_, err := client.ListTasks("Sleeping")
+				return err
+			},
+			want: ErrInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var apiErr *Error
+			if err := tt.call(); !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want *Error", err)
+			}
+			if apiErr.Code != tt.want {
+				t.Errorf("error code = %v, want %v", apiErr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkerApiSubmitAndList(t *testing.T) {
+	client, _ := startWorkerApi(t)
+
+	id := uuid.New()
+	status, err := client.SubmitTask(task.Task{ID: id, Name: "redis", Image: "redis", State: task.Running.String()})
+	if err != nil {
+		t.Fatalf("SubmitTask() error = %v", err)
+	}
+	if status.State != task.Scheduled.String() {
+		t.Errorf("submitted task state = %v, want %v", status.State, task.Scheduled.String())
+	}
+
+	statuses, err := client.ListTasks(task.Scheduled.String())
+	if err != nil {
+		t.Fatalf("ListTasks() error = %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].ID != id.String() {
+		t.Errorf("ListTasks() = %+v, want only task %v", statuses, id)
+	}
+
+	stats, err := client.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if stats.Memory == 0 || stats.Cores == 0 {
+		t.Errorf("Stats() = %+v, want host memory and cores", stats)
+	}
+}
@@ -0,0 +1,268 @@
+package portalloc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/utils"
+	"gorm.io/gorm"
+)
+
+// ErrPortConflict is returned when a task asks for a host port that is
+// already taken, or when no port is left to hand out.
+var ErrPortConflict = errors.New("host port is not available")
+
+// Reserver is implemented by whatever binds host ports on its own machine,
+// so tasks asking for taken ports are refused before they are accepted.
+type Reserver interface {
+	// ReservePorts fills in the task's empty host ports, checks the others
+	// are free, and saves the task while no other reservation can run.
+	ReservePorts(t *task.Task, save func() error) error
+	// CheckPorts reports whether any of the host ports is taken.
+	CheckPorts(bindings task.PortBindings) error
+}
+
+// Allocator keeps track of the host ports used by the scheduled and running
+// tasks in the database, and of ports other programs on the host listen on.
+type Allocator struct {
+	DB *gorm.DB
+	// Empty host ports are handed out from RangeStart to RangeEnd. Without
+	// a range Docker picks them when the container starts.
+	RangeStart int
+	RangeEnd   int
+	// Free reports whether nothing on the host listens on the port. It
+	// tries to listen on the port itself when not set.
+	Free func(protocol string, hostIP string, port int) bool
+
+	mu sync.Mutex
+}
+
+func New(db *gorm.DB, rangeStart int, rangeEnd int) *Allocator {
+	return &Allocator{
+		DB:         db,
+		RangeStart: rangeStart,
+		RangeEnd:   rangeEnd,
+	}
+}
+
+// portRange is a run of host ports taken on one address.
+type portRange struct {
+	protocol string
+	hostIP   string
+	start    int
+	end      int
+	owner    string
+}
+
+func (p portRange) overlaps(o portRange) bool {
+	return p.protocol == o.protocol && p.start <= o.end && o.start <= p.end && sameAddress(p.hostIP, o.hostIP)
+}
+
+// sameAddress reports whether two bindings could clash, which they do
+// unless both name different specific addresses.
+func sameAddress(a string, b string) bool {
+	return anyAddress(a) || anyAddress(b) || net.ParseIP(a).Equal(net.ParseIP(b))
+}
+
+func anyAddress(ip string) bool {
+	return utils.IsBlank(ip) || net.ParseIP(ip).IsUnspecified()
+}
+
+// Reserve fills in the task's empty host ports from the configured range and
+// checks the fixed ones are free. save is called under the allocator's lock,
+// so a task is in the database before the next one is checked against it.
+func (a *Allocator) Reserve(t *task.Task, save func() error) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	taken, err := a.takenPorts(t.ID)
+	if err != nil {
+		return err
+	}
+
+	bindings := make(task.PortBindings, 0, len(t.PortBindings))
+	for _, b := range t.PortBindings {
+		if utils.IsBlank(b.HostPort) && a.RangeStart > 0 {
+			b.HostPort, err = a.pick(b, taken)
+		} else {
+			err = a.check(b, taken)
+		}
+		if err != nil {
+			return err
+		}
+
+		if r, ok := hostPortRange(b, "this task"); ok {
+			taken = append(taken, r)
+		}
+		bindings = append(bindings, b)
+	}
+
+	if len(t.PortBindings) > 0 {
+		t.PortBindings = bindings
+	}
+	return save()
+}
+
+// Check reports the first fixed host port among the bindings that is taken.
+func (a *Allocator) Check(bindings task.PortBindings) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	taken, err := a.takenPorts(uuid.Nil)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bindings {
+		if err := a.check(b, taken); err != nil {
+			return err
+		}
+		if r, ok := hostPortRange(b, "this task"); ok {
+			taken = append(taken, r)
+		}
+	}
+	return nil
+}
+
+func (a *Allocator) check(b task.PortBinding, taken []portRange) error {
+	r, ok := hostPortRange(b, "")
+	if !ok {
+		return nil
+	}
+
+	for _, t := range taken {
+		if r.overlaps(t) {
+			return fmt.Errorf("%w: host port %s/%s is used by %s", ErrPortConflict, b.HostPort, r.protocol, t.owner)
+		}
+	}
+
+	// A host range for a single container port only needs one free port,
+	// which Docker finds itself.
+	if start, end, err := nat.ParsePortRange(b.ContainerPort); err == nil && start == end && r.start != r.end {
+		return nil
+	}
+
+	for port := r.start; port <= r.end; port++ {
+		if !a.free(r.protocol, r.hostIP, port) {
+			return fmt.Errorf("%w: host port %d/%s is used by another program on the host", ErrPortConflict, port, r.protocol)
+		}
+	}
+	return nil
+}
+
+// pick finds the lowest run of free ports in the range as long as the
+// binding's container port range.
+func (a *Allocator) pick(b task.PortBinding, taken []portRange) (string, error) {
+	start, end, err := nat.ParsePortRange(b.ContainerPort)
+	if err != nil {
+		return "", err
+	}
+	length := int(end - start)
+
+	protocol := utils.DefaultIfBlank(b.Protocol, "tcp")
+	for port := a.RangeStart; port+length <= a.RangeEnd; port++ {
+		candidate := portRange{protocol: protocol, hostIP: b.HostIP, start: port, end: port + length}
+		if a.available(candidate, taken) {
+			if length == 0 {
+				return strconv.Itoa(port), nil
+			}
+			return strconv.Itoa(port) + "-" + strconv.Itoa(port+length), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: no free host ports left between %d and %d for container port %s/%s", ErrPortConflict, a.RangeStart, a.RangeEnd, b.ContainerPort, protocol)
+}
+
+func (a *Allocator) available(r portRange, taken []portRange) bool {
+	for _, t := range taken {
+		if r.overlaps(t) {
+			return false
+		}
+	}
+
+	for port := r.start; port <= r.end; port++ {
+		if !a.free(r.protocol, r.hostIP, port) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Allocator) free(protocol string, hostIP string, port int) bool {
+	if a.Free != nil {
+		return a.Free(protocol, hostIP, port)
+	}
+	return listenFree(protocol, hostIP, port)
+}
+
+// takenPorts lists the host ports of every scheduled and running task but
+// the given one. Running tasks count with the ports Docker bound for them,
+// scheduled ones with the ports they asked for.
+func (a *Allocator) takenPorts(except uuid.UUID) ([]portRange, error) {
+	var tasks []task.Task
+	result := a.DB.Where("state IN ? AND id <> ?", []string{task.Scheduled.String(), task.Running.String()}, except).Find(&tasks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var taken []portRange
+	for _, t := range tasks {
+		bindings := t.PortBindings
+		if len(t.Ports) > 0 {
+			bindings = t.Ports
+		}
+
+		for _, b := range bindings {
+			if r, ok := hostPortRange(b, "task "+t.Name); ok {
+				taken = append(taken, r)
+			}
+		}
+	}
+	return taken, nil
+}
+
+func hostPortRange(b task.PortBinding, owner string) (portRange, bool) {
+	if utils.IsBlank(b.HostPort) {
+		return portRange{}, false
+	}
+
+	start, end, err := nat.ParsePortRange(b.HostPort)
+	if err != nil {
+		return portRange{}, false
+	}
+
+	return portRange{
+		protocol: utils.DefaultIfBlank(b.Protocol, "tcp"),
+		hostIP:   b.HostIP,
+		start:    int(start),
+		end:      int(end),
+		owner:    owner,
+	}, true
+}
+
+func listenFree(protocol string, hostIP string, port int) bool {
+	address := net.JoinHostPort(hostIP, strconv.Itoa(port))
+	switch protocol {
+	case "tcp":
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			return false
+		}
+		l.Close()
+	case "udp":
+		l, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return false
+		}
+		l.Close()
+	}
+	// sctp cannot be checked from here, Docker reports clashes when the
+	// container starts.
+	return true
+}
@@ -0,0 +1,105 @@
+package portalloc
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+func newTestAllocator(t *testing.T) *Allocator {
+	t.Helper()
+
+	db := dbtest.Open(t, &task.Task{})
+
+	db.Create(&task.Task{ID: uuid.New(), Name: "web", State: task.Running.String(),
+		PortBindings: task.PortBindings{{ContainerPort: "80"}},
+		Ports:        []task.PortBinding{{ContainerPort: "80", Protocol: "tcp", HostIP: "0.0.0.0", HostPort: "20000"}}})
+	db.Create(&task.Task{ID: uuid.New(), Name: "dns", State: task.Scheduled.String(),
+		PortBindings: task.PortBindings{{ContainerPort: "53", Protocol: "udp", HostIP: "127.0.0.1", HostPort: "5353"}}})
+	db.Create(&task.Task{ID: uuid.New(), Name: "gone", State: task.Failed.String(),
+		PortBindings: task.PortBindings{{ContainerPort: "80", HostPort: "8211"}}})
+
+	a := New(db, 20000, 20003)
+	// Port 9999 plays a program on the host that joyboy did not start.
+	a.Free = func(protocol string, hostIP string, port int) bool { return port != 9999 }
+	return a
+}
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		bindings task.PortBindings
+		noRange  bool
+		want     string
+		wantErr  bool
+	}{
+		{name: "free fixed port", bindings: task.PortBindings{{ContainerPort: "80", HostPort: "8080"}}, want: ":8080:80/tcp"},
+		{name: "port of a failed task", bindings: task.PortBindings{{ContainerPort: "80", HostPort: "8211"}}, want: ":8211:80/tcp"},
+		{name: "port bound by a running task", bindings: task.PortBindings{{ContainerPort: "80", HostPort: "20000"}}, wantErr: true},
+		{name: "port asked for by a scheduled task", bindings: task.PortBindings{{ContainerPort: "53", Protocol: "udp", HostPort: "5353"}}, wantErr: true},
+		{name: "same port on another address", bindings: task.PortBindings{{ContainerPort: "53", Protocol: "udp", HostIP: "127.0.0.2", HostPort: "5353"}}, want: "127.0.0.2:5353:53/udp"},
+		{name: "same port other protocol", bindings: task.PortBindings{{ContainerPort: "53", HostPort: "5353"}}, want: ":5353:53/tcp"},
+		{name: "port used on the host", bindings: task.PortBindings{{ContainerPort: "80", HostPort: "9999"}}, wantErr: true},
+		{name: "range overlapping a used port", bindings: task.PortBindings{{ContainerPort: "8000-8001", HostPort: "19999-20000"}}, wantErr: true},
+		{name: "same port twice", bindings: task.PortBindings{{ContainerPort: "80", HostPort: "8080"}, {ContainerPort: "81", HostPort: "8080"}}, wantErr: true},
+		{name: "empty port from range", bindings: task.PortBindings{{ContainerPort: "80"}}, want: ":20001:80/tcp"},
+		{name: "empty ports from range", bindings: task.PortBindings{{ContainerPort: "80"}, {ContainerPort: "81"}}, want: ":20001:80/tcp,:20002:81/tcp"},
+		{name: "empty range from range", bindings: task.PortBindings{{ContainerPort: "8000-8002"}}, want: ":20001-20003:8000-8002/tcp"},
+		{name: "range exhausted", bindings: task.PortBindings{{ContainerPort: "8000-8003"}}, wantErr: true},
+		{name: "no range leaves port to docker", bindings: task.PortBindings{{ContainerPort: "80"}}, noRange: true, want: "::80/tcp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAllocator(t)
+			if tt.noRange {
+				a.RangeStart, a.RangeEnd = 0, 0
+			}
+
+			tk := task.Task{ID: uuid.New(), Name: "new", State: task.Scheduled.String(), PortBindings: tt.bindings}
+			saved := false
+			err := a.Reserve(&tk, func() error {
+				saved = true
+				return a.DB.Create(&tk).Error
+			})
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrPortConflict) || saved {
+					t.Fatalf("Reserve() error = %v, saved = %v, want a port conflict and no save", err, saved)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			if got := strings.Join(tk.PortBindings.Specs(), ","); got != tt.want {
+				t.Errorf("port bindings = %v, want %v", got, tt.want)
+			}
+
+			// Whatever was reserved is now taken.
+			if err := a.Check(tk.PortBindings); !errors.Is(err, ErrPortConflict) && len(tk.PortBindings) > 0 && !tt.noRange {
+				t.Errorf("Check() after Reserve() error = %v, want a port conflict", err)
+			}
+		})
+	}
+}
+
+func TestListenFree(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on loopback: %v", err)
+	}
+	defer l.Close()
+
+	port, _ := strconv.Atoi(strings.TrimPrefix(l.Addr().String(), "127.0.0.1:"))
+	if listenFree("tcp", "127.0.0.1", port) {
+		t.Errorf("listenFree() = true for a port that is listened on")
+	}
+}
@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"gorm.io/gorm"
+)
+
+// HealthChecker keeps the health of the Running tasks up to date and
+// restarts the unhealthy ones whose restart policy allows it. Checks Docker
+// runs itself are read off the container, HTTP and TCP probes are sent by
+// the checker.
+type HealthChecker struct {
+	DB      *gorm.DB
+	Runtime dkrclient.Runtime
+	Worker  Requeuer
+}
+
+// CheckAll checks every Running task whose interval has passed since its
+// last check, all at once, and returns when they are done.
+func (h *HealthChecker) CheckAll() {
+	var tasks []task.Task
+	if result := h.DB.Where("state = ? AND container_id <> ''", task.Running.String()).Find(&tasks); result.Error != nil {
+		log.Printf("Failed to fetch running tasks: %v\n", result.Error)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		if time.Since(t.HealthCheckedAt) < t.HealthCheck.Interval() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(t task.Task) {
+			defer wg.Done()
+			h.check(t)
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (h *HealthChecker) check(t task.Task) {
+	ctx := context.Background()
+	info, err := h.Runtime.Inspect(ctx, t.ContainerID)
+	if errdefs.IsNotFound(err) {
+		// Lost containers are the scheduler's to deal with.
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to inspect container %v of task %v: %v\n", t.ContainerID, t.Name, err)
+		return
+	}
+
+	previous := t.Health
+	switch {
+	case info.State.Restarting:
+		// Docker is restarting it already, so it is only reported.
+		t.Health = task.HealthUnhealthy
+		t.HealthMessage = fmt.Sprintf("container keeps exiting, last exit code %d", info.State.ExitCode)
+	case !info.State.Running:
+		return
+	case t.HealthCheck == nil:
+		t.Health = ""
+		t.HealthMessage = ""
+	case t.HealthCheck.Docker():
+		readDockerHealth(&t, info.State.Health)
+	default:
+		h.probe(ctx, &t)
+	}
+	t.HealthCheckedAt = time.Now().UTC()
+
+	result := h.DB.Model(&task.Task{}).Where("id = ? AND state = ?", t.ID, task.Running.String()).
+		Select("health", "health_message", "health_failures", "health_checked_at").Updates(&t)
+	if result.Error != nil {
+		log.Printf("Failed to record health of task %v: %v\n", t.Name, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	if t.Health != previous && t.Health != task.HealthStarting {
+		reason := "task is " + strings.ToLower(t.Health)
+		if t.Health == "" {
+			reason = "container runs again"
+		} else if t.HealthMessage != "" {
+			reason += ": " + t.HealthMessage
+		}
+		if err := task.RecordEvent(h.DB, t.ID, t.State, t.State, reason); err != nil {
+			log.Printf("Failed to record event of task %v: %v\n", t.Name, err)
+		}
+	}
+
+	// Docker reports a restarting container as running too.
+	if t.Health != task.HealthUnhealthy || !info.State.Running || info.State.Restarting || !t.RestartsOnFailure() || h.Worker == nil {
+		return
+	}
+
+	log.Printf("Task %v is unhealthy, starting it again as its restart policy is %v\n", t.Name, t.RestartPolicy)
+	err = h.Runtime.Remove(ctx, t.ContainerID, container.RemoveOptions{Force: true})
+	if err != nil && !errdefs.IsNotFound(err) {
+		log.Printf("Failed to remove container %v of task %v: %v\n", t.ContainerID, t.Name, err)
+		return
+	}
+	restartTask(h.DB, h.Worker, t, "task became unhealthy")
+}
+
+// probe sends the task's HTTP or TCP probe. Failures within the start period
+// are not counted, and the task turns Unhealthy once they reach the check's
+// retries.
+func (h *HealthChecker) probe(ctx context.Context, t *task.Task) {
+	err := t.HealthCheck.Probe(ctx, t.Ports)
+	if err == nil {
+		t.Health = task.HealthHealthy
+		t.HealthMessage = ""
+		t.HealthFailures = 0
+		return
+	}
+
+	t.HealthMessage = err.Error()
+	if time.Since(t.StartTime) < t.HealthCheck.StartPeriod() {
+		t.Health = task.HealthStarting
+		return
+	}
+
+	t.HealthFailures++
+	if t.HealthFailures >= t.HealthCheck.MaxFailures() {
+		t.Health = task.HealthUnhealthy
+	} else if t.Health == "" {
+		t.Health = task.HealthStarting
+	}
+}
+
+// readDockerHealth takes over what Docker found running the check.
+func readDockerHealth(t *task.Task, health *types.Health) {
+	if health == nil {
+		t.Health = task.HealthStarting
+		return
+	}
+
+	switch health.Status {
+	case types.Healthy:
+		t.Health = task.HealthHealthy
+	case types.Unhealthy:
+		t.Health = task.HealthUnhealthy
+	default:
+		t.Health = task.HealthStarting
+	}
+	t.HealthFailures = health.FailingStreak
+
+	t.HealthMessage = ""
+	if n := len(health.Log); n > 0 && health.Log[n-1].ExitCode != 0 {
+		t.HealthMessage = strings.TrimSpace(health.Log[n-1].Output)
+	}
+}
+
+func RunHealthChecks(h *HealthChecker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.CheckAll()
+	}
+}
@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+func TestHealthChecker(t *testing.T) {
+	db := dbtest.Open(t, &task.Task{}, &task.TaskEvent{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	ports := []task.PortBinding{{ContainerPort: "80", Protocol: "tcp", HostIP: host, HostPort: port}}
+
+	probe := func(path string) *task.HealthCheck {
+		return &task.HealthCheck{HTTP: &task.HTTPProbe{Port: "80", Path: path}, Retries: 1}
+	}
+	started := time.Now().Add(-time.Minute)
+
+	tasks := map[string]*task.Task{
+		"healthy":    {HealthCheck: probe("/healthz")},
+		"broken":     {HealthCheck: probe("/"), RestartPolicy: "always"},
+		"booting":    {HealthCheck: &task.HealthCheck{HTTP: &task.HTTPProbe{Port: "80", Path: "/"}, StartPeriodSeconds: 3600}},
+		"docker":     {HealthCheck: &task.HealthCheck{Cmd: []string{"pg_isready"}}},
+		"crashing":   {},
+		"crash-loop": {RestartPolicy: "always"},
+		"unchecked":  {},
+		"checked-ok": {HealthCheck: probe("/"), HealthCheckedAt: time.Now(), Health: task.HealthHealthy},
+	}
+	rt := dkrclient.NewFakeRuntime()
+	for name, tk := range tasks {
+		tk.ID = uuid.New()
+		tk.Name = name
+		tk.State = task.Running.String()
+		tk.ContainerID = "c-" + name
+		tk.Ports = ports
+		tk.StartTime = started
+		db.Create(tk)
+
+		rt.SetContainer(dkrclient.FakeContainer{ID: tk.ContainerID, Name: name, Running: true, Restarting: strings.HasPrefix(name, "crash"), ExitCode: 1})
+	}
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-docker", Name: "docker", Running: true, Health: &types.Health{
+		Status:        types.Unhealthy,
+		FailingStreak: 3,
+		Log:           []*types.HealthcheckResult{{ExitCode: 2, Output: "no response\n"}},
+	}})
+
+	requeuer := &fakeRequeuer{pending: make(map[uuid.UUID]bool)}
+	h := &HealthChecker{DB: db, Runtime: rt, Worker: requeuer}
+	h.CheckAll()
+
+	tests := []struct {
+		name    string
+		state   task.State
+		health  string
+		message string
+	}{
+		{"healthy", task.Running, task.HealthHealthy, ""},
+		{"broken", task.Scheduled, "", ""},
+		{"booting", task.Running, task.HealthStarting, "500"},
+		{"docker", task.Running, task.HealthUnhealthy, "no response"},
+		{"crashing", task.Running, task.HealthUnhealthy, "exit code 1"},
+		{"crash-loop", task.Running, task.HealthUnhealthy, "exit code 1"},
+		{"unchecked", task.Running, "", ""},
+		{"checked-ok", task.Running, task.HealthHealthy, ""},
+	}
+	for _, tt := range tests {
+		var stored task.Task
+		db.Take(&stored, tasks[tt.name].ID)
+		if stored.State != tt.state.String() || stored.Health != tt.health || !strings.Contains(stored.HealthMessage, tt.message) {
+			t.Errorf("task %v is %v and %q (%q), want %v and %q (%q)", tt.name, stored.State, stored.Health, stored.HealthMessage, tt.state, tt.health, tt.message)
+		}
+	}
+
+	var restarted task.Task
+	db.Take(&restarted, tasks["broken"].ID)
+	if restarted.Restarts != 1 || restarted.ContainerID != "" {
+		t.Errorf("restarted task has %d restarts and container %q, want 1 and none", restarted.Restarts, restarted.ContainerID)
+	}
+	if _, ok := rt.Container("c-broken"); ok {
+		t.Errorf("the container of the unhealthy task was not removed")
+	}
+	if _, ok := rt.Container("c-crash-loop"); !ok {
+		t.Errorf("the container Docker is restarting was removed")
+	}
+	if len(requeuer.added) != 1 || requeuer.added[0] != "broken" {
+		t.Errorf("queued %v, want [broken]", requeuer.added)
+	}
+}
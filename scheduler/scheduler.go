@@ -3,16 +3,48 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/pkg/metrics"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"gorm.io/gorm"
 )
 
+// DefaultStuckAfter is how long a Scheduled task may be neither queued nor
+// being started before it is queued again.
+const DefaultStuckAfter = time.Minute
+
+// Requeuer is the worker the scheduler hands tasks back to.
+type Requeuer interface {
+	AddTask(t task.Task) error
+	// Pending reports whether the task is queued or being started.
+	Pending(id uuid.UUID) (bool, error)
+}
+
+// Scheduler compares the containers Docker runs with the tasks in the
+// database every tick and brings the two back in line.
 type Scheduler struct {
+	Runtime dkrclient.Runtime
+	DB      *gorm.DB
+	Worker  Requeuer
+	// StuckAfter defaults to DefaultStuckAfter.
+	StuckAfter time.Duration
+
+	mu      sync.Mutex
+	latest  []ContainersOnLocal
+	orphans map[string]bool
 }
 
 type ContainerStats struct {
@@ -28,26 +60,260 @@ type ContainersOnLocal struct {
 	Status       string
 	Created      int64
 	Stats        ContainerStats
+	Usage        metrics.Usage
 	PortMappings string
 }
 
-func InitBackgroundScheduler() {
-	scheduler_instance := Scheduler{}
+func InitBackgroundScheduler(scheduler_instance *Scheduler) {
 	ticker := time.NewTicker(10 * time.Second)
 
 	for range ticker.C {
 		scheduler_instance.RunningDockerContainersOnMachine()
+		scheduler_instance.Reconcile()
+	}
+}
+
+// Reconcile fixes the drift between the database and Docker:
+//   - Running tasks whose container is gone, or has exited without Docker
+//     restarting it, are started again if their restart policy says so,
+//     and marked Failed otherwise.
+//   - Containers of joyboy's that no task owns are logged and counted as
+//     orphans. They are left alone.
+//   - Scheduled tasks the worker lost track of are queued again.
+//
+// Replicas of services kept in this database are left to the
+// ServiceReconciler, which replaces them rather than restarting them. A
+// worker that runs replicas for a manager has no such service, so it marks
+// those replicas Failed itself and the manager's reconciler replaces them
+// once the worker reports it.
+func (s *Scheduler) Reconcile() {
+	if s.Runtime == nil || s.DB == nil {
+		return
+	}
+
+	// Tasks are read before containers, so a task that starts in between
+	// is still Scheduled here rather than Running without a container.
+	var tasks []task.Task
+	if result := s.DB.Find(&tasks); result.Error != nil {
+		log.Printf("Failed to fetch tasks: %v\n", result.Error)
+		return
+	}
+
+	containers, err := s.Runtime.List(context.Background(), container.ListOptions{All: true, Filters: dkrclient.ManagedFilter()})
+	if err != nil {
+		// Without the list every container would look lost.
+		log.Printf("Failed to list containers: %v\n", err)
+		return
+	}
+
+	var serviceIds []uuid.UUID
+	if result := s.DB.Model(&task.Service{}).Pluck("id", &serviceIds); result.Error != nil {
+		log.Printf("Failed to fetch services: %v\n", result.Error)
+		return
+	}
+	services := make(map[uuid.UUID]bool)
+	for _, id := range serviceIds {
+		services[id] = true
+	}
+
+	running := make(map[string]bool)
+	for _, c := range containers {
+		running[c.ID] = c.State == "running" || c.State == "restarting"
+	}
+
+	for _, t := range tasks {
+		switch {
+		case t.State == task.Running.String() && !services[t.ServiceID] && t.ContainerID != "" && !running[t.ContainerID]:
+			s.checkContainer(t)
+		case t.State == task.Scheduled.String():
+			s.requeueIfStuck(t)
+		}
+	}
+
+	s.flagOrphans(containers, tasks)
+}
+
+// checkContainer looks at the container of a Running task again before
+// deciding it is lost, since the list may be out of date by now.
+func (s *Scheduler) checkContainer(t task.Task) {
+	info, err := s.Runtime.Inspect(context.Background(), t.ContainerID)
+	if errdefs.IsNotFound(err) {
+		s.containerLost(t, "container disappeared", false)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Failed to inspect container %v of task %v: %v\n", t.ContainerID, t.Name, err)
+		return
+	}
+
+	if info.State.Running || info.State.Restarting {
+		return
+	}
+	s.containerLost(t, fmt.Sprintf("container exited with code %d", info.State.ExitCode), true)
+}
+
+// containerLost restarts or fails a Running task whose container is gone or
+// exited for good. Replicas are always failed, their replacement is up to the
+// service. An exited container is removed before the task is started again,
+// or once a replica failed, so its name is free.
+func (s *Scheduler) containerLost(t task.Task, why string, exited bool) {
+	replica := t.ServiceID != uuid.Nil
+	if replica || !t.RestartsOnFailure() || s.Worker == nil {
+		log.Printf("Task %v lost its container %v: %v, marking the task as failed\n", t.Name, t.ContainerID, why)
+		t.FinishTime = time.Now().UTC()
+		if err := task.TransitionDb(s.DB, &t, task.Failed, why); err != nil {
+			log.Printf("Failed to mark task %v as failed: %v\n", t.Name, err)
+			return
+		}
+		if replica && exited {
+			s.removeContainer(t)
+		}
+		return
+	}
+
+	if exited && !s.removeContainer(t) {
+		return
+	}
+
+	log.Printf("Task %v lost its container %v: %v, starting the task again as its restart policy is %v\n", t.Name, t.ContainerID, why, t.RestartPolicy)
+	restartTask(s.DB, s.Worker, t, why)
+}
+
+// removeContainer removes the task's container, reporting whether it is gone.
+func (s *Scheduler) removeContainer(t task.Task) bool {
+	err := s.Runtime.Remove(context.Background(), t.ContainerID, container.RemoveOptions{Force: true})
+	if err != nil && !errdefs.IsNotFound(err) {
+		log.Printf("Failed to remove container %v of task %v: %v\n", t.ContainerID, t.Name, err)
+		return false
+	}
+	return true
+}
+
+// restartTask moves a Running task back to Scheduled, without its old
+// container, and queues it to be started again.
+func restartTask(db *gorm.DB, worker Requeuer, t task.Task, why string) {
+	t.ContainerID = ""
+	t.Ports = nil
+	t.PullProgress = 0
+	t.Health = ""
+	t.HealthMessage = ""
+	t.HealthFailures = 0
+	t.HealthCheckedAt = time.Time{}
+	t.Restarts++
+	reason := why + ", restarting per restart policy " + t.RestartPolicy
+	err := task.TransitionDb(db, &t, task.Scheduled, reason, "container_id", "ports", "pull_progress", "restarts",
+		"health", "health_message", "health_failures", "health_checked_at")
+	if err != nil {
+		log.Printf("Failed to reschedule task %v: %v\n", t.Name, err)
+		return
+	}
+
+	if err := worker.AddTask(t); err != nil {
+		log.Printf("Failed to queue task %v: %v\n", t.Name, err)
+	}
+}
+
+// requeueIfStuck queues a Scheduled task again when it has been Scheduled
+// for a while yet is neither queued nor being started, as happens when the
+// queue lost it.
+func (s *Scheduler) requeueIfStuck(t task.Task) {
+	if s.Worker == nil {
+		return
+	}
+
+	stuckAfter := s.StuckAfter
+	if stuckAfter <= 0 {
+		stuckAfter = DefaultStuckAfter
+	}
+
+	var last task.TaskEvent
+	result := s.DB.Where(&task.TaskEvent{TaskID: t.ID}).Order("timestamp desc").Limit(1).Find(&last)
+	if result.Error != nil {
+		log.Printf("Failed to fetch events of task %v: %v\n", t.Name, result.Error)
+		return
+	}
+	if result.RowsAffected > 0 && time.Since(last.Timestamp) < stuckAfter {
+		return
+	}
+
+	pending, err := s.Worker.Pending(t.ID)
+	if err != nil {
+		log.Printf("Failed to check whether task %v is queued: %v\n", t.Name, err)
+		return
+	}
+	if pending {
+		return
+	}
+
+	log.Printf("Task %v is stuck in Scheduled, queueing it again\n", t.Name)
+	if err := s.Worker.AddTask(t); err != nil {
+		log.Printf("Failed to queue task %v: %v\n", t.Name, err)
+		return
+	}
+	if err := task.RecordEvent(s.DB, t.ID, t.State, t.State, "requeued after being stuck"); err != nil {
+		log.Printf("Failed to record event of task %v: %v\n", t.Name, err)
 	}
 }
 
+// flagOrphans logs every container of joyboy's that no task owns the first
+// time it is seen, and keeps their count for the
+// joyboy_orphan_containers gauge. A Scheduled task owns the container with
+// its name, since it may be between creating the container and recording
+// its id.
+func (s *Scheduler) flagOrphans(containers []types.Container, tasks []task.Task) {
+	owned := make(map[string]bool)
+	for _, t := range tasks {
+		if t.ContainerID != "" {
+			owned[t.ContainerID] = true
+		}
+		if t.State == task.Scheduled.String() {
+			owned["/"+t.Name] = true
+		}
+	}
+
+	orphans := make(map[string]bool)
+	for _, c := range containers {
+		if owned[c.ID] {
+			continue
+		}
+		if len(c.Names) > 0 && owned[c.Names[0]] {
+			continue
+		}
+		orphans[c.ID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range containers {
+		if orphans[c.ID] && !s.orphans[c.ID] {
+			log.Printf("Container %v %v is labelled as joyboy's but belongs to no task\n", c.ID, c.Names)
+		}
+	}
+	s.orphans = orphans
+}
+
+// Orphans returns the ids of the containers last flagged as orphans.
+func (s *Scheduler) Orphans() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.orphans))
+	for id := range s.orphans {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
 func (s *Scheduler) RunningDockerContainersOnMachine() {
-	docker_client := dkrclient.GetPlainDockerClient()
-	if docker_client == nil {
+	if s.Runtime == nil {
 		log.Printf("Failed to get docker_client instance")
 		return
 	}
 
-	containers, err := docker_client.ContainerList(context.Background(), container.ListOptions{})
+	containers, err := s.Runtime.List(context.Background(), container.ListOptions{Filters: dkrclient.ManagedFilter()})
 	if err != nil {
 		log.Printf("Error listing containers: %v", err)
 		return
@@ -56,21 +322,19 @@ func (s *Scheduler) RunningDockerContainersOnMachine() {
 	var containerList []ContainersOnLocal
 
 	for _, c := range containers {
-		stats, err := docker_client.ContainerStats(context.Background(), c.ID, false)
-
+		stats, err := s.Runtime.Stats(context.Background(), c.ID)
 		if err != nil {
 			log.Printf("Error getting container stats for %s: %v", c.ID, err)
 			continue
 		}
-		defer stats.Body.Close()
 
-		var containerStats ContainerStats
-		if err := json.NewDecoder(stats.Body).Decode(&containerStats); err != nil {
-			log.Printf("Error decoding container stats for %s: %v", c.ID, err)
-			continue
+		containerStats := ContainerStats{
+			CPU:     stats.CPUStats,
+			Memory:  stats.MemoryStats,
+			Network: stats.Networks,
 		}
 
-		containerJSON, err := docker_client.ContainerInspect(context.Background(), c.ID)
+		containerJSON, err := s.Runtime.Inspect(context.Background(), c.ID)
 		if err != nil {
 			log.Printf("Error inspecting container %s: %v", c.ID, err)
 			continue
@@ -85,6 +349,7 @@ func (s *Scheduler) RunningDockerContainersOnMachine() {
 			Status:       c.Status,
 			Created:      c.Created,
 			Stats:        containerStats,
+			Usage:        metrics.NewUsage(stats),
 			PortMappings: portMappingsStr,
 		}
 		containerList = append(containerList, container)
@@ -94,6 +359,70 @@ func (s *Scheduler) RunningDockerContainersOnMachine() {
 		// Process container information, including port mappings
 		log.Printf("Container ID: %s, Port Mappings: %s", c.ID, c.PortMappings)
 	}
+
+	s.mu.Lock()
+	s.latest = containerList
+	s.mu.Unlock()
+}
+
+var orphansDesc = prometheus.NewDesc("joyboy_orphan_containers", "Containers labelled as joyboy's that belong to no task.", nil, nil)
+
+// usageMetrics are the usage figures reported for every container.
+var usageMetrics = []struct {
+	desc  *prometheus.Desc
+	typ   prometheus.ValueType
+	value func(u metrics.Usage) float64
+}{
+	{containerDesc("joyboy_task_cpu_percent", "Cpu used by the task's container, 100 is one full core."), prometheus.GaugeValue, func(u metrics.Usage) float64 { return u.CpuPercent }},
+	{containerDesc("joyboy_task_memory_usage_bytes", "Memory used by the task's container, without the page cache."), prometheus.GaugeValue, func(u metrics.Usage) float64 { return float64(u.MemoryUsage) }},
+	{containerDesc("joyboy_task_memory_limit_bytes", "Memory limit of the task's container."), prometheus.GaugeValue, func(u metrics.Usage) float64 { return float64(u.MemoryLimit) }},
+	{containerDesc("joyboy_task_network_receive_bytes_total", "Bytes received by the task's container."), prometheus.CounterValue, func(u metrics.Usage) float64 { return float64(u.NetworkRxBytes) }},
+	{containerDesc("joyboy_task_network_transmit_bytes_total", "Bytes sent by the task's container."), prometheus.CounterValue, func(u metrics.Usage) float64 { return float64(u.NetworkTxBytes) }},
+}
+
+func containerDesc(name string, help string) *prometheus.Desc {
+	return prometheus.NewDesc(name, help, []string{"task", "container_id"}, nil)
+}
+
+func (s *Scheduler) Describe(ch chan<- *prometheus.Desc) {
+	ch <- orphansDesc
+	for _, m := range usageMetrics {
+		ch <- m.desc
+	}
+}
+
+// Collect reports the usage of every container as of the last time they
+// were looked at.
+func (s *Scheduler) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	containers := s.latest
+	orphans := len(s.orphans)
+	s.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(orphansDesc, prometheus.GaugeValue, float64(orphans))
+
+	for _, m := range usageMetrics {
+		for _, c := range containers {
+			name, id := containerLabels(c)
+			ch <- prometheus.MustNewConstMetric(m.desc, m.typ, m.value(c.Usage), name, id)
+		}
+	}
+}
+
+// containerLabels returns the task name and short id the container's
+// metrics are labelled with.
+func containerLabels(c ContainersOnLocal) (string, string) {
+	var name string
+	if len(c.Names) > 0 {
+		name = strings.TrimPrefix(c.Names[0], "/")
+	}
+
+	id := c.ID
+	if len(id) > 12 {
+		id = id[:12]
+	}
+
+	return name, id
 }
 
 func formatPortMappings(portBindings nat.PortMap) string {
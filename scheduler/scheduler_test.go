@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+// fakeRequeuer stands in for the worker, with the ids in pending being
+// queued or started already.
+type fakeRequeuer struct {
+	mu      sync.Mutex
+	pending map[uuid.UUID]bool
+	added   []string
+}
+
+func (f *fakeRequeuer) AddTask(t task.Task) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.added = append(f.added, t.Name)
+	return nil
+}
+
+func (f *fakeRequeuer) Pending(id uuid.UUID) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pending[id], nil
+}
+
+func TestReconcile(t *testing.T) {
+	db := dbtest.Open(t, &task.Task{}, &task.TaskEvent{}, &task.Service{})
+	service := task.Service{ID: uuid.New(), Name: "web"}
+	db.Create(&service)
+
+	rt := dkrclient.NewFakeRuntime()
+	managed := container.Config{Labels: map[string]string{dkrclient.ManagedLabel: "true"}}
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-alive", Name: "alive", Config: managed, Running: true})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-orphan", Name: "orphan", Config: managed})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-starting", Name: "starting", Config: managed, Running: true})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-foreign", Name: "foreign", Running: true})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-exited", Name: "exited", Config: managed, ExitCode: 1})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-exited-always", Name: "exited-always", Config: managed, ExitCode: 137})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-exited-replica", Name: "exited-replica", Config: managed, ExitCode: 1})
+
+	tasks := map[string]*task.Task{
+		"alive":        {State: task.Running.String(), ContainerID: "c-alive"},
+		"lost":         {State: task.Running.String(), ContainerID: "c-lost"},
+		"lost-always":  {State: task.Running.String(), ContainerID: "c-lost-always", RestartPolicy: "always"},
+		"lost-retried": {State: task.Running.String(), ContainerID: "c-lost-retried", RestartPolicy: "on-failure:1", Restarts: 1},
+		"lost-replica": {State: task.Running.String(), ContainerID: "c-lost-replica", ServiceID: service.ID},
+		// Replicas a manager placed here, their service is the manager's.
+		"lost-managed":   {State: task.Running.String(), ContainerID: "c-lost-managed", ServiceID: uuid.New(), RestartPolicy: "always"},
+		"exited-replica": {State: task.Running.String(), ContainerID: "c-exited-replica", ServiceID: uuid.New()},
+		"exited":         {State: task.Running.String(), ContainerID: "c-exited", RestartPolicy: "no"},
+		"exited-always":  {State: task.Running.String(), ContainerID: "c-exited-always", RestartPolicy: "always"},
+		"starting":       {State: task.Scheduled.String()},
+		"stuck":          {State: task.Scheduled.String()},
+		"queued":         {State: task.Scheduled.String()},
+		"fresh":          {State: task.Scheduled.String()},
+	}
+	requeuer := &fakeRequeuer{pending: make(map[uuid.UUID]bool)}
+	for name, tk := range tasks {
+		tk.ID = uuid.New()
+		tk.Name = name
+		if err := db.Create(tk).Error; err != nil {
+			t.Fatalf("failed to create task %v: %v", name, err)
+		}
+
+		scheduledAt := time.Now().Add(-time.Hour)
+		if name == "fresh" {
+			scheduledAt = time.Now()
+		}
+		db.Create(&task.TaskEvent{ID: uuid.New(), TaskID: tk.ID, NewState: tk.State, Timestamp: scheduledAt})
+	}
+	requeuer.pending[tasks["queued"].ID] = true
+	requeuer.pending[tasks["starting"].ID] = true
+
+	s := &Scheduler{Runtime: rt, DB: db, Worker: requeuer}
+	s.Reconcile()
+
+	wantStates := map[string]string{
+		"alive":          task.Running.String(),
+		"lost":           task.Failed.String(),
+		"lost-always":    task.Scheduled.String(),
+		"lost-retried":   task.Failed.String(),
+		"lost-replica":   task.Running.String(),
+		"lost-managed":   task.Failed.String(),
+		"exited-replica": task.Failed.String(),
+		"exited":         task.Failed.String(),
+		"exited-always":  task.Scheduled.String(),
+		"stuck":          task.Scheduled.String(),
+	}
+	for name, want := range wantStates {
+		var got task.Task
+		db.Take(&got, tasks[name].ID)
+		if got.State != want {
+			t.Errorf("task %v is %v, want %v", name, got.State, want)
+		}
+	}
+
+	var restarted task.Task
+	db.Take(&restarted, tasks["lost-always"].ID)
+	if restarted.Restarts != 1 || restarted.ContainerID != "" {
+		t.Errorf("restarted task has %d restarts and container %q, want 1 and none", restarted.Restarts, restarted.ContainerID)
+	}
+
+	if _, ok := rt.Container("c-exited-always"); ok {
+		t.Errorf("exited container of a restarted task was not removed")
+	}
+
+	if _, ok := rt.Container("c-exited-replica"); ok {
+		t.Errorf("exited container of a failed replica was not removed")
+	}
+
+	var exited task.TaskEvent
+	db.Where("task_id = ? AND new_state = ?", tasks["exited"].ID, task.Failed.String()).Take(&exited)
+	if want := "container exited with code 1"; exited.Reason != want {
+		t.Errorf("exited task failed with %q, want %q", exited.Reason, want)
+	}
+
+	sort.Strings(requeuer.added)
+	if want := []string{"exited-always", "lost-always", "stuck"}; !reflect.DeepEqual(requeuer.added, want) {
+		t.Errorf("queued %v, want %v", requeuer.added, want)
+	}
+
+	if got, want := s.Orphans(), []string{"c-orphan"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Orphans() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,297 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/portalloc"
+	"github.com/shashank-mugiwara/joyboy/strategy"
+	scalingstrategy "github.com/shashank-mugiwara/joyboy/strategy/scaling_strategy"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"gorm.io/gorm"
+)
+
+// TaskRunner is what the reconciler hands new replicas to, and what it asks
+// to stop replicas that are no longer wanted.
+type TaskRunner interface {
+	AddTask(t task.Task) error
+	StopTask(t *task.Task) task.DockerResult
+}
+
+// ServiceReconciler keeps the replicas of every service in line with what
+// the service's scaling strategy asks for.
+type ServiceReconciler struct {
+	DB     *gorm.DB
+	Runner TaskRunner
+	// Runtime is used to find replicas whose container has died. It is nil
+	// on a manager, which learns about dead replicas from its workers
+	// instead.
+	Runtime dkrclient.Runtime
+
+	mu sync.Mutex
+}
+
+// CreateService stores the service and starts its first replicas.
+func (r *ServiceReconciler) CreateService(svc *task.Service) ([]task.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if svc.ID == uuid.Nil {
+		svc.ID = uuid.New()
+	}
+	svc.CreatedAt = time.Now().UTC()
+
+	if result := r.DB.Create(svc); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return r.reconcile(svc)
+}
+
+// DeleteService removes the service and stops all of its replicas.
+func (r *ServiceReconciler) DeleteService(id uuid.UUID) ([]task.DockerResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var svc task.Service
+	result := r.DB.Where(&task.Service{ID: id}).Take(&svc)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result := r.DB.Delete(&svc); result.Error != nil {
+		return nil, result.Error
+	}
+
+	live, err := r.liveReplicas(&svc)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []task.DockerResult
+	for _, t := range live {
+		results = append(results, r.Runner.StopTask(&task.Task{ID: t.ID}))
+	}
+
+	return results, nil
+}
+
+func (r *ServiceReconciler) ReconcileAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var services []task.Service
+	if result := r.DB.Find(&services); result.Error != nil {
+		log.Printf("Failed to fetch services: %v\n", result.Error)
+		return
+	}
+
+	for i := range services {
+		if _, err := r.reconcile(&services[i]); err != nil {
+			log.Printf("Failed to reconcile service %v: %v\n", services[i].Name, err)
+		}
+	}
+}
+
+// reconcile moves the service to the replica count its scaling strategy asks
+// for, recording a scaling event whenever that count changes. Missing
+// replicas are started on the lowest free indices, and extra ones are
+// stopped newest first, so scaling in drains the replicas that have served
+// the least. It returns the replicas it started.
+func (r *ServiceReconciler) reconcile(svc *task.Service) ([]task.Task, error) {
+	// Workers read replica usage from Docker, managers from the worker
+	// running the replica.
+	usage, _ := r.Runner.(scalingstrategy.UsageReader)
+	scaling, err := strategy.GetScalingStrategy(svc.ScalingStrategy, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := r.liveReplicas(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	decision := scaling.DesiredReplicas(*svc, live)
+	desired := clamp(decision.Replicas, svc.MinTaskScale, svc.MaxTaskScale)
+	if desired != svc.Replicas {
+		if err := r.scale(svc, desired, decision); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(live) > desired {
+		sort.Slice(live, func(i, j int) bool { return newerReplica(live[i], live[j]) })
+		for _, t := range live[:len(live)-desired] {
+			log.Printf("Stopping replica %v of service %v\n", t.Name, svc.Name)
+			if result := r.Runner.StopTask(&task.Task{ID: t.ID}); result.Error != nil {
+				log.Printf("Failed to stop replica %v: %v\n", t.Name, result.Error)
+			}
+		}
+		return nil, nil
+	}
+
+	running := make(map[int]bool)
+	for _, t := range live {
+		running[t.Replica] = true
+	}
+
+	var started []task.Task
+	for i := 0; len(live)+len(started) < desired; i++ {
+		if running[i] {
+			continue
+		}
+
+		replica, err := svc.NewReplica(i)
+		if err != nil {
+			return started, err
+		}
+
+		create := func() error { return r.DB.Create(&replica).Error }
+		if admitter, ok := r.Runner.(task.Admitter); ok {
+			err = admitter.Admit(&replica, create)
+		} else if reserver, ok := r.Runner.(portalloc.Reserver); ok {
+			err = reserver.ReservePorts(&replica, create)
+		} else {
+			err = create()
+		}
+		if err != nil {
+			return started, err
+		}
+		r.recordEvent(replica.ID, "", replica.State, "replica of service "+svc.Name+" scheduled")
+
+		log.Printf("Starting replica %v of service %v\n", replica.Name, svc.Name)
+		if err := r.Runner.AddTask(replica); err != nil {
+			return started, err
+		}
+		started = append(started, replica)
+	}
+
+	return started, nil
+}
+
+// scale stores the service's new replica count along with the event that
+// explains it.
+func (r *ServiceReconciler) scale(svc *task.Service, desired int, decision scalingstrategy.Decision) error {
+	now := time.Now().UTC()
+	event := task.ScalingEvent{
+		ID:                uuid.New(),
+		ServiceID:         svc.ID,
+		FromReplicas:      svc.Replicas,
+		ToReplicas:        desired,
+		Reason:            decision.Reason,
+		CpuUtilization:    decision.CpuUtilization,
+		MemoryUtilization: decision.MemoryUtilization,
+		Timestamp:         now,
+	}
+
+	log.Printf("Scaling service %v from %d to %d replicas: %v\n", svc.Name, svc.Replicas, desired, decision.Reason)
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Create(&event); result.Error != nil {
+			return result.Error
+		}
+
+		svc.Replicas = desired
+		svc.LastScaledAt = now
+		return tx.Model(svc).Updates(map[string]interface{}{"replicas": desired, "last_scaled_at": now}).Error
+	})
+}
+
+// newerReplica orders replicas that have not started yet before the started
+// ones, and the started ones by start time, latest first.
+func newerReplica(a task.Task, b task.Task) bool {
+	if !a.StartTime.Equal(b.StartTime) {
+		return a.StartTime.IsZero() || (!b.StartTime.IsZero() && a.StartTime.After(b.StartTime))
+	}
+	return a.Replica > b.Replica
+}
+
+// liveReplicas returns the service's Scheduled and Running replicas. Running
+// replicas whose container is gone or has exited are marked Failed and left
+// out, so they get replaced.
+func (r *ServiceReconciler) liveReplicas(svc *task.Service) ([]task.Task, error) {
+	var replicas []task.Task
+	result := r.DB.Where("service_id = ? AND state IN ?", svc.ID, []string{task.Scheduled.String(), task.Running.String()}).Find(&replicas)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var live []task.Task
+	for _, t := range replicas {
+		if t.State == task.Running.String() && !r.containerAlive(t) {
+			log.Printf("Replica %v of service %v has died\n", t.Name, svc.Name)
+			r.markDead(t)
+			continue
+		}
+		live = append(live, t)
+	}
+
+	return live, nil
+}
+
+func (r *ServiceReconciler) containerAlive(t task.Task) bool {
+	if r.Runtime == nil || t.ContainerID == "" {
+		return true
+	}
+
+	info, err := r.Runtime.Inspect(context.Background(), t.ContainerID)
+	if errdefs.IsNotFound(err) {
+		return false
+	}
+
+	if err != nil {
+		// Docker being unreachable says nothing about the replica.
+		log.Printf("Failed to inspect container %v: %v\n", t.ContainerID, err)
+		return true
+	}
+
+	return info.State.Running || info.State.Restarting
+}
+
+// markDead fails the replica and removes its container so the name is free
+// for the replacement.
+func (r *ServiceReconciler) markDead(t task.Task) {
+	t.FinishTime = time.Now().UTC()
+	if err := task.TransitionDb(r.DB, &t, task.Failed, "container is no longer running"); err != nil {
+		log.Printf("Failed to mark replica %v as failed: %v\n", t.Name, err)
+	}
+
+	err := r.Runtime.Remove(context.Background(), t.ContainerID, container.RemoveOptions{Force: true})
+	if err != nil && !errdefs.IsNotFound(err) {
+		log.Printf("Failed to remove container %v of replica %v: %v\n", t.ContainerID, t.Name, err)
+	}
+}
+
+func (r *ServiceReconciler) recordEvent(taskId uuid.UUID, from string, to string, reason string) {
+	if err := task.RecordEvent(r.DB, taskId, from, to, reason); err != nil {
+		log.Printf("Failed to record event of task %v: %v\n", taskId, err)
+	}
+}
+
+// clamp keeps n within lo and hi, a hi of zero means there is no upper bound.
+func clamp(n int, lo int, hi int) int {
+	if hi > 0 && n > hi {
+		n = hi
+	}
+	if n < lo {
+		n = lo
+	}
+	return n
+}
+
+func RunServiceReconciler(r *ServiceReconciler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.ReconcileAll()
+	}
+}
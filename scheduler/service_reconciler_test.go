@@ -0,0 +1,231 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/pkg/metrics"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"gorm.io/gorm"
+)
+
+// fakeRunner records what the reconciler asks of it and, like a worker,
+// drops the row of every task it stops.
+type fakeRunner struct {
+	db      *gorm.DB
+	mu      sync.Mutex
+	added   []task.Task
+	stopped []uuid.UUID
+}
+
+func (f *fakeRunner) AddTask(t task.Task) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.added = append(f.added, t)
+	return nil
+}
+
+func (f *fakeRunner) StopTask(t *task.Task) task.DockerResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = append(f.stopped, t.ID)
+	f.db.Delete(&task.Task{ID: t.ID})
+	return task.DockerResult{Action: "stop", Result: "success"}
+}
+
+// usageRunner also reads replica usage, the way a manager asks its workers.
+type usageRunner struct {
+	*fakeRunner
+	usage metrics.Usage
+}
+
+func (u *usageRunner) TaskUsage(ctx context.Context, t task.Task) (metrics.Usage, error) {
+	return u.usage, nil
+}
+
+func newTestReconciler(t *testing.T) (*ServiceReconciler, *fakeRunner) {
+	t.Helper()
+
+	db := dbtest.Open(t, &task.Task{}, &task.Service{}, &task.ScalingEvent{}, &task.TaskEvent{})
+
+	runner := &fakeRunner{db: db}
+	return &ServiceReconciler{DB: db, Runner: runner}, runner
+}
+
+func liveNames(t *testing.T, r *ServiceReconciler, svc *task.Service) map[string]string {
+	t.Helper()
+
+	live, err := r.liveReplicas(svc)
+	if err != nil {
+		t.Fatalf("liveReplicas() error = %v", err)
+	}
+
+	names := make(map[string]string)
+	for _, replica := range live {
+		names[replica.Name] = strings.Join(replica.PortBindings.Specs(), ",")
+	}
+	return names
+}
+
+func TestCreateServiceStartsReplicas(t *testing.T) {
+	r, runner := newTestReconciler(t)
+
+	svc := task.Service{Name: "nginx", Image: "nginx", PortBindings: task.PortBindings{{ContainerPort: "80", HostPort: "8211"}}, MinTaskScale: 3, MaxTaskScale: 3}
+	started, err := r.CreateService(&svc)
+	if err != nil {
+		t.Fatalf("CreateService() error = %v", err)
+	}
+
+	if len(started) != 3 || len(runner.added) != 3 {
+		t.Fatalf("replicas started = %d, handed to runner = %d, want 3", len(started), len(runner.added))
+	}
+
+	want := map[string]string{
+		"nginx-0": ":8211:80/tcp",
+		"nginx-1": ":8212:80/tcp",
+		"nginx-2": ":8213:80/tcp",
+	}
+	got := liveNames(t, r, &svc)
+	for name, ports := range want {
+		if got[name] != ports {
+			t.Errorf("replica %s ports = %q, want %q", name, got[name], ports)
+		}
+	}
+
+	if svc.Replicas != 3 {
+		t.Errorf("service replicas = %d, want 3", svc.Replicas)
+	}
+}
+
+func TestReconcileReplacesDeadReplicas(t *testing.T) {
+	r, runner := newTestReconciler(t)
+
+	svc := task.Service{Name: "redis", Image: "redis", MinTaskScale: 2}
+	started, err := r.CreateService(&svc)
+	if err != nil {
+		t.Fatalf("CreateService() error = %v", err)
+	}
+
+	r.DB.Model(&task.Task{ID: started[1].ID}).Update("state", task.Failed.String())
+	r.ReconcileAll()
+
+	if len(runner.added) != 3 {
+		t.Fatalf("replicas handed to runner = %d, want 3", len(runner.added))
+	}
+
+	replacement := runner.added[2]
+	if replacement.Name != "redis-1" || replacement.ID == started[1].ID {
+		t.Errorf("replacement = %s (%v), want a new task named redis-1", replacement.Name, replacement.ID)
+	}
+
+	if got := liveNames(t, r, &svc); len(got) != 2 {
+		t.Errorf("live replicas = %v, want 2", got)
+	}
+
+	// Nothing changed since, so another round must not start anything.
+	r.ReconcileAll()
+	if len(runner.added) != 3 {
+		t.Errorf("replicas handed to runner after a quiet round = %d, want 3", len(runner.added))
+	}
+}
+
+func TestReconcileStopsExtraReplicasNewestFirst(t *testing.T) {
+	r, runner := newTestReconciler(t)
+
+	svc := task.Service{Name: "api", Image: "api", MinTaskScale: 3, MaxTaskScale: 3}
+	started, err := r.CreateService(&svc)
+	if err != nil {
+		t.Fatalf("CreateService() error = %v", err)
+	}
+
+	r.DB.Model(&svc).Updates(map[string]interface{}{"min_task_scale": 1, "max_task_scale": 1})
+	r.ReconcileAll()
+
+	if len(runner.stopped) != 2 {
+		t.Fatalf("replicas stopped = %d, want 2", len(runner.stopped))
+	}
+	if runner.stopped[0] != started[2].ID || runner.stopped[1] != started[1].ID {
+		t.Errorf("stopped = %v, want %v then %v", runner.stopped, started[2].ID, started[1].ID)
+	}
+}
+
+func TestDeleteServiceStopsReplicas(t *testing.T) {
+	r, runner := newTestReconciler(t)
+
+	svc := task.Service{Name: "web", Image: "web", MinTaskScale: 2}
+	if _, err := r.CreateService(&svc); err != nil {
+		t.Fatalf("CreateService() error = %v", err)
+	}
+
+	if _, err := r.DeleteService(svc.ID); err != nil {
+		t.Fatalf("DeleteService() error = %v", err)
+	}
+
+	if len(runner.stopped) != 2 {
+		t.Errorf("replicas stopped = %d, want 2", len(runner.stopped))
+	}
+
+	r.ReconcileAll()
+	if len(runner.added) != 2 {
+		t.Errorf("replicas started after delete = %d, want none", len(runner.added)-2)
+	}
+}
+
+func TestReconcileDrainsNewestStartedReplicas(t *testing.T) {
+	r, runner := newTestReconciler(t)
+
+	svc := task.Service{Name: "worker", Image: "worker", MinTaskScale: 3, MaxTaskScale: 3}
+	started, err := r.CreateService(&svc)
+	if err != nil {
+		t.Fatalf("CreateService() error = %v", err)
+	}
+
+	// Replica 0 was replaced most recently, so it is the newest.
+	now := time.Now().UTC()
+	for i, age := range []time.Duration{0, 2 * time.Hour, time.Hour} {
+		r.DB.Model(&task.Task{ID: started[i].ID}).Updates(task.Task{State: task.Running.String(), StartTime: now.Add(-age)})
+	}
+
+	r.DB.Model(&svc).Updates(map[string]interface{}{"min_task_scale": 1, "max_task_scale": 1})
+	r.ReconcileAll()
+
+	if len(runner.stopped) != 2 || runner.stopped[0] != started[0].ID || runner.stopped[1] != started[2].ID {
+		t.Errorf("stopped = %v, want %v then %v", runner.stopped, started[0].ID, started[2].ID)
+	}
+
+	var events []task.ScalingEvent
+	r.DB.Where("service_id = ?", svc.ID).Order("timestamp").Find(&events)
+	if len(events) != 2 {
+		t.Fatalf("scaling events = %d, want 2", len(events))
+	}
+	if events[0].FromReplicas != 0 || events[0].ToReplicas != 3 || events[1].FromReplicas != 3 || events[1].ToReplicas != 1 {
+		t.Errorf("scaling events = %+v, want 0 to 3 then 3 to 1", events)
+	}
+	if events[1].Reason == "" {
+		t.Errorf("scaling event has no reason")
+	}
+}
+
+func TestReconcileScalesOnRunnerUsage(t *testing.T) {
+	r, runner := newTestReconciler(t)
+	r.Runner = &usageRunner{fakeRunner: runner, usage: metrics.Usage{CpuPercent: 100, OnlineCpus: 1}}
+
+	svc := task.Service{Name: "api", Image: "api", MinTaskScale: 1, MaxTaskScale: 4, ScalingStrategy: "dynamic", TargetCpuUtilization: 50}
+	started, err := r.CreateService(&svc)
+	if err != nil {
+		t.Fatalf("CreateService() error = %v", err)
+	}
+
+	r.DB.Model(&task.Task{ID: started[0].ID}).Updates(task.Task{State: task.Running.String(), ContainerID: "c-api-0"})
+	r.DB.Model(&svc).Update("last_scaled_at", time.Now().Add(-time.Hour))
+	r.ReconcileAll()
+
+	if len(runner.added) != 2 {
+		t.Errorf("replicas handed to runner = %d, want 2 after scaling out on cpu", len(runner.added))
+	}
+}
@@ -0,0 +1,61 @@
+package placementstrategy
+
+import (
+	"math"
+
+	"github.com/shashank-mugiwara/joyboy/node"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+// LIEB is the base of the E-PVM marginal cost function.
+const LIEB = 1.53960071783900203869
+
+// Epvm scores candidates with the marginal cost model of the Enhanced
+// Parallel Virtual Machine. Every resource costs LIEB to the power of its
+// utilisation, so the cost of a task is how much it raises that sum on a
+// node. Memory and cpu load are weighed equally and the cheapest node wins.
+type Epvm struct{}
+
+func (e *Epvm) SelectNode(t task.Task, nodes []node.Node) (node.Node, error) {
+	candidates := Candidates(t, nodes)
+	if len(candidates) == 0 {
+		return node.Node{}, ErrNoCandidates
+	}
+
+	selected := candidates[0]
+	lowestCost := epvmCost(t, selected)
+	for _, n := range candidates[1:] {
+		cost := epvmCost(t, n)
+		if cost < lowestCost {
+			selected = n
+			lowestCost = cost
+		}
+	}
+
+	return selected, nil
+}
+
+func epvmCost(t task.Task, n node.Node) float64 {
+	var cost float64
+
+	if n.Memory > 0 {
+		memUsed := float64(n.MemoryAllocated) / float64(n.Memory)
+		memAfter := float64(n.MemoryAllocated+int(t.Memory)) / float64(n.Memory)
+		cost += math.Pow(LIEB, memAfter) - math.Pow(LIEB, memUsed)
+	}
+
+	// Load is spread over the cores, and a task is expected to add the
+	// cpus it asked for, or one full core when it did not ask.
+	cores := float64(n.Cores)
+	if cores == 0 {
+		cores = 1
+	}
+
+	taskLoad := float64(t.Cpus)
+	if taskLoad == 0 {
+		taskLoad = 1
+	}
+
+	cost += math.Pow(LIEB, (n.Load+taskLoad)/cores) - math.Pow(LIEB, n.Load/cores)
+	return cost
+}
@@ -0,0 +1,35 @@
+package placementstrategy
+
+import (
+	"github.com/shashank-mugiwara/joyboy/node"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+// LeastLoaded picks the candidate running the fewest tasks. Ties go to the
+// node with the larger share of its memory still free.
+type LeastLoaded struct{}
+
+func (l *LeastLoaded) SelectNode(t task.Task, nodes []node.Node) (node.Node, error) {
+	candidates := Candidates(t, nodes)
+	if len(candidates) == 0 {
+		return node.Node{}, ErrNoCandidates
+	}
+
+	selected := candidates[0]
+	for _, n := range candidates[1:] {
+		if n.TaskCount < selected.TaskCount ||
+			(n.TaskCount == selected.TaskCount && freeMemoryShare(n) > freeMemoryShare(selected)) {
+			selected = n
+		}
+	}
+
+	return selected, nil
+}
+
+func freeMemoryShare(n node.Node) float64 {
+	if n.Memory == 0 {
+		return 0
+	}
+
+	return float64(n.Memory-n.MemoryAllocated) / float64(n.Memory)
+}
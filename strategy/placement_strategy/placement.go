@@ -0,0 +1,39 @@
+package placementstrategy
+
+import (
+	"errors"
+
+	"github.com/shashank-mugiwara/joyboy/node"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+var ErrNoCandidates = errors.New("no node has enough resources left for the task")
+
+// PlacementStrategy picks the node a task should run on.
+type PlacementStrategy interface {
+	SelectNode(t task.Task, nodes []node.Node) (node.Node, error)
+}
+
+// Candidates returns the nodes that have enough memory, disk and cores left
+// for the task. A node that does not know its own size is always a
+// candidate.
+func Candidates(t task.Task, nodes []node.Node) []node.Node {
+	var candidates []node.Node
+	for _, n := range nodes {
+		if n.Memory > 0 && t.Memory > int64(n.Memory-n.MemoryAllocated) {
+			continue
+		}
+
+		if n.Disk > 0 && t.Disk > int64(n.Disk-n.DiskAllocated) {
+			continue
+		}
+
+		if n.Cores > 0 && t.Cpus > float32(n.Cores) {
+			continue
+		}
+
+		candidates = append(candidates, n)
+	}
+
+	return candidates
+}
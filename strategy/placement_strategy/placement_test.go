@@ -0,0 +1,248 @@
+package placementstrategy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shashank-mugiwara/joyboy/node"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+var (
+	idleNode   = node.Node{Name: "idle", Cores: 4, Memory: 8192, Disk: 100000}
+	busyNode   = node.Node{Name: "busy", Cores: 4, Memory: 8192, MemoryAllocated: 6144, Disk: 100000, Load: 3.5, TaskCount: 6}
+	smallNode  = node.Node{Name: "small", Cores: 1, Memory: 1024, MemoryAllocated: 256, Disk: 20000, TaskCount: 1}
+	fullNode   = node.Node{Name: "full", Cores: 8, Memory: 4096, MemoryAllocated: 4096, Disk: 100000, TaskCount: 2}
+	noDiskNode = node.Node{Name: "nodisk", Cores: 4, Memory: 8192, Disk: 1000, DiskAllocated: 900}
+)
+
+func TestCandidates(t *testing.T) {
+	tests := []struct {
+		name  string
+		task  task.Task
+		nodes []node.Node
+		want  []string
+	}{
+		{
+			name:  "no requirements",
+			task:  task.Task{},
+			nodes: []node.Node{idleNode, fullNode},
+			want:  []string{"idle", "full"},
+		},
+		{
+			name:  "memory filters full node",
+			task:  task.Task{Memory: 512},
+			nodes: []node.Node{idleNode, fullNode, smallNode},
+			want:  []string{"idle", "small"},
+		},
+		{
+			name:  "cpus filter small node",
+			task:  task.Task{Cpus: 2},
+			nodes: []node.Node{smallNode, idleNode},
+			want:  []string{"idle"},
+		},
+		{
+			name:  "disk filters node",
+			task:  task.Task{Disk: 500},
+			nodes: []node.Node{noDiskNode, idleNode},
+			want:  []string{"idle"},
+		},
+		{
+			name:  "node without stats is a candidate",
+			task:  task.Task{Memory: 512, Cpus: 2},
+			nodes: []node.Node{{Name: "unknown"}},
+			want:  []string{"unknown"},
+		},
+		{
+			name:  "nothing fits",
+			task:  task.Task{Memory: 16384},
+			nodes: []node.Node{idleNode, busyNode},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(Candidates(tt.task, tt.nodes))
+			if !equal(got, tt.want) {
+				t.Errorf("Candidates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	tests := []struct {
+		name  string
+		task  task.Task
+		nodes []node.Node
+		want  []string
+	}{
+		{
+			name:  "cycles through nodes",
+			nodes: []node.Node{idleNode, busyNode, smallNode},
+			want:  []string{"idle", "busy", "small", "idle"},
+		},
+		{
+			name:  "skips nodes that cannot fit",
+			task:  task.Task{Memory: 2048},
+			nodes: []node.Node{idleNode, smallNode, busyNode},
+			want:  []string{"idle", "busy", "idle"},
+		},
+		{
+			name:  "single node",
+			nodes: []node.Node{smallNode},
+			want:  []string{"small", "small"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RoundRobin{}
+			for i, want := range tt.want {
+				got, err := r.SelectNode(tt.task, tt.nodes)
+				if err != nil {
+					t.Fatalf("SelectNode() error = %v", err)
+				}
+				if got.Name != want {
+					t.Errorf("SelectNode() call %d = %v, want %v", i, got.Name, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLeastLoaded(t *testing.T) {
+	tests := []struct {
+		name  string
+		task  task.Task
+		nodes []node.Node
+		want  string
+	}{
+		{
+			name:  "fewest tasks",
+			nodes: []node.Node{busyNode, smallNode, idleNode},
+			want:  "idle",
+		},
+		{
+			name: "tie goes to more free memory",
+			nodes: []node.Node{
+				{Name: "a", Memory: 4096, MemoryAllocated: 2048, TaskCount: 1},
+				{Name: "b", Memory: 4096, MemoryAllocated: 1024, TaskCount: 1},
+			},
+			want: "b",
+		},
+		{
+			name:  "least loaded cannot fit",
+			task:  task.Task{Cpus: 2},
+			nodes: []node.Node{smallNode, busyNode},
+			want:  "busy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&LeastLoaded{}).SelectNode(tt.task, tt.nodes)
+			if err != nil {
+				t.Fatalf("SelectNode() error = %v", err)
+			}
+			if got.Name != tt.want {
+				t.Errorf("SelectNode() = %v, want %v", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestEpvm(t *testing.T) {
+	tests := []struct {
+		name  string
+		task  task.Task
+		nodes []node.Node
+		want  string
+	}{
+		{
+			name:  "idle node is cheapest",
+			task:  task.Task{Memory: 512, Cpus: 1},
+			nodes: []node.Node{busyNode, idleNode},
+			want:  "idle",
+		},
+		{
+			name: "more cores absorb the load",
+			task: task.Task{Cpus: 1},
+			nodes: []node.Node{
+				{Name: "two", Cores: 2, Memory: 4096, Load: 1},
+				{Name: "eight", Cores: 8, Memory: 4096, Load: 1},
+			},
+			want: "eight",
+		},
+		{
+			name: "memory pressure outweighs equal load",
+			task: task.Task{Memory: 1024},
+			nodes: []node.Node{
+				{Name: "tight", Cores: 4, Memory: 4096, MemoryAllocated: 3000, Load: 1},
+				{Name: "roomy", Cores: 4, Memory: 4096, MemoryAllocated: 500, Load: 1},
+			},
+			want: "roomy",
+		},
+		{
+			name:  "only candidate",
+			task:  task.Task{Memory: 4096},
+			nodes: []node.Node{smallNode, idleNode},
+			want:  "idle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&Epvm{}).SelectNode(tt.task, tt.nodes)
+			if err != nil {
+				t.Fatalf("SelectNode() error = %v", err)
+			}
+			if got.Name != tt.want {
+				t.Errorf("SelectNode() = %v, want %v", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoCandidates(t *testing.T) {
+	strategies := map[string]PlacementStrategy{
+		"roundrobin":  &RoundRobin{},
+		"leastloaded": &LeastLoaded{},
+		"epvm":        &Epvm{},
+	}
+
+	for name, s := range strategies {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.SelectNode(task.Task{Memory: 1 << 20}, []node.Node{idleNode, smallNode})
+			if !errors.Is(err, ErrNoCandidates) {
+				t.Errorf("SelectNode() error = %v, want %v", err, ErrNoCandidates)
+			}
+
+			_, err = s.SelectNode(task.Task{}, nil)
+			if !errors.Is(err, ErrNoCandidates) {
+				t.Errorf("SelectNode() with no nodes error = %v, want %v", err, ErrNoCandidates)
+			}
+		})
+	}
+}
+
+func names(nodes []node.Node) []string {
+	var result []string
+	for _, n := range nodes {
+		result = append(result, n.Name)
+	}
+	return result
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
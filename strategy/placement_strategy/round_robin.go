@@ -0,0 +1,28 @@
+package placementstrategy
+
+import (
+	"sync"
+
+	"github.com/shashank-mugiwara/joyboy/node"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+// RoundRobin hands out the candidate nodes in turn.
+type RoundRobin struct {
+	next int
+	mu   sync.Mutex
+}
+
+func (r *RoundRobin) SelectNode(t task.Task, nodes []node.Node) (node.Node, error) {
+	candidates := Candidates(t, nodes)
+	if len(candidates) == 0 {
+		return node.Node{}, ErrNoCandidates
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	selected := candidates[r.next%len(candidates)]
+	r.next++
+	return selected, nil
+}
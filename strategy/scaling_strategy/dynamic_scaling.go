@@ -1 +1,160 @@
 package scalingstrategy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/shashank-mugiwara/joyboy/pkg/metrics"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+const (
+	DefaultScaleUpCooldown   = time.Minute
+	DefaultScaleDownCooldown = 5 * time.Minute
+
+	// Utilisation within this fraction of the target counts as on target, so
+	// the replica count does not flap around it.
+	tolerance = 0.1
+)
+
+// DynamicScaling sizes a service so the average cpu and memory utilisation
+// of its replicas stays near the service's targets. The count it asks for
+// is the current one scaled by utilisation over target, taking the larger
+// answer of cpu and memory, so a service is only scaled in when neither
+// needs the replicas. Scaling out is held back for ScaleUpCooldown after the
+// last change and scaling in for ScaleDownCooldown.
+type DynamicScaling struct {
+	// Usage reads what the replicas are using. Without it no replica is
+	// sampled and the count is kept.
+	Usage UsageReader
+	Now   func() time.Time
+}
+
+// UsageReader reads what a task's container is using. A worker reads it from
+// Docker, a manager asks the worker that runs the task.
+type UsageReader interface {
+	TaskUsage(ctx context.Context, t task.Task) (metrics.Usage, error)
+}
+
+func (d *DynamicScaling) DesiredReplicas(svc task.Service, live []task.Task) Decision {
+	current := svc.Replicas
+	if current == 0 {
+		return Decision{
+			Replicas: svc.MinTaskScale,
+			Reason:   fmt.Sprintf("starting with the minimum of %d replicas", svc.MinTaskScale),
+		}
+	}
+
+	cpu, memory, sampled := d.utilization(live)
+	if sampled == 0 {
+		return Decision{
+			Replicas: current,
+			Reason:   "no replica metrics available",
+		}
+	}
+
+	decision := Decision{CpuUtilization: cpu, MemoryUtilization: memory}
+
+	var reasons []string
+	desired := 0
+	if svc.TargetCpuUtilization > 0 {
+		desired = max(desired, scaleTo(current, cpu, svc.TargetCpuUtilization))
+		reasons = append(reasons, fmt.Sprintf("cpu at %.1f%% against a target of %.1f%%", cpu, svc.TargetCpuUtilization))
+	}
+	if svc.TargetMemoryUtilization > 0 {
+		desired = max(desired, scaleTo(current, memory, svc.TargetMemoryUtilization))
+		reasons = append(reasons, fmt.Sprintf("memory at %.1f%% against a target of %.1f%%", memory, svc.TargetMemoryUtilization))
+	}
+	if len(reasons) == 0 {
+		decision.Replicas = current
+		decision.Reason = "no utilisation target set"
+		return decision
+	}
+
+	if svc.MaxTaskScale > 0 && desired > svc.MaxTaskScale {
+		desired = svc.MaxTaskScale
+	}
+	if desired < svc.MinTaskScale {
+		desired = svc.MinTaskScale
+	}
+
+	reason := strings.Join(reasons, ", ")
+	sinceLastScale := d.now().Sub(svc.LastScaledAt)
+
+	switch {
+	case desired > current && sinceLastScale < cooldown(svc.ScaleUpCooldown, DefaultScaleUpCooldown):
+		decision.Replicas = current
+		decision.Reason = fmt.Sprintf("%s, scaling out to %d held back by cooldown", reason, desired)
+	case desired < current && sinceLastScale < cooldown(svc.ScaleDownCooldown, DefaultScaleDownCooldown):
+		decision.Replicas = current
+		decision.Reason = fmt.Sprintf("%s, scaling in to %d held back by cooldown", reason, desired)
+	default:
+		decision.Replicas = desired
+		decision.Reason = reason
+	}
+
+	return decision
+}
+
+// utilization averages the cpu and memory utilisation of the replicas whose
+// stats could be read. Cpu is measured against the replica's cpu limit, or
+// all of the host's cpus when it has none.
+func (d *DynamicScaling) utilization(live []task.Task) (float64, float64, int) {
+	var cpuSum, memorySum float64
+	sampled := 0
+
+	for _, t := range live {
+		if t.ContainerID == "" || d.Usage == nil {
+			continue
+		}
+
+		usage, err := d.Usage.TaskUsage(context.Background(), t)
+		if err != nil {
+			log.Printf("Failed to poll metrics of replica %v: %v\n", t.Name, err)
+			continue
+		}
+
+		cpus := float64(t.Cpus)
+		if cpus <= 0 {
+			cpus = float64(usage.OnlineCpus)
+		}
+		if cpus > 0 {
+			cpuSum += usage.CpuPercent / cpus
+		}
+		memorySum += usage.MemoryPercent
+		sampled++
+	}
+
+	if sampled == 0 {
+		return 0, 0, 0
+	}
+	return cpuSum / float64(sampled), memorySum / float64(sampled), sampled
+}
+
+func (d *DynamicScaling) now() time.Time {
+	if d.Now == nil {
+		return time.Now()
+	}
+	return d.Now()
+}
+
+// scaleTo is the replica count that brings utilisation back to target if the
+// load spreads evenly over the replicas.
+func scaleTo(current int, utilization float64, target float64) int {
+	ratio := utilization / target
+	if math.Abs(ratio-1) <= tolerance {
+		return current
+	}
+	return int(math.Ceil(float64(current) * ratio))
+}
+
+func cooldown(seconds int, fallback time.Duration) time.Duration {
+	if seconds <= 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
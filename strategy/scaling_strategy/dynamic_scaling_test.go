@@ -0,0 +1,104 @@
+package scalingstrategy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/pkg/metrics"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+// usage builds a stats reading of a container on two cpus using the given
+// percent of one cpu and of its memory limit.
+func usage(cpuPercent float64, memoryPercent float64) types.StatsJSON {
+	var stat types.StatsJSON
+	stat.PreCPUStats.CPUUsage.TotalUsage = 1000
+	stat.PreCPUStats.SystemUsage = 100000
+	stat.CPUStats.CPUUsage.TotalUsage = 1000 + uint64(cpuPercent*500)
+	stat.CPUStats.SystemUsage = 200000
+	stat.CPUStats.OnlineCPUs = 2
+	stat.MemoryStats.Limit = 1000
+	stat.MemoryStats.Usage = uint64(memoryPercent * 10)
+	return stat
+}
+
+// fakeUsage reads the usage of the containers it holds stats for.
+type fakeUsage map[string]types.StatsJSON
+
+func (f fakeUsage) TaskUsage(ctx context.Context, t task.Task) (metrics.Usage, error) {
+	stat, ok := f[t.ContainerID]
+	if !ok {
+		return metrics.Usage{}, errors.New("no such container")
+	}
+	return metrics.NewUsage(stat), nil
+}
+
+func TestDynamicScaling(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	longAgo := now.Add(-time.Hour)
+
+	base := task.Service{
+		MinTaskScale:            1,
+		MaxTaskScale:            6,
+		Replicas:                2,
+		TargetCpuUtilization:    50,
+		TargetMemoryUtilization: 80,
+		LastScaledAt:            longAgo,
+	}
+
+	tests := []struct {
+		name   string
+		svc    func(s *task.Service)
+		stats  []types.StatsJSON
+		failed bool
+		want   int
+	}{
+		{name: "on target", stats: []types.StatsJSON{usage(100, 40), usage(100, 40)}, want: 2},
+		{name: "within tolerance", stats: []types.StatsJSON{usage(108, 40), usage(108, 40)}, want: 2},
+		{name: "cpu above target", stats: []types.StatsJSON{usage(200, 40), usage(200, 40)}, want: 4},
+		{name: "memory above target", stats: []types.StatsJSON{usage(100, 100), usage(100, 100)}, want: 3},
+		{name: "capped at max", stats: []types.StatsJSON{usage(200, 40), usage(200, 40)}, svc: func(s *task.Service) { s.MaxTaskScale = 3 }, want: 3},
+		{name: "scale in when both are low", stats: []types.StatsJSON{usage(20, 10), usage(20, 10)}, want: 1},
+		{name: "memory keeps replicas cpu does not need", stats: []types.StatsJSON{usage(20, 80), usage(20, 80)}, want: 2},
+		{name: "not below min", stats: []types.StatsJSON{usage(0, 0), usage(0, 0)}, svc: func(s *task.Service) { s.MinTaskScale = 2 }, want: 2},
+		{name: "scale out cooldown", stats: []types.StatsJSON{usage(200, 40), usage(200, 40)}, svc: func(s *task.Service) { s.LastScaledAt = now.Add(-30 * time.Second) }, want: 2},
+		{name: "scale in cooldown", stats: []types.StatsJSON{usage(20, 10), usage(20, 10)}, svc: func(s *task.Service) { s.LastScaledAt = now.Add(-2 * time.Minute) }, want: 2},
+		{name: "custom cooldown passed", stats: []types.StatsJSON{usage(20, 10), usage(20, 10)}, svc: func(s *task.Service) { s.LastScaledAt = now.Add(-2 * time.Minute); s.ScaleDownCooldown = 60 }, want: 1},
+		{name: "no metrics", failed: true, want: 2},
+		{name: "new service", svc: func(s *task.Service) { s.Replicas = 0 }, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := base
+			if tt.svc != nil {
+				tt.svc(&svc)
+			}
+
+			stats := make(fakeUsage)
+			var live []task.Task
+			for i, stat := range tt.stats {
+				id := uuid.NewString()
+				stats[id] = stat
+				live = append(live, task.Task{Name: "replica", ContainerID: id, Replica: i, Cpus: 2})
+			}
+			if tt.failed {
+				live = append(live, task.Task{Name: "replica", ContainerID: "gone"})
+			}
+
+			d := &DynamicScaling{Usage: stats, Now: func() time.Time { return now }}
+
+			got := d.DesiredReplicas(svc, live)
+			if got.Replicas != tt.want {
+				t.Errorf("DesiredReplicas() = %d (%s), want %d", got.Replicas, got.Reason, tt.want)
+			}
+			if got.Reason == "" {
+				t.Errorf("DesiredReplicas() gave no reason")
+			}
+		})
+	}
+}
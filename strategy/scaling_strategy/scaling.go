@@ -0,0 +1,23 @@
+package scalingstrategy
+
+import "github.com/shashank-mugiwara/joyboy/task"
+
+// ScalingStrategy decides how many replicas a service should be running.
+// live holds the replicas that are currently Scheduled or Running. The
+// answer is clamped to the service's MinTaskScale and MaxTaskScale by the
+// caller.
+type ScalingStrategy interface {
+	DesiredReplicas(svc task.Service, live []task.Task) Decision
+}
+
+// Decision is a strategy's answer along with why it was given. The reason
+// and the utilisation it was based on end up in the service's scaling
+// events.
+type Decision struct {
+	Replicas int
+	Reason   string
+	// CpuUtilization and MemoryUtilization are the average utilisation of
+	// the live replicas in percent, zero when they were not looked at.
+	CpuUtilization    float64
+	MemoryUtilization float64
+}
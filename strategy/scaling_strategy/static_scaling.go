@@ -1 +1,17 @@
 package scalingstrategy
+
+import (
+	"fmt"
+
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+// StaticScaling keeps exactly MinTaskScale replicas running.
+type StaticScaling struct{}
+
+func (s *StaticScaling) DesiredReplicas(svc task.Service, live []task.Task) Decision {
+	return Decision{
+		Replicas: svc.MinTaskScale,
+		Reason:   fmt.Sprintf("static scaling keeps %d replicas", svc.MinTaskScale),
+	}
+}
@@ -1,7 +1,37 @@
 package strategy
 
-func GetScalingStrategy() {
+import (
+	"fmt"
+
+	placementstrategy "github.com/shashank-mugiwara/joyboy/strategy/placement_strategy"
+	scalingstrategy "github.com/shashank-mugiwara/joyboy/strategy/scaling_strategy"
+)
+
+// GetScalingStrategy returns the scaling strategy registered under the given
+// name, reading replica usage through usage where it needs to. An empty name
+// falls back to static scaling.
+func GetScalingStrategy(name string, usage scalingstrategy.UsageReader) (scalingstrategy.ScalingStrategy, error) {
+	switch name {
+	case "", "static":
+		return &scalingstrategy.StaticScaling{}, nil
+	case "dynamic":
+		return &scalingstrategy.DynamicScaling{Usage: usage}, nil
+	default:
+		return nil, fmt.Errorf("unknown scaling strategy %q", name)
+	}
 }
 
-func GetImplementationStrategy() {
+// GetImplementationStrategy returns the placement strategy registered under
+// the given name. An empty name falls back to round-robin.
+func GetImplementationStrategy(name string) (placementstrategy.PlacementStrategy, error) {
+	switch name {
+	case "", "roundrobin":
+		return &placementstrategy.RoundRobin{}, nil
+	case "leastloaded":
+		return &placementstrategy.LeastLoaded{}, nil
+	case "epvm":
+		return &placementstrategy.Epvm{}, nil
+	default:
+		return nil, fmt.Errorf("unknown placement strategy %q", name)
+	}
 }
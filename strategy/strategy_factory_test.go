@@ -0,0 +1,57 @@
+package strategy
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetImplementationStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantType string
+		wantErr  bool
+	}{
+		{name: "", wantType: "*placementstrategy.RoundRobin"},
+		{name: "roundrobin", wantType: "*placementstrategy.RoundRobin"},
+		{name: "leastloaded", wantType: "*placementstrategy.LeastLoaded"},
+		{name: "epvm", wantType: "*placementstrategy.Epvm"},
+		{name: "random", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetImplementationStrategy(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetImplementationStrategy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && fmt.Sprintf("%T", got) != tt.wantType {
+				t.Errorf("GetImplementationStrategy() = %T, want %v", got, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestGetScalingStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantType string
+		wantErr  bool
+	}{
+		{name: "", wantType: "*scalingstrategy.StaticScaling"},
+		{name: "static", wantType: "*scalingstrategy.StaticScaling"},
+		{name: "dynamic", wantType: "*scalingstrategy.DynamicScaling"},
+		{name: "random", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetScalingStrategy(tt.name, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetScalingStrategy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && fmt.Sprintf("%T", got) != tt.wantType {
+				t.Errorf("GetScalingStrategy() = %T, want %v", got, tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package task
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RegistryCredential is a login for a private image registry. Tasks refer to
+// it by name, the password is never sent back by the API.
+type RegistryCredential struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name" gorm:"uniqueIndex"`
+	// Server is the registry's address, such as registry.gitlab.com.
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	// SealedPassword is the password encrypted with the operator's key, see
+	// SetPassword.
+	SealedPassword string    `json:"-" gorm:"column:password"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// ErrNoCredentialKey is returned when a registry password has to be
+// encrypted or decrypted but no key was configured.
+var ErrNoCredentialKey = errors.New("no key for registry passwords is configured")
+
+// sealedPrefix marks passwords that are encrypted, telling them apart from
+// those stored before they were.
+const sealedPrefix = "sealed:"
+
+// LoadCredentialKey reads the key registry passwords are encrypted with from
+// a file holding 32 base64 encoded bytes. Without a path there is no key.
+func LoadCredentialKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential key: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode credential key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("credential key is %d bytes, want 32", len(key))
+	}
+	return key, nil
+}
+
+func newCredentialCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, ErrNoCredentialKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SetPassword encrypts the password with AES-GCM, bound to the credential's
+// name so a sealed password cannot be copied onto another credential.
+func (c *RegistryCredential) SetPassword(key []byte, password string) error {
+	aead, err := newCredentialCipher(key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(password), []byte(c.Name))
+	c.SealedPassword = sealedPrefix + base64.StdEncoding.EncodeToString(sealed)
+	return nil
+}
+
+// Password decrypts the password. Passwords stored before they were
+// encrypted are returned as they are.
+func (c RegistryCredential) Password(key []byte) (string, error) {
+	encoded, ok := strings.CutPrefix(c.SealedPassword, sealedPrefix)
+	if !ok {
+		return c.SealedPassword, nil
+	}
+
+	aead, err := newCredentialCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("password of registry credential %s is corrupt", c.Name)
+	}
+
+	password, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(c.Name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt password of registry credential %s, was the key changed?", c.Name)
+	}
+	return string(password), nil
+}
+
+// SealRegistryCredentials encrypts the passwords that were stored before
+// there was a key, returning how many it encrypted.
+func SealRegistryCredentials(db *gorm.DB, key []byte) (int, error) {
+	var creds []RegistryCredential
+	if result := db.Where("password NOT LIKE ?", sealedPrefix+"%").Find(&creds); result.Error != nil {
+		return 0, result.Error
+	}
+
+	for i, cred := range creds {
+		if err := cred.SetPassword(key, cred.SealedPassword); err != nil {
+			return i, err
+		}
+		if result := db.Model(&cred).Update("password", cred.SealedPassword); result.Error != nil {
+			return i, result.Error
+		}
+	}
+	return len(creds), nil
+}
+
+// ErrCredentialNotFound is returned when a task names a registry credential
+// that does not exist.
+var ErrCredentialNotFound = errors.New("registry credential not found")
+
+var credentialNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ValidateCredentialName checks a registry credential name, which also has to
+// be valid in a URL path.
+func ValidateCredentialName(name string) error {
+	if !credentialNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid registry credential name %q, only letters, digits, '_', '.' and '-' are allowed", name)
+	}
+	return nil
+}
+
+// FindRegistryCredential returns the registry credential with the given name.
+func FindRegistryCredential(db *gorm.DB, name string) (RegistryCredential, error) {
+	var cred RegistryCredential
+	result := db.Where(&RegistryCredential{Name: name}).Take(&cred)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return cred, fmt.Errorf("%w: %s", ErrCredentialNotFound, name)
+	}
+	return cred, result.Error
+}
+
+// EncodedAuth returns the credential in the form Docker expects along with a
+// pull, decrypting the password with key.
+func (c RegistryCredential) EncodedAuth(key []byte) (string, error) {
+	password, err := c.Password(key)
+	if err != nil {
+		return "", err
+	}
+
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      c.Username,
+		Password:      password,
+		ServerAddress: c.Server,
+	})
+}
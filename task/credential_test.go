@@ -0,0 +1,105 @@
+package task
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+)
+
+func TestCredentialPassword(t *testing.T) {
+	key := make([]byte, 32)
+	cred := RegistryCredential{Name: "gitlab"}
+	if err := cred.SetPassword(key, "s3cret"); err != nil {
+		t.Fatalf("SetPassword() error = %v", err)
+	}
+	if strings.Contains(cred.SealedPassword, "s3cret") {
+		t.Fatalf("sealed password %q holds the password", cred.SealedPassword)
+	}
+
+	if got, err := cred.Password(key); err != nil || got != "s3cret" {
+		t.Errorf("Password() = %q, %v, want s3cret", got, err)
+	}
+
+	other := make([]byte, 32)
+	other[0] = 1
+	if _, err := cred.Password(other); err == nil {
+		t.Errorf("Password() with another key succeeded")
+	}
+
+	moved := RegistryCredential{Name: "quay", SealedPassword: cred.SealedPassword}
+	if _, err := moved.Password(key); err == nil {
+		t.Errorf("Password() of a sealed password copied onto another credential succeeded")
+	}
+
+	if err := cred.SetPassword(nil, "s3cret"); !errors.Is(err, ErrNoCredentialKey) {
+		t.Errorf("SetPassword() without a key error = %v, want ErrNoCredentialKey", err)
+	}
+}
+
+func TestSealRegistryCredentials(t *testing.T) {
+	db := dbtest.Open(t, &RegistryCredential{})
+	key := make([]byte, 32)
+
+	sealed := RegistryCredential{ID: uuid.New(), Name: "gitlab"}
+	sealed.SetPassword(key, "s3cret")
+	db.Create(&sealed)
+	db.Create(&RegistryCredential{ID: uuid.New(), Name: "quay", SealedPassword: "plain"})
+
+	n, err := SealRegistryCredentials(db, key)
+	if err != nil || n != 1 {
+		t.Fatalf("SealRegistryCredentials() = %d, %v, want 1", n, err)
+	}
+
+	for name, want := range map[string]string{"gitlab": "s3cret", "quay": "plain"} {
+		cred, err := FindRegistryCredential(db, name)
+		if err != nil {
+			t.Fatalf("FindRegistryCredential() error = %v", err)
+		}
+		if !strings.HasPrefix(cred.SealedPassword, sealedPrefix) {
+			t.Errorf("password of %s stored as %q, want it encrypted", name, cred.SealedPassword)
+		}
+		if got, err := cred.Password(key); err != nil || got != want {
+			t.Errorf("Password() of %s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestLoadCredentialKey(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0o600)
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantLen int
+		wantErr bool
+	}{
+		{name: "no key"},
+		{name: "key", path: write("key", base64.StdEncoding.EncodeToString(make([]byte, 32))+"\n"), wantLen: 32},
+		{name: "short key", path: write("short", base64.StdEncoding.EncodeToString(make([]byte, 16))), wantErr: true},
+		{name: "not base64", path: write("raw", "not a key!"), wantErr: true},
+		{name: "missing file", path: filepath.Join(dir, "missing"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := LoadCredentialKey(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadCredentialKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(key) != tt.wantLen {
+				t.Errorf("LoadCredentialKey() = %d bytes, want %d", len(key), tt.wantLen)
+			}
+		})
+	}
+}
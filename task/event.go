@@ -0,0 +1,40 @@
+package task
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TaskEvent records one state change of a task. Events are kept after the
+// task itself is removed, so the history of a stopped or failed task can
+// still be looked up.
+type TaskEvent struct {
+	ID        uuid.UUID `json:"id"`
+	TaskID    uuid.UUID `json:"taskId" gorm:"index"`
+	OldState  string    `json:"oldState"`
+	NewState  string    `json:"newState"`
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// RecordEvent stores a state change of the task. A task that is created
+// has an empty old state.
+func RecordEvent(db *gorm.DB, taskId uuid.UUID, from string, to string, reason string) error {
+	return db.Create(&TaskEvent{
+		ID:        uuid.New(),
+		TaskID:    taskId,
+		OldState:  from,
+		NewState:  to,
+		Reason:    reason,
+		Timestamp: time.Now().UTC(),
+	}).Error
+}
+
+// GetTaskEvents returns the state changes of the task, oldest first.
+func GetTaskEvents(db *gorm.DB, taskId uuid.UUID) ([]TaskEvent, error) {
+	var events []TaskEvent
+	result := db.Where(&TaskEvent{TaskID: taskId}).Order("timestamp").Find(&events)
+	return events, result.Error
+}
@@ -0,0 +1,252 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/shashank-mugiwara/joyboy/utils"
+)
+
+// The health of a Running task, kept next to its state. Tasks without a
+// health check are only marked Unhealthy while Docker keeps restarting
+// their container.
+const (
+	HealthStarting  = "Starting"
+	HealthHealthy   = "Healthy"
+	HealthUnhealthy = "Unhealthy"
+)
+
+// Defaults of a health check, the same as Docker's.
+const (
+	DefaultHealthInterval = 30 * time.Second
+	DefaultHealthTimeout  = 30 * time.Second
+	DefaultHealthRetries  = 3
+)
+
+// HealthCheck tells how the health of a task is checked. Exactly one of
+// Cmd, HTTP and TCP is set. Cmd is run by Docker inside the container like a
+// HEALTHCHECK of the image, HTTP and TCP are probes joyboy sends to one of
+// the task's published ports.
+type HealthCheck struct {
+	// The command and its arguments, or a shell command after CMD-SHELL.
+	Cmd  []string   `json:"cmd,omitempty"`
+	HTTP *HTTPProbe `json:"http,omitempty"`
+	TCP  *TCPProbe  `json:"tcp,omitempty"`
+	// Zero values take the defaults above. The task is Unhealthy after
+	// Retries failed checks in a row, and failures within StartPeriod of
+	// the task starting are not counted.
+	IntervalSeconds    int `json:"intervalSeconds,omitempty"`
+	TimeoutSeconds     int `json:"timeoutSeconds,omitempty"`
+	Retries            int `json:"retries,omitempty"`
+	StartPeriodSeconds int `json:"startPeriodSeconds,omitempty"`
+}
+
+// HTTPProbe is healthy when a GET of Path answers with a 2xx or 3xx status.
+type HTTPProbe struct {
+	// A tcp container port the task publishes.
+	Port string `json:"port"`
+	Path string `json:"path,omitempty"`
+}
+
+// TCPProbe is healthy when a connection to Port can be opened.
+type TCPProbe struct {
+	// A tcp container port the task publishes.
+	Port string `json:"port"`
+}
+
+// Validate checks the health check against the ports the task publishes,
+// which is where the probes are sent.
+func (h *HealthCheck) Validate(bindings PortBindings) error {
+	kinds := 0
+	for _, set := range []bool{len(h.Cmd) > 0, h.HTTP != nil, h.TCP != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return errors.New("a health check needs exactly one of cmd, http and tcp")
+	}
+
+	if h.IntervalSeconds < 0 || h.TimeoutSeconds < 0 || h.Retries < 0 || h.StartPeriodSeconds < 0 {
+		return errors.New("health check intervals and retries cannot be negative")
+	}
+
+	if len(h.Cmd) > 0 && utils.IsBlank(strings.Join(h.Cmd, "")) {
+		return errors.New("health check cmd cannot be blank")
+	}
+
+	if h.HTTP != nil {
+		if h.HTTP.Path != "" && !strings.HasPrefix(h.HTTP.Path, "/") {
+			return fmt.Errorf("health check path %q must start with /", h.HTTP.Path)
+		}
+		return checkProbePort(h.HTTP.Port, bindings)
+	}
+	if h.TCP != nil {
+		return checkProbePort(h.TCP.Port, bindings)
+	}
+	return nil
+}
+
+func checkProbePort(port string, bindings PortBindings) error {
+	number, protocol, _ := strings.Cut(port, "/")
+	if protocol != "" && protocol != "tcp" {
+		return fmt.Errorf("health check port %s must be a tcp port", port)
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid health check port %q", port)
+	}
+
+	for _, b := range bindings {
+		if utils.DefaultIfBlank(b.Protocol, "tcp") != "tcp" {
+			continue
+		}
+		start, end, err := nat.ParsePortRangeToInt(b.ContainerPort)
+		if err == nil && start <= n && n <= end {
+			return nil
+		}
+	}
+	return fmt.Errorf("health check port %s is not published in portMapping", port)
+}
+
+// Docker reports whether Docker runs the check itself.
+func (h *HealthCheck) Docker() bool {
+	return len(h.Cmd) > 0
+}
+
+// DockerConfig is the check as Docker takes it at create, nil for checks
+// joyboy runs.
+func (h *HealthCheck) DockerConfig() *container.HealthConfig {
+	if h == nil || !h.Docker() {
+		return nil
+	}
+
+	test := h.Cmd
+	switch h.Cmd[0] {
+	case "CMD", "CMD-SHELL", "NONE":
+	default:
+		test = append([]string{"CMD"}, h.Cmd...)
+	}
+
+	return &container.HealthConfig{
+		Test:        test,
+		Interval:    time.Duration(h.IntervalSeconds) * time.Second,
+		Timeout:     time.Duration(h.TimeoutSeconds) * time.Second,
+		StartPeriod: time.Duration(h.StartPeriodSeconds) * time.Second,
+		Retries:     h.Retries,
+	}
+}
+
+func (h *HealthCheck) Interval() time.Duration {
+	if h == nil || h.IntervalSeconds == 0 {
+		return DefaultHealthInterval
+	}
+	return time.Duration(h.IntervalSeconds) * time.Second
+}
+
+func (h *HealthCheck) Timeout() time.Duration {
+	if h.TimeoutSeconds == 0 {
+		return DefaultHealthTimeout
+	}
+	return time.Duration(h.TimeoutSeconds) * time.Second
+}
+
+func (h *HealthCheck) MaxFailures() int {
+	if h.Retries == 0 {
+		return DefaultHealthRetries
+	}
+	return h.Retries
+}
+
+func (h *HealthCheck) StartPeriod() time.Duration {
+	return time.Duration(h.StartPeriodSeconds) * time.Second
+}
+
+// probeTransport sends HTTP probes straight to the task, without any proxy
+// from the environment and without keeping connections to it open.
+var probeTransport = &http.Transport{DisableKeepAlives: true}
+
+// Probe runs the HTTP or TCP probe of the check against the host ports the
+// task was given, returning why it failed.
+func (h *HealthCheck) Probe(ctx context.Context, ports []PortBinding) error {
+	port := ""
+	if h.HTTP != nil {
+		port = h.HTTP.Port
+	} else if h.TCP != nil {
+		port = h.TCP.Port
+	} else {
+		return errors.New("the health check has no probe")
+	}
+
+	addr, err := probeAddress(port, ports)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout())
+	defer cancel()
+
+	if h.TCP != nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+h.HTTP.Path, nil)
+	if err != nil {
+		return err
+	}
+
+	// Redirects are answers like any other 3xx, following them could send
+	// the probe to another host.
+	client := &http.Client{
+		Transport: probeTransport,
+		Timeout:   h.Timeout(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("GET %s answered %s", h.HTTP.Path, resp.Status)
+	}
+	return nil
+}
+
+// probeAddress finds the host address the container port was published on.
+// Ports published on all addresses are probed on the loopback address.
+func probeAddress(port string, ports []PortBinding) (string, error) {
+	number, _, _ := strings.Cut(port, "/")
+	for _, p := range ports {
+		if p.ContainerPort != number || utils.DefaultIfBlank(p.Protocol, "tcp") != "tcp" {
+			continue
+		}
+
+		host := p.HostIP
+		switch host {
+		case "", "0.0.0.0":
+			host = "127.0.0.1"
+		case "::":
+			host = "::1"
+		}
+		return net.JoinHostPort(host, p.HostPort), nil
+	}
+	return "", fmt.Errorf("container port %s has no host port", port)
+}
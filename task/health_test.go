@@ -0,0 +1,118 @@
+package task
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckValidate(t *testing.T) {
+	bindings := PortBindings{{ContainerPort: "80"}, {ContainerPort: "8000-8010"}, {ContainerPort: "53", Protocol: "udp"}}
+
+	tests := []struct {
+		name    string
+		check   HealthCheck
+		wantErr string
+	}{
+		{name: "cmd", check: HealthCheck{Cmd: []string{"CMD-SHELL", "curl -f localhost"}, Retries: 5}},
+		{name: "http", check: HealthCheck{HTTP: &HTTPProbe{Port: "80", Path: "/healthz"}}},
+		{name: "tcp in a range", check: HealthCheck{TCP: &TCPProbe{Port: "8005/tcp"}}},
+		{name: "nothing", check: HealthCheck{}, wantErr: "exactly one"},
+		{name: "two kinds", check: HealthCheck{Cmd: []string{"true"}, TCP: &TCPProbe{Port: "80"}}, wantErr: "exactly one"},
+		{name: "negative", check: HealthCheck{TCP: &TCPProbe{Port: "80"}, IntervalSeconds: -1}, wantErr: "negative"},
+		{name: "blank cmd", check: HealthCheck{Cmd: []string{" "}}, wantErr: "blank"},
+		{name: "relative path", check: HealthCheck{HTTP: &HTTPProbe{Port: "80", Path: "healthz"}}, wantErr: "must start with /"},
+		{name: "unpublished", check: HealthCheck{TCP: &TCPProbe{Port: "81"}}, wantErr: "not published"},
+		{name: "udp", check: HealthCheck{TCP: &TCPProbe{Port: "53/udp"}}, wantErr: "tcp port"},
+		{name: "udp binding", check: HealthCheck{TCP: &TCPProbe{Port: "53"}}, wantErr: "not published"},
+		{name: "bad port", check: HealthCheck{TCP: &TCPProbe{Port: "http"}}, wantErr: "invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check.Validate(bindings)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHealthCheckDockerConfig(t *testing.T) {
+	check := &HealthCheck{Cmd: []string{"pg_isready"}, IntervalSeconds: 5, Retries: 2}
+	got := check.DockerConfig()
+	if !reflect.DeepEqual(got.Test, []string{"CMD", "pg_isready"}) || got.Interval != 5*time.Second || got.Retries != 2 {
+		t.Errorf("DockerConfig() = %+v", got)
+	}
+
+	shell := &HealthCheck{Cmd: []string{"CMD-SHELL", "pg_isready || exit 1"}}
+	if got := shell.DockerConfig(); !reflect.DeepEqual(got.Test, shell.Cmd) {
+		t.Errorf("DockerConfig() test = %v, want %v", got.Test, shell.Cmd)
+	}
+
+	probe := &HealthCheck{TCP: &TCPProbe{Port: "80"}}
+	if got := probe.DockerConfig(); got != nil {
+		t.Errorf("DockerConfig() of a probe = %+v, want nil", got)
+	}
+}
+
+func TestHealthCheckProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+		case "/moved":
+			http.Redirect(w, r, "/", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	ports := []PortBinding{{ContainerPort: "80", Protocol: "tcp", HostIP: host, HostPort: port}}
+
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	_, closedPort, _ := net.SplitHostPort(closed.Addr().String())
+	closed.Close()
+	closedPorts := []PortBinding{{ContainerPort: "80", HostIP: "0.0.0.0", HostPort: closedPort}}
+
+	tests := []struct {
+		name    string
+		check   HealthCheck
+		ports   []PortBinding
+		wantErr string
+	}{
+		{name: "http ok", check: HealthCheck{HTTP: &HTTPProbe{Port: "80", Path: "/healthz"}}, ports: ports},
+		{name: "http redirect not followed", check: HealthCheck{HTTP: &HTTPProbe{Port: "80", Path: "/moved"}}, ports: ports},
+		{name: "http error", check: HealthCheck{HTTP: &HTTPProbe{Port: "80", Path: "/"}}, ports: ports, wantErr: "503"},
+		{name: "tcp ok", check: HealthCheck{TCP: &TCPProbe{Port: "80"}}, ports: ports},
+		{name: "tcp refused", check: HealthCheck{TCP: &TCPProbe{Port: "80"}}, ports: closedPorts, wantErr: "refused"},
+		{name: "no host port", check: HealthCheck{TCP: &TCPProbe{Port: "81"}}, ports: ports, wantErr: "no host port"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check.Probe(context.Background(), tt.ports)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Probe() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Probe() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	timetypes "github.com/docker/docker/api/types/time"
+)
+
+// ParseLogsOptions reads the options of a request for a task's logs from its
+// query: follow and timestamps, tail as a number of lines or "all", since as
+// a timestamp or as a duration such as 10m back from now, and stdout and
+// stderr which are both shown unless set to false.
+func ParseLogsOptions(query url.Values) (container.LogsOptions, error) {
+	options := container.LogsOptions{Tail: "all"}
+
+	flags := []struct {
+		name  string
+		value *bool
+		def   bool
+	}{
+		{name: "follow", value: &options.Follow},
+		{name: "timestamps", value: &options.Timestamps},
+		{name: "stdout", value: &options.ShowStdout, def: true},
+		{name: "stderr", value: &options.ShowStderr, def: true},
+	}
+	for _, f := range flags {
+		*f.value = f.def
+		if v := query.Get(f.name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return options, fmt.Errorf("invalid value %q for %s, must be true or false", v, f.name)
+			}
+			*f.value = b
+		}
+	}
+
+	if !options.ShowStdout && !options.ShowStderr {
+		return options, errors.New("at least one of stdout and stderr must be shown")
+	}
+
+	if tail := query.Get("tail"); tail != "" && tail != "all" {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 0 {
+			return options, fmt.Errorf("invalid value %q for tail, must be a number of lines or all", tail)
+		}
+		options.Tail = tail
+	}
+
+	if since := query.Get("since"); since != "" {
+		ts, err := timetypes.GetTimestamp(since, time.Now())
+		if err != nil {
+			return options, fmt.Errorf("invalid value %q for since, must be a timestamp or a duration", since)
+		}
+		options.Since = ts
+	}
+
+	return options, nil
+}
+
+// LogsQuery is the inverse of ParseLogsOptions.
+func LogsQuery(options container.LogsOptions) url.Values {
+	query := url.Values{}
+	query.Set("follow", strconv.FormatBool(options.Follow))
+	query.Set("timestamps", strconv.FormatBool(options.Timestamps))
+	query.Set("stdout", strconv.FormatBool(options.ShowStdout))
+	query.Set("stderr", strconv.FormatBool(options.ShowStderr))
+	if options.Tail != "" {
+		query.Set("tail", options.Tail)
+	}
+	if options.Since != "" {
+		query.Set("since", options.Since)
+	}
+	return query
+}
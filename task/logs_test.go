@@ -0,0 +1,49 @@
+package task
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestParseLogsOptions(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    container.LogsOptions
+		wantErr bool
+	}{
+		{query: "", want: container.LogsOptions{ShowStdout: true, ShowStderr: true, Tail: "all"}},
+		{query: "follow=true&timestamps=1&tail=100", want: container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true, Timestamps: true, Tail: "100"}},
+		{query: "stdout=false", want: container.LogsOptions{ShowStderr: true, Tail: "all"}},
+		{query: "since=1700000000", want: container.LogsOptions{ShowStdout: true, ShowStderr: true, Tail: "all", Since: "1700000000"}},
+		{query: "since=2023-11-14T22:13:20Z", want: container.LogsOptions{ShowStdout: true, ShowStderr: true, Tail: "all", Since: "1700000000.000000000"}},
+		{query: "stdout=false&stderr=false", wantErr: true},
+		{query: "follow=maybe", wantErr: true},
+		{query: "tail=-1", wantErr: true},
+		{query: "tail=some", wantErr: true},
+		{query: "since=yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			got, err := ParseLogsOptions(query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLogsOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseLogsOptions() = %+v, want %+v", got, tt.want)
+			}
+
+			back, err := ParseLogsOptions(LogsQuery(got))
+			if err != nil || !reflect.DeepEqual(back, got) {
+				t.Errorf("options sent on as %v came back as %+v, %v", LogsQuery(got), back, err)
+			}
+		})
+	}
+}
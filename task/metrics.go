@@ -0,0 +1,45 @@
+package task
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+var tasksDesc = prometheus.NewDesc("joyboy_tasks", "Tasks known to this node, by state.", []string{"state"}, nil)
+
+// stateCollector reports the number of tasks in each state, reading them
+// from the database every time metrics are scraped.
+type stateCollector struct {
+	db *gorm.DB
+}
+
+func StateCollector(db *gorm.DB) prometheus.Collector {
+	return &stateCollector{db: db}
+}
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tasksDesc
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	var rows []struct {
+		State string
+		Count int64
+	}
+	result := c.db.Model(&Task{}).Select("state, count(*) as count").Group("state").Scan(&rows)
+	if result.Error != nil {
+		log.Printf("Failed to count tasks by state: %v\n", result.Error)
+		return
+	}
+
+	counts := make(map[string]int64)
+	for _, r := range rows {
+		counts[r.State] = r.Count
+	}
+
+	for st := Pending; st <= Stopped; st++ {
+		ch <- prometheus.MustNewConstMetric(tasksDesc, prometheus.GaugeValue, float64(counts[st.String()]), st.String())
+	}
+}
@@ -0,0 +1,29 @@
+package task
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStateCollector(t *testing.T) {
+	db := newTestDb(t)
+	for _, st := range []State{Running, Running, Failed} {
+		db.Create(&Task{ID: uuid.New(), Name: "nginx", State: st.String()})
+	}
+
+	want := `# HELP joyboy_tasks Tasks known to this node, by state.
+# TYPE joyboy_tasks gauge
+joyboy_tasks{state="Completed"} 0
+joyboy_tasks{state="Failed"} 1
+joyboy_tasks{state="Pending"} 0
+joyboy_tasks{state="Running"} 2
+joyboy_tasks{state="Scheduled"} 0
+joyboy_tasks{state="Stopped"} 0
+`
+	if err := testutil.CollectAndCompare(StateCollector(db), strings.NewReader(want)); err != nil {
+		t.Errorf("StateCollector() %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package task
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/utils"
+)
+
+// Mount is a volume, host directory or tmpfs mounted into a task's
+// container.
+type Mount struct {
+	// One of volume, bind or tmpfs.
+	Type string `json:"type"`
+	// The volume name for volume mounts and the host path for bind mounts.
+	// Left empty for tmpfs.
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"readOnly"`
+	// Size limit of a tmpfs mount in MiB, zero means no limit.
+	Size int64 `json:"size"`
+}
+
+// Same rule Docker applies to volume names.
+var volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// ValidateMounts checks the mounts of a task. Bind mounts may only mount
+// host paths inside one of allowedHostPaths, so with none configured bind
+// mounts are refused.
+func ValidateMounts(mounts []Mount, allowedHostPaths []string) error {
+	targets := make(map[string]bool)
+	for _, m := range mounts {
+		if !filepath.IsAbs(m.Target) || filepath.Clean(m.Target) == "/" {
+			return fmt.Errorf("mount target %q must be an absolute path other than /", m.Target)
+		}
+
+		target := filepath.Clean(m.Target)
+		if targets[target] {
+			return fmt.Errorf("more than one mount on %s", target)
+		}
+		targets[target] = true
+
+		if m.Size != 0 && m.Type != string(mount.TypeTmpfs) {
+			return fmt.Errorf("mount on %s: size is only supported for tmpfs mounts", target)
+		}
+
+		switch mount.Type(m.Type) {
+		case mount.TypeVolume:
+			if !volumeNamePattern.MatchString(m.Source) {
+				return fmt.Errorf("mount on %s: invalid volume name %q", target, m.Source)
+			}
+		case mount.TypeBind:
+			if !filepath.IsAbs(m.Source) {
+				return fmt.Errorf("mount on %s: host path %q must be absolute", target, m.Source)
+			}
+			if !hostPathAllowed(m.Source, allowedHostPaths) {
+				return fmt.Errorf("mount on %s: host path %s is not in an allowed host path", target, m.Source)
+			}
+		case mount.TypeTmpfs:
+			if !utils.IsBlank(m.Source) {
+				return fmt.Errorf("mount on %s: tmpfs mounts take no source", target)
+			}
+			if m.Size < 0 {
+				return fmt.Errorf("mount on %s: size cannot be negative", target)
+			}
+		default:
+			return fmt.Errorf("mount on %s: unknown type %q, use volume, bind or tmpfs", target, m.Type)
+		}
+	}
+
+	return nil
+}
+
+func hostPathAllowed(path string, allowedHostPaths []string) bool {
+	path = filepath.Clean(path)
+	for _, allowed := range allowedHostPaths {
+		if utils.IsBlank(allowed) {
+			continue
+		}
+
+		allowed = filepath.Clean(strings.TrimSpace(allowed))
+		if path == allowed || strings.HasPrefix(path, strings.TrimSuffix(allowed, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveHostPath follows the symlinks in a bind mount's host path and
+// checks the path they lead to is still inside one of allowedHostPaths, so a
+// link inside an allowed directory cannot point elsewhere on the host. Paths
+// that do not exist are refused. It runs on the worker, where the paths are,
+// and returns the real path to mount.
+func ResolveHostPath(path string, allowedHostPaths []string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("host path %s cannot be resolved: %w", path, err)
+	}
+
+	allowed := make([]string, 0, len(allowedHostPaths))
+	for _, a := range allowedHostPaths {
+		if utils.IsBlank(a) {
+			continue
+		}
+		a = strings.TrimSpace(a)
+		if realAllowed, err := filepath.EvalSymlinks(a); err == nil {
+			a = realAllowed
+		}
+		allowed = append(allowed, a)
+	}
+
+	if !hostPathAllowed(real, allowed) {
+		return "", fmt.Errorf("host path %s leads to %s, which is not in an allowed host path", path, real)
+	}
+	return real, nil
+}
+
+// ValidateVolume checks a volume that exists already may be mounted. Only
+// volumes joyboy created, or that the operator listed in externalVolumes,
+// are, so tasks cannot attach other applications' volumes.
+func ValidateVolume(name string, labels map[string]string, externalVolumes []string) error {
+	if labels[dkrclient.ManagedLabel] == "true" {
+		return nil
+	}
+
+	for _, external := range externalVolumes {
+		if strings.TrimSpace(external) == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("volume %s was not created by joyboy and is not listed in ExternalVolumes", name)
+}
+
+// DockerMount is the mount as Docker takes it at container create.
+func (m Mount) DockerMount() mount.Mount {
+	dm := mount.Mount{
+		Type:     mount.Type(m.Type),
+		Source:   m.Source,
+		Target:   filepath.Clean(m.Target),
+		ReadOnly: m.ReadOnly,
+	}
+
+	if dm.Type == mount.TypeTmpfs && m.Size > 0 {
+		dm.TmpfsOptions = &mount.TmpfsOptions{SizeBytes: m.Size * 1024 * 1024}
+	}
+	return dm
+}
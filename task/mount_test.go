@@ -0,0 +1,116 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+)
+
+func TestValidateMounts(t *testing.T) {
+	allowed := []string{"/srv/joyboy", "/data/"}
+
+	tests := []struct {
+		name    string
+		mounts  []Mount
+		wantErr bool
+	}{
+		{name: "no mounts"},
+		{name: "named volume", mounts: []Mount{{Type: "volume", Source: "pgdata", Target: "/var/lib/postgresql/data"}}},
+		{name: "bind inside allowed path", mounts: []Mount{{Type: "bind", Source: "/srv/joyboy/site", Target: "/usr/share/nginx/html", ReadOnly: true}}},
+		{name: "bind on allowed path itself", mounts: []Mount{{Type: "bind", Source: "/data", Target: "/data"}}},
+		{name: "tmpfs", mounts: []Mount{{Type: "tmpfs", Target: "/tmp", Size: 64}}},
+		{name: "bind outside allowed paths", mounts: []Mount{{Type: "bind", Source: "/etc", Target: "/host-etc"}}, wantErr: true},
+		{name: "bind escaping allowed path", mounts: []Mount{{Type: "bind", Source: "/srv/joyboy/../../etc", Target: "/host-etc"}}, wantErr: true},
+		{name: "bind sharing allowed path prefix", mounts: []Mount{{Type: "bind", Source: "/srv/joyboy-other", Target: "/x"}}, wantErr: true},
+		{name: "relative bind", mounts: []Mount{{Type: "bind", Source: "srv/joyboy", Target: "/x"}}, wantErr: true},
+		{name: "volume without name", mounts: []Mount{{Type: "volume", Target: "/data"}}, wantErr: true},
+		{name: "volume with path as name", mounts: []Mount{{Type: "volume", Source: "/srv/joyboy", Target: "/data"}}, wantErr: true},
+		{name: "tmpfs with source", mounts: []Mount{{Type: "tmpfs", Source: "x", Target: "/tmp"}}, wantErr: true},
+		{name: "size on volume", mounts: []Mount{{Type: "volume", Source: "pgdata", Target: "/data", Size: 10}}, wantErr: true},
+		{name: "relative target", mounts: []Mount{{Type: "tmpfs", Target: "tmp"}}, wantErr: true},
+		{name: "root target", mounts: []Mount{{Type: "tmpfs", Target: "/"}}, wantErr: true},
+		{name: "unknown type", mounts: []Mount{{Type: "nfs", Source: "x", Target: "/x"}}, wantErr: true},
+		{name: "same target twice", mounts: []Mount{{Type: "tmpfs", Target: "/tmp"}, {Type: "volume", Source: "tmp", Target: "/tmp/"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMounts(tt.mounts, allowed)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateMounts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := ValidateMounts([]Mount{{Type: "bind", Source: "/srv/joyboy", Target: "/x"}}, nil); err == nil {
+		t.Errorf("ValidateMounts() allowed a bind mount with no allowed host paths")
+	}
+}
+
+func TestResolveHostPath(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to resolve temp dir: %v", err)
+	}
+	allowed := filepath.Join(root, "allowed")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{filepath.Join(allowed, "site"), outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	os.Symlink(outside, filepath.Join(allowed, "escape"))
+	os.Symlink(filepath.Join(allowed, "site"), filepath.Join(allowed, "current"))
+	// An allowed path that is itself a link is compared by where it leads.
+	os.Symlink(allowed, filepath.Join(root, "link"))
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "directory", path: filepath.Join(allowed, "site"), want: filepath.Join(allowed, "site")},
+		{name: "link staying inside", path: filepath.Join(allowed, "current"), want: filepath.Join(allowed, "site")},
+		{name: "link leading outside", path: filepath.Join(allowed, "escape"), wantErr: true},
+		{name: "missing path", path: filepath.Join(allowed, "missing"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveHostPath(tt.path, []string{filepath.Join(root, "link")})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveHostPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveHostPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateVolume(t *testing.T) {
+	managed := map[string]string{dkrclient.ManagedLabel: "true"}
+
+	tests := []struct {
+		name    string
+		volume  string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{name: "created by joyboy", volume: "pgdata", labels: managed},
+		{name: "listed as external", volume: "shared"},
+		{name: "someone else's", volume: "mysql-data", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateVolume(tt.volume, tt.labels, []string{" shared"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateVolume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
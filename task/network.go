@@ -0,0 +1,31 @@
+package task
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Same rule Docker applies to network names.
+var networkNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Docker's own networks, which either cannot be created or give tasks no
+// name resolution.
+var reservedNetworks = map[string]bool{
+	"bridge":  true,
+	"host":    true,
+	"none":    true,
+	"default": true,
+}
+
+// ValidateNetworkName checks the name of a network tasks are attached to.
+func ValidateNetworkName(name string) error {
+	if !networkNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid network name %q", name)
+	}
+
+	if reservedNetworks[name] {
+		return fmt.Errorf("network %s is reserved by docker, please pick another name", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package task
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/shashank-mugiwara/joyboy/utils"
+)
+
+// PortBinding publishes a container port, or a range of them, on the host.
+type PortBinding struct {
+	// A port such as 80, or a range such as 8000-8010.
+	ContainerPort string `json:"containerPort"`
+	// tcp, udp or sctp. Empty means tcp.
+	Protocol string `json:"protocol,omitempty"`
+	// The host address to listen on. Empty means all addresses.
+	HostIP string `json:"hostIp,omitempty"`
+	// A port, or a range as long as the container port range. For a single
+	// container port this can also be a range Docker picks one free port
+	// from. Empty lets Docker pick any free port.
+	HostPort string `json:"hostPort,omitempty"`
+}
+
+// Spec is the binding in the ip:hostPort:containerPort/protocol form docker
+// run -p takes.
+func (b PortBinding) Spec() string {
+	ip := b.HostIP
+	if strings.Contains(ip, ":") {
+		ip = "[" + ip + "]"
+	}
+	return ip + ":" + b.HostPort + ":" + b.ContainerPort + "/" + utils.DefaultIfBlank(b.Protocol, "tcp")
+}
+
+// PortBindings is stored as a JSON list in a text column.
+type PortBindings []PortBinding
+
+// ParsePortMapping reads the portMapping of a task request. Keys are
+// container ports with an optional protocol (80, 53/udp, 8000-8010/tcp),
+// values the host side: a port or range, optionally after a host IP
+// (127.0.0.1:8080, [::1]:8080), or empty for any free port (127.0.0.1: binds
+// any free port on that address only).
+func ParsePortMapping(mapping map[string]string) (PortBindings, error) {
+	containerPorts := make([]string, 0, len(mapping))
+	for containerPort := range mapping {
+		containerPorts = append(containerPorts, containerPort)
+	}
+	sort.Strings(containerPorts)
+
+	bindings := make(PortBindings, 0, len(mapping))
+	for _, key := range containerPorts {
+		containerPort, protocol, _ := strings.Cut(key, "/")
+
+		hostIP, hostPort := "", strings.TrimSpace(mapping[key])
+		if i := strings.LastIndex(hostPort, ":"); i >= 0 {
+			hostIP, hostPort = strings.Trim(hostPort[:i], "[]"), hostPort[i+1:]
+		}
+
+		bindings = append(bindings, PortBinding{
+			ContainerPort: containerPort,
+			Protocol:      strings.ToLower(protocol),
+			HostIP:        hostIP,
+			HostPort:      hostPort,
+		})
+	}
+
+	if err := bindings.Validate(); err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+// Validate checks every binding the way Docker would.
+func (p PortBindings) Validate() error {
+	for _, b := range p {
+		if _, err := nat.ParsePortSpec(b.Spec()); err != nil {
+			return fmt.Errorf("invalid port binding %s: %v", b.Spec(), err)
+		}
+	}
+	return nil
+}
+
+// Specs returns the bindings in docker run -p form.
+func (p PortBindings) Specs() []string {
+	specs := make([]string, 0, len(p))
+	for _, b := range p {
+		specs = append(specs, b.Spec())
+	}
+	return specs
+}
+
+// ForReplica offsets every host port by the replica index, so replicas of a
+// service never ask for the same port. Empty host ports are left for Docker
+// to pick.
+func (p PortBindings) ForReplica(index int) (PortBindings, error) {
+	if index == 0 {
+		return p, nil
+	}
+
+	shifted := make(PortBindings, 0, len(p))
+	for _, b := range p {
+		if utils.IsBlank(b.HostPort) {
+			shifted = append(shifted, b)
+			continue
+		}
+
+		start, end, err := nat.ParsePortRange(b.HostPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host port %q for container port %s", b.HostPort, b.ContainerPort)
+		}
+		if end+uint64(index) > 65535 {
+			return nil, fmt.Errorf("host port %d for replica %d is out of range", end+uint64(index), index)
+		}
+
+		b.HostPort = strconv.FormatUint(start+uint64(index), 10)
+		if end != start {
+			b.HostPort += "-" + strconv.FormatUint(end+uint64(index), 10)
+		}
+		shifted = append(shifted, b)
+	}
+
+	return shifted, nil
+}
+
+// Scan reads the JSON list the bindings are stored as. Tasks saved before
+// bindings were structured hold a JSON object of container to host ports,
+// which is read as well.
+func (p *PortBindings) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot read port bindings from %T", value)
+	}
+
+	trimmed := strings.TrimSpace(string(data))
+	switch {
+	case trimmed == "" || trimmed == "null":
+		*p = nil
+		return nil
+	case strings.HasPrefix(trimmed, "{"):
+		var mapping map[string]string
+		if err := json.Unmarshal(data, &mapping); err != nil {
+			return err
+		}
+
+		bindings, err := ParsePortMapping(mapping)
+		if err != nil {
+			return err
+		}
+		*p = bindings
+		return nil
+	default:
+		return json.Unmarshal(data, (*[]PortBinding)(p))
+	}
+}
+
+func (p PortBindings) Value() (driver.Value, error) {
+	if p == nil {
+		return "[]", nil
+	}
+
+	data, err := json.Marshal([]PortBinding(p))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// portsFromNat lists the host ports Docker bound, one entry per container
+// port, in port order.
+func portsFromNat(portMap nat.PortMap) []PortBinding {
+	var ports []PortBinding
+	for port, bindings := range portMap {
+		for _, binding := range bindings {
+			ports = append(ports, PortBinding{
+				ContainerPort: port.Port(),
+				Protocol:      port.Proto(),
+				HostIP:        binding.HostIP,
+				HostPort:      binding.HostPort,
+			})
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		a, b := ports[i], ports[j]
+		if a.ContainerPort != b.ContainerPort {
+			ai, _ := strconv.Atoi(a.ContainerPort)
+			bi, _ := strconv.Atoi(b.ContainerPort)
+			return ai < bi
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.HostIP < b.HostIP
+	})
+	return ports
+}
@@ -0,0 +1,95 @@
+package task
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+)
+
+func TestParsePortMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping map[string]string
+		want    PortBindings
+		wantErr bool
+	}{
+		{name: "host port", mapping: map[string]string{"80": "8211"}, want: PortBindings{{ContainerPort: "80", HostPort: "8211"}}},
+		{name: "udp", mapping: map[string]string{"53/udp": "5353"}, want: PortBindings{{ContainerPort: "53", Protocol: "udp", HostPort: "5353"}}},
+		{name: "host ip", mapping: map[string]string{"80": "127.0.0.1:8080"}, want: PortBindings{{ContainerPort: "80", HostIP: "127.0.0.1", HostPort: "8080"}}},
+		{name: "ipv6 host ip", mapping: map[string]string{"80": "[::1]:8080"}, want: PortBindings{{ContainerPort: "80", HostIP: "::1", HostPort: "8080"}}},
+		{name: "any free port", mapping: map[string]string{"80": ""}, want: PortBindings{{ContainerPort: "80"}}},
+		{name: "any free port on an ip", mapping: map[string]string{"80": "127.0.0.1:"}, want: PortBindings{{ContainerPort: "80", HostIP: "127.0.0.1"}}},
+		{name: "ranges", mapping: map[string]string{"8000-8010/TCP": "9000-9010"}, want: PortBindings{{ContainerPort: "8000-8010", Protocol: "tcp", HostPort: "9000-9010"}}},
+		{name: "host range for one port", mapping: map[string]string{"80": "9000-9010"}, want: PortBindings{{ContainerPort: "80", HostPort: "9000-9010"}}},
+		{name: "sorted", mapping: map[string]string{"443": "8443", "80": "8080"}, want: PortBindings{{ContainerPort: "443", HostPort: "8443"}, {ContainerPort: "80", HostPort: "8080"}}},
+		{name: "no mapping", mapping: nil, want: PortBindings{}},
+		{name: "mismatched ranges", mapping: map[string]string{"8000-8010": "9000-9001"}, wantErr: true},
+		{name: "unknown protocol", mapping: map[string]string{"80/http": "8080"}, wantErr: true},
+		{name: "invalid host ip", mapping: map[string]string{"80": "localhost:8080"}, wantErr: true},
+		{name: "invalid container port", mapping: map[string]string{"http": "8080"}, wantErr: true},
+		{name: "invalid host port", mapping: map[string]string{"80": "eighty"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePortMapping(tt.mapping)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePortMapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePortMapping() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortBindingsScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    PortBindings
+		wantErr bool
+	}{
+		{name: "list", value: `[{"containerPort":"53","protocol":"udp","hostPort":"5353"}]`, want: PortBindings{{ContainerPort: "53", Protocol: "udp", HostPort: "5353"}}},
+		{name: "bytes", value: []byte(`[{"containerPort":"80"}]`), want: PortBindings{{ContainerPort: "80"}}},
+		{name: "legacy map", value: `{"80":"8211"}`, want: PortBindings{{ContainerPort: "80", HostPort: "8211"}}},
+		{name: "legacy empty map", value: `{}`, want: PortBindings{}},
+		{name: "legacy null", value: "null", want: nil},
+		{name: "empty", value: "", want: nil},
+		{name: "nil", value: nil, want: nil},
+		{name: "garbage", value: "80:8211", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got PortBindings
+			err := got.Scan(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortsFromNat(t *testing.T) {
+	got := portsFromNat(nat.PortMap{
+		"443/tcp":  {{HostIP: "0.0.0.0", HostPort: "8443"}},
+		"80/tcp":   {{HostIP: "0.0.0.0", HostPort: "32768"}, {HostIP: "::", HostPort: "32768"}},
+		"53/udp":   {{HostIP: "127.0.0.1", HostPort: "5353"}},
+		"9000/tcp": nil,
+	})
+
+	want := []PortBinding{
+		{ContainerPort: "53", Protocol: "udp", HostIP: "127.0.0.1", HostPort: "5353"},
+		{ContainerPort: "80", Protocol: "tcp", HostIP: "0.0.0.0", HostPort: "32768"},
+		{ContainerPort: "80", Protocol: "tcp", HostIP: "::", HostPort: "32768"},
+		{ContainerPort: "443", Protocol: "tcp", HostIP: "0.0.0.0", HostPort: "8443"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("portsFromNat() = %+v, want %+v", got, want)
+	}
+}
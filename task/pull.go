@@ -0,0 +1,101 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// Pull policies decide when a task's image is pulled before its container
+// is created.
+const (
+	// PullAlways pulls the image every time, so a moved tag is picked up.
+	PullAlways = "Always"
+	// PullIfNotPresent only pulls images that are not present locally.
+	PullIfNotPresent = "IfNotPresent"
+	// PullNever never pulls, the image must have been loaded beforehand.
+	PullNever = "Never"
+)
+
+// ValidatePullPolicy accepts the pull policies above, and an empty one which
+// means PullAlways.
+func ValidatePullPolicy(policy string) error {
+	switch policy {
+	case "", PullAlways, PullIfNotPresent, PullNever:
+		return nil
+	default:
+		return fmt.Errorf("invalid pull policy %q, must be one of %s, %s or %s", policy, PullAlways, PullIfNotPresent, PullNever)
+	}
+}
+
+type layerProgress struct {
+	current int64
+	total   int64
+}
+
+// readPullProgress reads the progress messages of an image pull to the end,
+// calling report with the percentage of the image downloaded whenever it
+// goes up. Layers that already exist locally do not count. The engine
+// reports a failed pull as a message rather than an error of the pull
+// itself, that message is returned as the error.
+func readPullProgress(r io.Reader, report func(percent int)) error {
+	layers := make(map[string]*layerProgress)
+	reported := -1
+
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		err := dec.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if msg.ErrorMessage != "" {
+			return errors.New(msg.ErrorMessage)
+		}
+
+		if msg.ID == "" {
+			continue
+		}
+
+		layer := layers[msg.ID]
+		switch {
+		case msg.Status == "Downloading" && msg.Progress != nil && msg.Progress.Total > 0:
+			if layer == nil {
+				layer = &layerProgress{}
+				layers[msg.ID] = layer
+			}
+			layer.current = msg.Progress.Current
+			layer.total = msg.Progress.Total
+		case msg.Status == "Download complete" && layer != nil:
+			layer.current = layer.total
+		default:
+			continue
+		}
+
+		var current, total int64
+		for _, l := range layers {
+			current += l.current
+			total += l.total
+		}
+
+		if percent := int(current * 100 / total); percent > reported {
+			reported = percent
+			report(percent)
+		}
+	}
+
+	if reported < 100 {
+		report(100)
+	}
+	return nil
+}
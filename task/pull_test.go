@@ -0,0 +1,82 @@
+package task
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadPullProgress(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		want    []int
+		wantErr string
+	}{
+		{
+			name: "two layers",
+			stream: `{"status":"Pulling from library/nginx","id":"stable"}
+{"status":"Pulling fs layer","id":"a1"}
+{"status":"Downloading","progressDetail":{"current":300,"total":1000},"id":"a1"}
+{"status":"Downloading","progressDetail":{"current":100,"total":1000},"id":"b2"}
+{"status":"Downloading","progressDetail":{"current":150,"total":1000},"id":"b2"}
+{"status":"Download complete","id":"a1"}
+{"status":"Extracting","progressDetail":{"current":500,"total":1000},"id":"a1"}
+{"status":"Download complete","id":"b2"}
+{"status":"Pull complete","id":"a1"}
+`,
+			want: []int{30, 57, 100},
+		},
+		{
+			name: "layers already present",
+			stream: `{"status":"Already exists","id":"a1"}
+{"status":"Digest: sha256:abc"}
+{"status":"Status: Image is up to date for nginx:stable"}
+`,
+			want: []int{100},
+		},
+		{
+			name: "pull denied",
+			stream: `{"status":"Pulling from group/app","id":"latest"}
+{"errorDetail":{"message":"unauthorized: HTTP Basic: Access denied"},"error":"unauthorized: HTTP Basic: Access denied"}
+`,
+			wantErr: "Access denied",
+		},
+		{name: "garbage", stream: `not json`, wantErr: "invalid character"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			err := readPullProgress(strings.NewReader(tt.stream), func(percent int) { got = append(got, percent) })
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readPullProgress() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("readPullProgress() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reported %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePullPolicy(t *testing.T) {
+	for _, policy := range []string{"", PullAlways, PullIfNotPresent, PullNever} {
+		if err := ValidatePullPolicy(policy); err != nil {
+			t.Errorf("ValidatePullPolicy(%q) error = %v", policy, err)
+		}
+	}
+
+	for _, policy := range []string{"always", "Sometimes"} {
+		if err := ValidatePullPolicy(policy); err == nil {
+			t.Errorf("ValidatePullPolicy(%q) accepted an invalid policy", policy)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ParseRestartPolicy turns a restart policy as written for docker run (no,
+// always, unless-stopped, on-failure or on-failure:N) into the one Docker
+// expects at create. An empty policy means no.
+func ParseRestartPolicy(policy string) (container.RestartPolicy, error) {
+	name, retries, hasRetries := strings.Cut(policy, ":")
+
+	switch container.RestartPolicyMode(name) {
+	case "", container.RestartPolicyDisabled, container.RestartPolicyAlways, container.RestartPolicyUnlessStopped:
+		if hasRetries {
+			return container.RestartPolicy{}, fmt.Errorf("restart policy %q does not take a retry count", name)
+		}
+		return container.RestartPolicy{Name: container.RestartPolicyMode(name)}, nil
+	case container.RestartPolicyOnFailure:
+		if !hasRetries {
+			return container.RestartPolicy{Name: container.RestartPolicyOnFailure}, nil
+		}
+
+		n, err := strconv.Atoi(retries)
+		if err != nil || n < 0 {
+			return container.RestartPolicy{}, fmt.Errorf("invalid retry count %q in restart policy %q", retries, policy)
+		}
+		return container.RestartPolicy{Name: container.RestartPolicyOnFailure, MaximumRetryCount: n}, nil
+	default:
+		return container.RestartPolicy{}, fmt.Errorf("unknown restart policy %q, use no, always, unless-stopped or on-failure:N", policy)
+	}
+}
+
+// RestartsOnFailure reports whether the task is to be started again after its
+// container disappeared or became unhealthy, both of which its restart policy
+// treats as a failure. A task on on-failure:N is restarted at most N times.
+func (t *Task) RestartsOnFailure() bool {
+	policy, err := ParseRestartPolicy(t.RestartPolicy)
+	if err != nil {
+		return false
+	}
+
+	switch policy.Name {
+	case container.RestartPolicyAlways, container.RestartPolicyUnlessStopped:
+		return true
+	case container.RestartPolicyOnFailure:
+		return policy.MaximumRetryCount == 0 || t.Restarts < policy.MaximumRetryCount
+	default:
+		return false
+	}
+}
@@ -0,0 +1,63 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		want    container.RestartPolicy
+		wantErr bool
+	}{
+		{policy: "", want: container.RestartPolicy{}},
+		{policy: "no", want: container.RestartPolicy{Name: container.RestartPolicyDisabled}},
+		{policy: "always", want: container.RestartPolicy{Name: container.RestartPolicyAlways}},
+		{policy: "unless-stopped", want: container.RestartPolicy{Name: container.RestartPolicyUnlessStopped}},
+		{policy: "on-failure", want: container.RestartPolicy{Name: container.RestartPolicyOnFailure}},
+		{policy: "on-failure:3", want: container.RestartPolicy{Name: container.RestartPolicyOnFailure, MaximumRetryCount: 3}},
+		{policy: "on-failure:-1", wantErr: true},
+		{policy: "on-failure:", wantErr: true},
+		{policy: "always:3", wantErr: true},
+		{policy: "sometimes", wantErr: true},
+		{policy: "Always", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			got, err := ParseRestartPolicy(tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRestartPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRestartPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestartsOnFailure(t *testing.T) {
+	tests := []struct {
+		policy   string
+		restarts int
+		want     bool
+	}{
+		{policy: "", want: false},
+		{policy: "no", want: false},
+		{policy: "always", restarts: 10, want: true},
+		{policy: "unless-stopped", want: true},
+		{policy: "on-failure", restarts: 10, want: true},
+		{policy: "on-failure:2", restarts: 1, want: true},
+		{policy: "on-failure:2", restarts: 2, want: false},
+		{policy: "sometimes", want: false},
+	}
+
+	for _, tt := range tests {
+		task := Task{RestartPolicy: tt.policy, Restarts: tt.restarts}
+		if got := task.RestartsOnFailure(); got != tt.want {
+			t.Errorf("RestartsOnFailure() with %q after %d restarts = %v, want %v", tt.policy, tt.restarts, got, tt.want)
+		}
+	}
+}
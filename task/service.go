@@ -0,0 +1,96 @@
+package task
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Service keeps a number of replicas of the same task running. Every replica
+// is a Task of its own, named after the service and its replica index.
+type Service struct {
+	ID              uuid.UUID    `json:"id"`
+	Name            string       `json:"name"`
+	Image           string       `json:"image"`
+	Memory          int64        `json:"memory"`
+	Cpus            float32      `json:"cpus"`
+	Disk            int64        `json:"disk"`
+	RestartPolicy   string       `json:"restartPolicy"`
+	PortBindings    PortBindings `json:"portBindings" gorm:"type:text"`
+	MinTaskScale    int          `json:"minTaskScale"`
+	MaxTaskScale    int          `json:"maxTaskScale"`
+	Replicas        int          `json:"replicas"`
+	ScalingStrategy string       `json:"scalingStrategy"`
+	// Targets and cooldowns used by dynamic scaling. Utilisations are in
+	// percent of the replica's cpus and memory limit, cooldowns in seconds.
+	TargetCpuUtilization    float64   `json:"targetCpuUtilization"`
+	TargetMemoryUtilization float64   `json:"targetMemoryUtilization"`
+	ScaleUpCooldown         int       `json:"scaleUpCooldownSeconds"`
+	ScaleDownCooldown       int       `json:"scaleDownCooldownSeconds"`
+	LastScaledAt            time.Time `json:"lastScaledAt"`
+	CreatedAt               time.Time `json:"createdAt"`
+	// Handed to every replica as is.
+	Command            []string     `json:"command" gorm:"serializer:json;type:text"`
+	Entrypoint         []string     `json:"entrypoint" gorm:"serializer:json;type:text"`
+	Env                []string     `json:"env" gorm:"serializer:json;type:text"`
+	WorkingDir         string       `json:"workingDir"`
+	User               string       `json:"user"`
+	Mounts             []Mount      `json:"mounts" gorm:"serializer:json;type:text"`
+	Network            string       `json:"network"`
+	PullPolicy         string       `json:"pullPolicy"`
+	RegistryCredential string       `json:"registryCredential"`
+	HealthCheck        *HealthCheck `json:"healthCheck,omitempty" gorm:"serializer:json;type:text"`
+}
+
+// ScalingEvent records a change of a service's replica count and why it was
+// made.
+type ScalingEvent struct {
+	ID                uuid.UUID `json:"id"`
+	ServiceID         uuid.UUID `json:"serviceId" gorm:"index"`
+	FromReplicas      int       `json:"fromReplicas"`
+	ToReplicas        int       `json:"toReplicas"`
+	Reason            string    `json:"reason"`
+	CpuUtilization    float64   `json:"cpuUtilization"`
+	MemoryUtilization float64   `json:"memoryUtilization"`
+	Timestamp         time.Time `json:"timestamp"`
+}
+
+func ReplicaName(service string, index int) string {
+	return fmt.Sprintf("%s-%d", service, index)
+}
+
+// NewReplica builds the task for one replica of the service, with its host
+// ports shifted by the replica index.
+func (s *Service) NewReplica(index int) (Task, error) {
+	portBindings, err := s.PortBindings.ForReplica(index)
+	if err != nil {
+		return Task{}, err
+	}
+
+	return Task{
+		ID:            uuid.New(),
+		Name:          ReplicaName(s.Name, index),
+		State:         Scheduled.String(),
+		Image:         s.Image,
+		Memory:        s.Memory,
+		Cpus:          s.Cpus,
+		Disk:          s.Disk,
+		RestartPolicy: s.RestartPolicy,
+		PortBindings:  portBindings,
+		ServiceID:     s.ID,
+		Replica:       index,
+		Command:       s.Command,
+		Entrypoint:    s.Entrypoint,
+		Env:           s.Env,
+		WorkingDir:    s.WorkingDir,
+		User:          s.User,
+		Mounts:        s.Mounts,
+		Network:       s.Network,
+		PullPolicy:    s.PullPolicy,
+		// Any replica answers to the service's name.
+		NetworkAliases:     []string{s.Name},
+		RegistryCredential: s.RegistryCredential,
+		HealthCheck:        s.HealthCheck,
+	}, nil
+}
@@ -0,0 +1,41 @@
+package task
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPortBindingsForReplica(t *testing.T) {
+	tests := []struct {
+		name         string
+		portBindings PortBindings
+		index        int
+		want         PortBindings
+		wantErr      bool
+	}{
+		{name: "first replica keeps ports", portBindings: PortBindings{{ContainerPort: "80", HostPort: "8211"}}, index: 0, want: PortBindings{{ContainerPort: "80", HostPort: "8211"}}},
+		{
+			name:         "ports shifted by index",
+			portBindings: PortBindings{{ContainerPort: "443", HostPort: "9443"}, {ContainerPort: "80", HostIP: "127.0.0.1", HostPort: "8211"}},
+			index:        2,
+			want:         PortBindings{{ContainerPort: "443", HostPort: "9445"}, {ContainerPort: "80", HostIP: "127.0.0.1", HostPort: "8213"}},
+		},
+		{name: "range shifted by index", portBindings: PortBindings{{ContainerPort: "8000-8001", HostPort: "9000-9001"}}, index: 2, want: PortBindings{{ContainerPort: "8000-8001", HostPort: "9002-9003"}}},
+		{name: "empty host port left alone", portBindings: PortBindings{{ContainerPort: "80", Protocol: "udp"}}, index: 3, want: PortBindings{{ContainerPort: "80", Protocol: "udp"}}},
+		{name: "no bindings", portBindings: nil, index: 1, want: PortBindings{}},
+		{name: "invalid host port", portBindings: PortBindings{{ContainerPort: "80", HostPort: "http"}}, index: 1, wantErr: true},
+		{name: "out of range", portBindings: PortBindings{{ContainerPort: "80", HostPort: "65535"}}, index: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.portBindings.ForReplica(tt.index)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ForReplica() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ForReplica() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
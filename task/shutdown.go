@@ -0,0 +1,20 @@
+package task
+
+import "fmt"
+
+// What StopAllTasks does with the task containers when joyboy exits.
+const (
+	ShutdownStop   = "stop"
+	ShutdownLeave  = "leave"
+	ShutdownDetach = "detach"
+)
+
+// ValidateShutdownMode accepts the shutdown modes, empty meaning stop.
+func ValidateShutdownMode(mode string) error {
+	switch mode {
+	case "", ShutdownStop, ShutdownLeave, ShutdownDetach:
+		return nil
+	default:
+		return fmt.Errorf("unknown shutdown mode %q, use stop, leave or detach", mode)
+	}
+}
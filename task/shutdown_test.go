@@ -0,0 +1,86 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+)
+
+func TestStopAllTasks(t *testing.T) {
+	managed := container.Config{Labels: map[string]string{dkrclient.ManagedLabel: "true"}}
+
+	tests := []struct {
+		mode        string
+		wantRunning bool
+		wantState   State
+	}{
+		{mode: ShutdownStop, wantRunning: false, wantState: Stopped},
+		{mode: ShutdownLeave, wantRunning: true, wantState: Stopped},
+		{mode: ShutdownDetach, wantRunning: true, wantState: Running},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			db := newTestDb(t)
+			rt := dkrclient.NewFakeRuntime()
+			rt.SetContainer(dkrclient.FakeContainer{ID: "c-task-0000", Name: "web", Config: managed, Running: true})
+			rt.SetContainer(dkrclient.FakeContainer{ID: "c-other-000", Name: "postgres", Running: true})
+
+			tk := Task{ID: uuid.New(), Name: "web", State: Running.String(), ContainerID: "c-task-0000"}
+			db.Create(&tk)
+
+			StopAllTasks(db, rt, tt.mode)
+
+			if c, ok := rt.Container("c-task-0000"); ok != tt.wantRunning || (ok && !c.Running) {
+				t.Errorf("task container left running = %v, want %v", ok && c.Running, tt.wantRunning)
+			}
+			if c, ok := rt.Container("c-other-000"); !ok || !c.Running {
+				t.Errorf("a container joyboy does not manage was stopped")
+			}
+
+			var stored Task
+			db.Take(&stored, tk.ID)
+			if stored.State != tt.wantState.String() {
+				t.Errorf("task is %v, want %v", stored.State, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestStopAfterLeaveKeepsLeftContainers(t *testing.T) {
+	managed := container.Config{Labels: map[string]string{dkrclient.ManagedLabel: "true"}}
+	db := newTestDb(t)
+	rt := dkrclient.NewFakeRuntime()
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-left-0000", Name: "web", Config: managed, Running: true})
+
+	left := Task{ID: uuid.New(), Name: "web", State: Running.String(), ContainerID: "c-left-0000"}
+	db.Create(&left)
+	StopAllTasks(db, rt, ShutdownLeave)
+
+	// The next joyboy runs a task of its own and is shut down in stop mode.
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-next-0000", Name: "api", Config: managed, Running: true})
+	next := Task{ID: uuid.New(), Name: "api", State: Running.String(), ContainerID: "c-next-0000"}
+	db.Create(&next)
+	StopAllTasks(db, rt, ShutdownStop)
+
+	if c, ok := rt.Container("c-left-0000"); !ok || !c.Running {
+		t.Errorf("container left running by an earlier shutdown was stopped")
+	}
+	if _, ok := rt.Container("c-next-0000"); ok {
+		t.Errorf("container of a running task was not removed")
+	}
+}
+
+func TestValidateShutdownMode(t *testing.T) {
+	for _, mode := range []string{"", ShutdownStop, ShutdownLeave, ShutdownDetach} {
+		if err := ValidateShutdownMode(mode); err != nil {
+			t.Errorf("ValidateShutdownMode(%q) error = %v", mode, err)
+		}
+	}
+
+	if err := ValidateShutdownMode("kill"); err == nil {
+		t.Errorf("ValidateShutdownMode() accepted an unknown mode")
+	}
+}
@@ -2,21 +2,24 @@ package task
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"os"
+	"strings"
 	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
 	"github.com/google/uuid"
 	"github.com/shashank-mugiwara/joyboy/config"
 	"github.com/shashank-mugiwara/joyboy/database"
 	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"gorm.io/gorm"
 )
 
 type State int
@@ -49,6 +52,16 @@ func (s State) String() string {
 	}
 }
 
+// ParseState is the inverse of State.String.
+func ParseState(s string) (State, bool) {
+	for st := Pending; st <= Stopped; st++ {
+		if st.String() == s {
+			return st, true
+		}
+	}
+	return Pending, false
+}
+
 var KnownContainerStateMap = map[string]string{
 	"Pending":   "Pending",
 	"Scheduled": "Scheduled",
@@ -58,43 +71,100 @@ var KnownContainerStateMap = map[string]string{
 	"Stopped":   "Stopped",
 }
 
+// stateTransitionMap lists the states a task may move to from each state.
+// A Scheduled task that is stopped before it started goes straight to
+// Completed, a Running task whose container was lost goes back to Scheduled
+// when its restart policy has it started again, and Stopped is where running
+// tasks end up when joyboy shuts down.
 var stateTransitionMap = map[string][]string{
 	"Pending":   {"Scheduled"},
-	"Scheduled": {"Scheduled", "Running", "Failed"},
-	"Running":   {"Running", "Completed", "Failed"},
+	"Scheduled": {"Scheduled", "Running", "Completed", "Failed"},
+	"Running":   {"Scheduled", "Running", "Completed", "Failed", "Stopped"},
 	"Completed": {},
 	"Failed":    {},
+	"Stopped":   {},
 }
 
 type Task struct {
-	ID            uuid.UUID `json:"id"`
-	Name          string    `json:"name"`
-	State         string    `json:"state"`
-	Image         string    `json:"image"`
-	Memory        int64     `json:"memory"`
-	Disk          int64     `json:"disk"`
-	ExposedPorts  string    `json:"exposedPorts"`
-	PortBindings  string    `json:"portBindings"`
-	RestartPolicy string    `json:"restartPolicy"`
-	StartTime     time.Time `json:"startTime"`
-	EndTime       time.Time `json:"endTime"`
-	FinishTime    time.Time `json:"finishTime"`
-	Duration      time.Time `json:"duration"`
-	ContainerID   string    `json:"containerId"`
-	Cpus          float32   `json:"cpus"`
+	ID            uuid.UUID    `json:"id"`
+	Name          string       `json:"name"`
+	State         string       `json:"state"`
+	Image         string       `json:"image"`
+	Memory        int64        `json:"memory"`
+	Disk          int64        `json:"disk"`
+	ExposedPorts  string       `json:"exposedPorts"`
+	PortBindings  PortBindings `json:"portBindings" gorm:"type:text"`
+	RestartPolicy string       `json:"restartPolicy"`
+	// Restarts counts how often the task was started again after its
+	// container was lost.
+	Restarts    int       `json:"restarts"`
+	StartTime   time.Time `json:"startTime"`
+	EndTime     time.Time `json:"endTime"`
+	FinishTime  time.Time `json:"finishTime"`
+	Duration    time.Time `json:"duration"`
+	ContainerID string    `json:"containerId"`
+	Cpus        float32   `json:"cpus"`
+	ServiceID   uuid.UUID `json:"serviceId"`
+	Replica     int       `json:"replica"`
+	// What the container runs. Empty values keep the image's defaults.
+	Command    []string `json:"command" gorm:"serializer:json;type:text"`
+	Entrypoint []string `json:"entrypoint" gorm:"serializer:json;type:text"`
+	Env        []string `json:"env" gorm:"serializer:json;type:text"`
+	WorkingDir string   `json:"workingDir"`
+	User       string   `json:"user"`
+	Mounts     []Mount  `json:"mounts" gorm:"serializer:json;type:text"`
+	// Network the container joins, reachable there as the task's name and
+	// any of NetworkAliases. Empty means Docker's default bridge.
+	Network        string   `json:"network"`
+	NetworkAliases []string `json:"networkAliases" gorm:"serializer:json;type:text"`
+	// The host ports Docker bound once the container started, including
+	// those it picked itself.
+	Ports []PortBinding `json:"ports" gorm:"serializer:json;type:text"`
+	// One of Always, IfNotPresent or Never, empty means Always.
+	PullPolicy string `json:"pullPolicy"`
+	// Name of the RegistryCredential to pull the image with.
+	RegistryCredential string `json:"registryCredential"`
+	// How much of the image has been downloaded, in percent, while the
+	// task is Scheduled.
+	PullProgress int `json:"pullProgress"`
+	// Worker is the address of the worker a manager sent the task to.
+	// Empty on workers, and on a manager until the task was sent.
+	Worker string `json:"worker,omitempty"`
+	// HealthCheck is nil for tasks that are not checked.
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty" gorm:"serializer:json;type:text"`
+	// Health is one of the Health constants while the task is Running.
+	// HealthMessage says why the last check failed, and HealthFailures
+	// counts the failed checks in a row.
+	Health          string    `json:"health,omitempty"`
+	HealthMessage   string    `json:"healthMessage,omitempty"`
+	HealthFailures  int       `json:"healthFailures,omitempty"`
+	HealthCheckedAt time.Time `json:"healthCheckedAt,omitempty"`
 }
 
-type TaskEvent struct {
-	ID        uuid.UUID
-	State     State
-	Timestamp time.Time
-	Task      Task
+// ErrDiskUnsupported is returned when a task asks for a disk limit but
+// Docker's storage driver cannot enforce one. Only some drivers, such as
+// overlay2 on xfs mounted with pquota, support it.
+var ErrDiskUnsupported = errors.New("disk limits are not supported by the docker storage driver")
+
+// ErrNoCapacity is returned for tasks that do not fit in what is left of
+// the machine they were sent to.
+var ErrNoCapacity = errors.New("not enough resources")
+
+// Admitter is implemented by whatever knows how much room is left on its own
+// machine. Admit turns away tasks that do not fit with ErrNoCapacity, and
+// otherwise reserves their host ports and saves them before the next task is
+// checked.
+type Admitter interface {
+	Admit(t *Task, save func() error) error
 }
 
 type Docker struct {
-	Client      *client.Client
+	Runtime     dkrclient.Runtime
 	Config      config.Config
 	ContainerId string
+	// PullProgress, when set, is called with the percentage of the image
+	// downloaded as the pull goes on.
+	PullProgress func(percent int)
 }
 
 type DockerResult struct {
@@ -107,20 +177,15 @@ type DockerResult struct {
 
 func (d *Docker) Run() DockerResult {
 	ctx := context.Background()
-	reader, err := d.Client.ImagePull(
-		ctx, d.Config.Image, image.PullOptions{})
-
-	if err != nil {
-		log.Printf("Error pulling the image %s: %v\n", d.Config.Image, d.Config)
+	if err := d.pullImage(ctx); err != nil {
+		log.Printf("Error pulling the image %s: %v\n", d.Config.Image, err)
 		return DockerResult{Error: err}
 	}
 
-	defer reader.Close()
-
-	io.Copy(os.Stdout, reader)
-
-	restartPolicy := container.RestartPolicy{
-		Name: container.RestartPolicyMode(d.Config.RestartPolicy),
+	restartPolicy, err := ParseRestartPolicy(d.Config.RestartPolicy)
+	if err != nil {
+		log.Printf("Error parsing restart policy %s: %v\n", d.Config.RestartPolicy, err)
+		return DockerResult{Error: err}
 	}
 
 	resources := container.Resources{
@@ -128,20 +193,7 @@ func (d *Docker) Run() DockerResult {
 		NanoCPUs: int64(d.Config.Cpus * 1e9),
 	}
 
-	var result map[string]interface{}
-	err = json.Unmarshal([]byte(d.Config.PortBindings), &result)
-	if err != nil {
-		log.Printf("Error parsing JSON: %s", err)
-		return DockerResult{Error: err}
-	}
-
-	json_string, err := json.Marshal(result)
-	if err != nil {
-		log.Printf("Error parsing JSON: %s", err)
-		return DockerResult{Error: err}
-	}
-
-	portBindings, err := dkrclient.ConstructNatPortMap(string(json_string))
+	exposedPorts, portBindings, err := dkrclient.ConstructNatPorts(d.Config.PortBindings)
 	if err != nil {
 		log.Printf("Error parsing PortBindings: %v\n", err)
 		return DockerResult{Error: err}
@@ -154,60 +206,191 @@ func (d *Docker) Run() DockerResult {
 		PublishAllPorts: false,
 	}
 
-	exposed_ports, err := dkrclient.ConstructNatPortSet(result)
-	if err != nil {
-		log.Printf("Error parsing PortBindings: %v\n", d.Config.PortBindings)
+	for i, m := range d.Config.Mounts {
+		if m.Type != mount.TypeBind {
+			continue
+		}
+
+		source, err := ResolveHostPath(m.Source, config.VolumeSetting.AllowedHostPaths)
+		if err != nil {
+			log.Printf("Error mounting %s into container %s: %v\n", m.Source, d.Config.Name, err)
+			return DockerResult{Error: err}
+		}
+		d.Config.Mounts[i].Source = source
+	}
+
+	if err := d.createVolumes(ctx); err != nil {
+		log.Printf("Error creating volumes for container %s: %v\n", d.Config.Name, err)
 		return DockerResult{Error: err}
 	}
+	hostConfig.Mounts = d.Config.Mounts
+
+	var networkingConfig *network.NetworkingConfig
+	if d.Config.Network != "" {
+		if err := d.createNetwork(ctx); err != nil {
+			log.Printf("Error creating network %s: %v\n", d.Config.Network, err)
+			return DockerResult{Error: err}
+		}
+
+		hostConfig.NetworkMode = container.NetworkMode(d.Config.Network)
+		networkingConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				d.Config.Network: {Aliases: d.Config.NetworkAliases},
+			},
+		}
+	}
+
+	if d.Config.Disk > 0 {
+		hostConfig.StorageOpt = map[string]string{"size": fmt.Sprintf("%dM", d.Config.Disk)}
+	}
 
 	containerConfig := container.Config{
 		Image:        d.Config.Image,
+		Cmd:          d.Config.Cmd,
+		Entrypoint:   d.Config.Entrypoint,
 		Env:          d.Config.Env,
-		ExposedPorts: exposed_ports,
+		WorkingDir:   d.Config.WorkingDir,
+		User:         d.Config.User,
+		ExposedPorts: exposedPorts,
+		Labels:       d.Config.Labels,
+		Healthcheck:  d.Config.Healthcheck,
 	}
 
-	resp, err := d.Client.ContainerCreate(
-		ctx, &containerConfig, &hostConfig, nil, nil, d.Config.Name)
+	containerId, err := d.Runtime.Create(ctx, d.Config.Name, &containerConfig, &hostConfig, networkingConfig)
+	if err != nil && hostConfig.StorageOpt != nil && errdefs.IsInvalidParameter(err) && strings.Contains(strings.ToLower(err.Error()), "storage") {
+		err = fmt.Errorf("%w: %v", ErrDiskUnsupported, err)
+	}
 
 	if err != nil {
-		log.Printf("Error starting container %s: %v\n", resp.ID, err)
+		log.Printf("Error creating container %s: %v\n", d.Config.Name, err)
 		return DockerResult{Error: err}
 	}
 
-	err = d.Client.ContainerStart(
-		ctx, resp.ID, container.StartOptions{})
+	err = d.Runtime.Start(ctx, containerId)
 	if err != nil {
-		log.Printf("Error starting container %s: %v\n", resp.ID, err)
+		log.Printf("Error starting container %s: %v\n", containerId, err)
 		return DockerResult{Error: err}
 	}
 
-	d.ContainerId = resp.ID
-	out, err := d.Client.ContainerLogs(
-		ctx, resp.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	d.ContainerId = containerId
+
+	return DockerResult{
+		ContainerId: containerId,
+		Action:      "start",
+		Result:      "success",
+	}
+}
+
+// pullImage makes sure the image is present, pulling it when the pull
+// policy asks for it.
+func (d *Docker) pullImage(ctx context.Context) error {
+	policy := d.Config.PullPolicy
+	if policy == PullIfNotPresent || policy == PullNever {
+		_, err := d.Runtime.InspectImage(ctx, d.Config.Image)
+		if err == nil {
+			return nil
+		}
+		if !errdefs.IsNotFound(err) {
+			return err
+		}
+		if policy == PullNever {
+			return fmt.Errorf("image %s is not present and the pull policy is %s", d.Config.Image, PullNever)
+		}
+	}
+
+	reader, err := d.Runtime.Pull(ctx, d.Config.Image, image.PullOptions{RegistryAuth: d.Config.RegistryAuth})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	report := d.PullProgress
+	if report == nil {
+		report = func(int) {}
+	}
+	return readPullProgress(reader, report)
+}
+
+// createVolumes creates the named volumes the container mounts that do not
+// exist yet, labelled as joyboy's own. Volumes that already exist are used
+// as they are if joyboy created them or the operator allowed them.
+func (d *Docker) createVolumes(ctx context.Context) error {
+	for _, m := range d.Config.Mounts {
+		if m.Type != mount.TypeVolume {
+			continue
+		}
+
+		vol, err := d.Runtime.InspectVolume(ctx, m.Source)
+		if err == nil {
+			if err := ValidateVolume(vol.Name, vol.Labels, config.VolumeSetting.ExternalVolumes); err != nil {
+				return err
+			}
+			continue
+		}
+		if !errdefs.IsNotFound(err) {
+			return err
+		}
+
+		_, err = d.Runtime.CreateVolume(ctx, volume.CreateOptions{
+			Name:   m.Source,
+			Labels: map[string]string{dkrclient.ManagedLabel: "true"},
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Created volume %s\n", m.Source)
+	}
+
+	return nil
+}
+
+// createNetwork creates the container's network, labelled as joyboy's own,
+// unless it exists already.
+func (d *Docker) createNetwork(ctx context.Context) error {
+	_, err := d.Runtime.InspectNetwork(ctx, d.Config.Network)
+	if err == nil || !errdefs.IsNotFound(err) {
+		return err
+	}
 
+	_, err = d.Runtime.CreateNetwork(ctx, d.Config.Network, types.NetworkCreate{
+		Driver: "bridge",
+		Labels: map[string]string{dkrclient.ManagedLabel: "true"},
+	})
+	if errdefs.IsConflict(err) {
+		// Another task created it in the meantime.
+		return nil
+	}
 	if err != nil {
-		log.Printf("Error getting logs for container %s: %v\n", resp.ID, err)
+		return err
 	}
 
-	stdcopy.StdCopy(os.Stdout, os.Stderr, out)
+	log.Printf("Created network %s\n", d.Config.Network)
+	return nil
+}
 
-	return DockerResult{
-		ContainerId: resp.ID,
-		Action:      "start",
-		Result:      "success",
+// AssignedPorts reads back the host ports Docker bound for the container.
+func (d *Docker) AssignedPorts(id string) ([]PortBinding, error) {
+	info, err := d.Runtime.Inspect(context.Background(), id)
+	if err != nil {
+		return nil, err
 	}
+
+	if info.NetworkSettings == nil {
+		return nil, nil
+	}
+	return portsFromNat(info.NetworkSettings.Ports), nil
 }
 
 func (d *Docker) Stop(id string) DockerResult {
 	log.Printf("Attempting to stop container: %v", id)
 	ctx := context.Background()
-	err := d.Client.ContainerStop(ctx, id, container.StopOptions{})
+	err := d.Runtime.Stop(ctx, id, container.StopOptions{})
 	if err != nil {
 		log.Printf("Error stopping container %s: %v", id, err)
 		return DockerResult{Action: "stop", Result: "failure", Error: err}
 	}
 
-	err = d.Client.ContainerRemove(ctx, id, container.RemoveOptions{})
+	err = d.Runtime.Remove(ctx, id, container.RemoveOptions{})
 	if err != nil {
 		log.Printf("Error removing container %s: %v", id, err)
 		return DockerResult{Action: "stop", Result: "failure", Error: err}
@@ -218,25 +401,48 @@ func (d *Docker) Stop(id string) DockerResult {
 
 func (t *Task) NewConfig(task *Task) config.Config {
 	return config.Config{
-		Name:         task.Name,
-		Image:        task.Image,
-		Memory:       int64(task.Memory),
-		PortBindings: task.PortBindings,
+		Name:           task.Name,
+		Image:          task.Image,
+		Memory:         int64(task.Memory),
+		PortBindings:   task.PortBindings.Specs(),
+		Disk:           task.Disk,
+		Cpus:           task.Cpus,
+		RestartPolicy:  task.RestartPolicy,
+		Cmd:            task.Command,
+		Entrypoint:     task.Entrypoint,
+		Env:            task.Env,
+		WorkingDir:     task.WorkingDir,
+		User:           task.User,
+		Mounts:         dockerMounts(task.Mounts),
+		Network:        task.Network,
+		NetworkAliases: append([]string{task.Name}, task.NetworkAliases...),
+		PullPolicy:     task.PullPolicy,
+		Healthcheck:    task.HealthCheck.DockerConfig(),
+		Labels: map[string]string{
+			dkrclient.ManagedLabel:  "true",
+			dkrclient.TaskIDLabel:   task.ID.String(),
+			dkrclient.TaskNameLabel: task.Name,
+		},
 	}
 }
 
-func (t *Task) NewDocker(conf config.Config) (Docker, error) {
-	dc, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+func dockerMounts(mounts []Mount) []mount.Mount {
+	if len(mounts) == 0 {
+		return nil
+	}
 
-	if err != nil {
-		log.Printf("error creating docker client %v\n", err)
-		return Docker{}, err
+	dockerMounts := make([]mount.Mount, 0, len(mounts))
+	for _, m := range mounts {
+		dockerMounts = append(dockerMounts, m.DockerMount())
 	}
+	return dockerMounts
+}
 
+func (t *Task) NewDocker(conf config.Config, rt dkrclient.Runtime) Docker {
 	return Docker{
-		Config: conf,
-		Client: dc,
-	}, nil
+		Config:  conf,
+		Runtime: rt,
+	}
 }
 
 func Contains(states []string, state string) bool {
@@ -259,15 +465,25 @@ func GetTasksPerState(state string) []Task {
 	return tasks
 }
 
-func StopAllTasks() {
-	ctx := context.Background()
-	dc, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		log.Printf("error creating docker client %v\n", err)
+// StopAllTasks handles the containers of joyboy's tasks as joyboy shuts
+// down, according to mode:
+//   - ShutdownStop stops and removes them and marks their tasks Stopped.
+//     Only containers of tasks that are still Running, or being started, are
+//     touched, so the ones an earlier joyboy left running stay up.
+//   - ShutdownLeave leaves them running but marks their tasks Stopped, so
+//     joyboy no longer manages them.
+//   - ShutdownDetach leaves them and their tasks as they are, for the next
+//     joyboy to take over.
+//
+// Containers without ManagedLabel are never touched.
+func StopAllTasks(db *gorm.DB, rt dkrclient.Runtime, mode string) {
+	if mode == ShutdownDetach {
+		log.Printf("Leaving task containers running for the next joyboy to take over")
 		return
 	}
 
-	containers, err := dc.ContainerList(ctx, container.ListOptions{})
+	ctx := context.Background()
+	containers, err := rt.List(ctx, container.ListOptions{Filters: dkrclient.ManagedFilter()})
 	if err != nil {
 		log.Printf("error listing containers: %v\n", err)
 		return
@@ -275,22 +491,61 @@ func StopAllTasks() {
 
 	var containerIDs []string
 	for _, cntr := range containers {
+		if mode == ShutdownLeave {
+			containerIDs = append(containerIDs, cntr.ID)
+			continue
+		}
+
+		if owned, err := ownedByActiveTask(db, cntr); err != nil || !owned {
+			if err != nil {
+				log.Printf("error finding the task of container %s: %v\n", cntr.ID, err)
+			}
+			continue
+		}
+
 		fmt.Print("Stopping container ", cntr.ID[:10], "... ")
 		noWaitTimeout := 0
-		if err := dc.ContainerStop(ctx, cntr.ID, container.StopOptions{Timeout: &noWaitTimeout}); err != nil {
+		if err := rt.Stop(ctx, cntr.ID, container.StopOptions{Timeout: &noWaitTimeout}); err != nil {
 			log.Printf("error stopping container %s: %v\n", cntr.ID, err)
 			continue
 		}
 
-		if err := dc.ContainerRemove(ctx, cntr.ID, container.RemoveOptions{RemoveVolumes: true, Force: true}); err != nil {
+		if err := rt.Remove(ctx, cntr.ID, container.RemoveOptions{RemoveVolumes: true, Force: true}); err != nil {
 			log.Printf("error removing container %s: %v\n", cntr.ID, err)
 			continue
 		}
 		containerIDs = append(containerIDs, cntr.ID)
 	}
 
+	reason := "joyboy shut down"
+	if mode == ShutdownLeave {
+		reason = "joyboy shut down, container left running"
+	}
+
 	// Update DB entry
 	if len(containerIDs) > 0 {
-		database.GetDb().Model(&Task{}).Where("container_id IN ?", containerIDs).Update("state", Stopped.String())
+		var stopped []Task
+		db.Where("container_id IN ? AND state = ?", containerIDs, Running.String()).Find(&stopped)
+
+		for i := range stopped {
+			if err := TransitionDb(db, &stopped[i], Stopped, reason); err != nil {
+				log.Printf("Failed to mark task %v as stopped: %v\n", stopped[i].ID, err)
+			}
+		}
+	}
+}
+
+// ownedByActiveTask reports whether the container belongs to a Running task,
+// or carries the id of a Scheduled task whose start it is part of. Containers
+// of Stopped tasks were left running on purpose.
+func ownedByActiveTask(db *gorm.DB, c types.Container) (bool, error) {
+	id, err := uuid.Parse(c.Labels[dkrclient.TaskIDLabel])
+	if err != nil {
+		id = uuid.Nil
 	}
+
+	var count int64
+	result := db.Model(&Task{}).Where("(container_id = ? AND state = ?) OR (id = ? AND state = ?)",
+		c.ID, Running.String(), id, Scheduled.String()).Count(&count)
+	return count > 0, result.Error
 }
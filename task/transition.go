@@ -0,0 +1,59 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shashank-mugiwara/joyboy/database"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrIllegalTransition is returned for moves the state machine does not
+	// allow.
+	ErrIllegalTransition = errors.New("illegal state transition")
+	// ErrStaleState is returned when the task's stored state is no longer
+	// the one the caller moved it from, or the task is gone.
+	ErrStaleState = errors.New("task state changed concurrently")
+)
+
+// Transition moves the task to the given state in the application database.
+// See TransitionDb.
+func Transition(t *Task, to State, reason string, fields ...string) error {
+	return TransitionDb(database.GetDb(), t, to, reason, fields...)
+}
+
+// TransitionDb moves the task from t.State to the given state and saves its
+// start and finish times along with it, plus the columns named in fields.
+// Other columns are left as stored, as they are written concurrently by
+// health checks and pull progress. The write only succeeds if the stored
+// state is still t.State, and records a TaskEvent in the same transaction.
+// t.State is left untouched when the move is rejected.
+func TransitionDb(db *gorm.DB, t *Task, to State, reason string, fields ...string) error {
+	from := t.State
+	if !ValidStateTransition(from, to.String()) {
+		return fmt.Errorf("%w: %s to %s", ErrIllegalTransition, from, to)
+	}
+
+	updated := *t
+	updated.State = to.String()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Task{}).Where("id = ? AND state = ?", t.ID, from).Select(append([]string{"state", "start_time", "finish_time"}, fields...)).Updates(&updated)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: task %v is no longer %s", ErrStaleState, t.ID, from)
+		}
+
+		return RecordEvent(tx, t.ID, from, updated.State, reason)
+	})
+	if err != nil {
+		return err
+	}
+
+	t.State = updated.State
+	return nil
+}
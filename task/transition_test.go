@@ -0,0 +1,142 @@
+package task
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"gorm.io/gorm"
+)
+
+func newTestDb(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	return dbtest.Open(t, &Task{}, &TaskEvent{})
+}
+
+func TestTransitionMatrix(t *testing.T) {
+	legal := map[State][]State{
+		Pending:   {Scheduled},
+		Scheduled: {Scheduled, Running, Completed, Failed},
+		Running:   {Scheduled, Running, Completed, Failed, Stopped},
+		Completed: {},
+		Failed:    {},
+		Stopped:   {},
+	}
+
+	db := newTestDb(t)
+	for from := Pending; from <= Stopped; from++ {
+		for to := Pending; to <= Stopped; to++ {
+			want := false
+			for _, s := range legal[from] {
+				want = want || s == to
+			}
+
+			t.Run(from.String()+" to "+to.String(), func(t *testing.T) {
+				tk := Task{ID: uuid.New(), Name: "nginx", State: from.String()}
+				db.Create(&tk)
+
+				err := TransitionDb(db, &tk, to, "test")
+				if want && err != nil {
+					t.Fatalf("TransitionDb() error = %v, want nil", err)
+				}
+				if !want && !errors.Is(err, ErrIllegalTransition) {
+					t.Fatalf("TransitionDb() error = %v, want ErrIllegalTransition", err)
+				}
+
+				wantState := from.String()
+				if want {
+					wantState = to.String()
+				}
+
+				var stored Task
+				db.First(&stored, "id = ?", tk.ID)
+				if stored.State != wantState || tk.State != wantState {
+					t.Errorf("state = %v stored, %v in memory, want %v", stored.State, tk.State, wantState)
+				}
+
+				var events int64
+				db.Model(&TaskEvent{}).Where("task_id = ?", tk.ID).Count(&events)
+				if (events == 1) != want {
+					t.Errorf("events recorded = %d, want legal move %v", events, want)
+				}
+			})
+		}
+	}
+}
+
+func TestTransitionUnknownState(t *testing.T) {
+	db := newTestDb(t)
+
+	tk := Task{ID: uuid.New(), State: "Sleeping"}
+	db.Create(&tk)
+
+	if err := TransitionDb(db, &tk, Running, "test"); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("TransitionDb() from an unknown state error = %v, want ErrIllegalTransition", err)
+	}
+}
+
+func TestTransitionCompareAndSwap(t *testing.T) {
+	db := newTestDb(t)
+
+	tk := Task{ID: uuid.New(), Name: "nginx", State: Scheduled.String()}
+	db.Create(&tk)
+
+	// Someone else already started the task.
+	stale := tk
+	db.Model(&Task{ID: tk.ID}).Update("state", Running.String())
+
+	if err := TransitionDb(db, &stale, Failed, "test"); !errors.Is(err, ErrStaleState) {
+		t.Fatalf("TransitionDb() on a stale task error = %v, want ErrStaleState", err)
+	}
+	if stale.State != Scheduled.String() {
+		t.Errorf("rejected task state = %v, want it unchanged", stale.State)
+	}
+
+	missing := Task{ID: uuid.New(), State: Scheduled.String()}
+	if err := TransitionDb(db, &missing, Running, "test"); !errors.Is(err, ErrStaleState) {
+		t.Errorf("TransitionDb() on a missing task error = %v, want ErrStaleState", err)
+	}
+
+	var events int64
+	db.Model(&TaskEvent{}).Count(&events)
+	if events != 0 {
+		t.Errorf("events recorded for rejected moves = %d, want 0", events)
+	}
+}
+
+func TestTransitionSavesFields(t *testing.T) {
+	db := newTestDb(t)
+
+	tk := Task{ID: uuid.New(), Name: "nginx", State: Scheduled.String()}
+	db.Create(&tk)
+
+	// Written while the container was starting, by someone else.
+	db.Model(&Task{ID: tk.ID}).Update("pull_progress", 100)
+
+	tk.ContainerID = "abc123"
+	tk.StartTime = time.Now().UTC()
+	tk.Name = "renamed"
+	if err := TransitionDb(db, &tk, Running, "container started", "container_id"); err != nil {
+		t.Fatalf("TransitionDb() error = %v", err)
+	}
+
+	var stored Task
+	db.First(&stored, "id = ?", tk.ID)
+	if stored.ContainerID != "abc123" || stored.StartTime.IsZero() {
+		t.Errorf("stored task = %+v, want container id and start time saved", stored)
+	}
+	if stored.Name != "nginx" || stored.PullProgress != 100 {
+		t.Errorf("stored task = %+v, want name and pull progress left as stored", stored)
+	}
+
+	events, err := GetTaskEvents(db, tk.ID)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("GetTaskEvents() = %v, %v, want one event", events, err)
+	}
+	if events[0].OldState != Scheduled.String() || events[0].NewState != Running.String() || events[0].Reason != "container started" {
+		t.Errorf("event = %+v, want Scheduled to Running with its reason", events[0])
+	}
+}
@@ -0,0 +1,165 @@
+package taskqueue
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"gorm.io/gorm"
+)
+
+// TaskQueue is a first in, first out queue of tasks waiting to be acted on.
+// Implementations are safe for concurrent producers and consumers.
+type TaskQueue interface {
+	Enqueue(t task.Task) error
+	// Dequeue takes the oldest task off the queue. ok is false when the
+	// queue is empty.
+	Dequeue() (t task.Task, ok bool, err error)
+	Len() int
+	// Contains reports whether the task is waiting in the queue.
+	Contains(id uuid.UUID) (bool, error)
+	// Ready returns a channel that is closed the next time a task is
+	// enqueued. Consumers take it before calling Dequeue, so a task
+	// enqueued in between still wakes them.
+	Ready() <-chan struct{}
+}
+
+// QueuedTask is a task waiting in a DbQueue. The task is stored as it was
+// enqueued, since its state is what the consumer is asked to move it to.
+type QueuedTask struct {
+	Seq        uint64    `gorm:"primaryKey;autoIncrement"`
+	Queue      string    `gorm:"index"`
+	TaskID     uuid.UUID `gorm:"index"`
+	Task       task.Task `gorm:"serializer:json;type:text"`
+	EnqueuedAt time.Time
+}
+
+// DbQueue is a TaskQueue kept in the database, so queued tasks survive a
+// restart. Several queues can share a table, told apart by name. Within a
+// process all queue writes are serialised, which keeps sqlite from turning
+// concurrent producers away with a locked table.
+type DbQueue struct {
+	db   *gorm.DB
+	name string
+	mu   sync.Mutex
+
+	readyMu sync.Mutex
+	ready   chan struct{}
+}
+
+func NewDbQueue(db *gorm.DB, name string) *DbQueue {
+	return &DbQueue{db: db, name: name, ready: make(chan struct{})}
+}
+
+func (q *DbQueue) Enqueue(t task.Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.enqueue(t)
+}
+
+func (q *DbQueue) enqueue(t task.Task) error {
+	err := q.db.Create(&QueuedTask{
+		Queue:      q.name,
+		TaskID:     t.ID,
+		Task:       t,
+		EnqueuedAt: time.Now().UTC(),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	q.readyMu.Lock()
+	defer q.readyMu.Unlock()
+
+	close(q.ready)
+	q.ready = make(chan struct{})
+	return nil
+}
+
+func (q *DbQueue) Ready() <-chan struct{} {
+	q.readyMu.Lock()
+	defer q.readyMu.Unlock()
+
+	return q.ready
+}
+
+func (q *DbQueue) Dequeue() (task.Task, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		var head QueuedTask
+		result := q.db.Where(&QueuedTask{Queue: q.name}).Order("seq").Limit(1).Find(&head)
+		if result.Error != nil {
+			return task.Task{}, false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return task.Task{}, false, nil
+		}
+
+		// Another process sharing the database may have taken the same row,
+		// whoever deletes it owns the task.
+		result = q.db.Where("seq = ?", head.Seq).Delete(&QueuedTask{})
+		if result.Error != nil {
+			return task.Task{}, false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return head.Task, true, nil
+		}
+	}
+}
+
+func (q *DbQueue) Len() int {
+	var count int64
+	if result := q.db.Model(&QueuedTask{}).Where(&QueuedTask{Queue: q.name}).Count(&count); result.Error != nil {
+		log.Printf("Failed to count queued tasks: %v\n", result.Error)
+		return 0
+	}
+	return int(count)
+}
+
+func (q *DbQueue) Contains(id uuid.UUID) (bool, error) {
+	var count int64
+	result := q.db.Model(&QueuedTask{}).Where(&QueuedTask{Queue: q.name, TaskID: id}).Count(&count)
+	return count > 0, result.Error
+}
+
+// RequeueScheduled enqueues every Scheduled task that is not already queued.
+// Those are tasks that were taken off the queue but never
+// started, typically because the process stopped in between. It returns how
+// many tasks were enqueued.
+func (q *DbQueue) RequeueScheduled() (int, error) {
+	return q.RequeueScheduledWhere("")
+}
+
+// RequeueScheduledWhere is RequeueScheduled for only the Scheduled tasks
+// that also match the given condition, such as the ones a manager has not
+// sent to a worker yet. An empty condition matches every task.
+func (q *DbQueue) RequeueScheduledWhere(query string, args ...interface{}) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued := q.db.Model(&QueuedTask{}).Select("task_id").Where(&QueuedTask{Queue: q.name})
+
+	find := q.db.Where("state = ? AND id NOT IN (?)", task.Scheduled.String(), queued)
+	if query != "" {
+		find = find.Where(query, args...)
+	}
+
+	var scheduled []task.Task
+	result := find.Find(&scheduled)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	for i, t := range scheduled {
+		if err := q.enqueue(t); err != nil {
+			return i, err
+		}
+	}
+
+	return len(scheduled), nil
+}
@@ -0,0 +1,152 @@
+package taskqueue
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"gorm.io/gorm"
+)
+
+func newTestDb(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	return dbtest.Open(t, &task.Task{}, &QueuedTask{})
+}
+
+func TestDbQueueOrder(t *testing.T) {
+	db := newTestDb(t)
+	q := NewDbQueue(db, "worker")
+	other := NewDbQueue(db, "manager")
+
+	var ids []uuid.UUID
+	for _, state := range []task.State{task.Scheduled, task.Completed, task.Scheduled} {
+		id := uuid.New()
+		ids = append(ids, id)
+		if err := q.Enqueue(task.Task{ID: id, Name: "nginx", State: state.String()}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	if q.Len() != 3 || other.Len() != 0 {
+		t.Fatalf("Len() = %d and %d, want 3 and 0", q.Len(), other.Len())
+	}
+
+	for i, id := range ids {
+		got, ok, err := q.Dequeue()
+		if err != nil || !ok {
+			t.Fatalf("Dequeue() = %v, %v, want a task", ok, err)
+		}
+		if got.ID != id {
+			t.Errorf("Dequeue() %d = %v, want %v", i, got.ID, id)
+		}
+		if i == 1 && got.State != task.Completed.String() {
+			t.Errorf("Dequeue() state = %v, want the state it was enqueued with", got.State)
+		}
+	}
+
+	if _, ok, err := q.Dequeue(); ok || err != nil {
+		t.Errorf("Dequeue() on an empty queue = %v, %v, want false, nil", ok, err)
+	}
+}
+
+func TestDbQueueConcurrentConsumers(t *testing.T) {
+	db := newTestDb(t)
+	q := NewDbQueue(db, "worker")
+
+	const tasks = 50
+	var producers sync.WaitGroup
+	for i := 0; i < tasks; i++ {
+		producers.Add(1)
+		go func() {
+			defer producers.Done()
+			if err := q.Enqueue(task.Task{ID: uuid.New()}); err != nil {
+				t.Errorf("Enqueue() error = %v", err)
+			}
+		}()
+	}
+	producers.Wait()
+
+	var mu sync.Mutex
+	seen := make(map[uuid.UUID]int)
+	var consumers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				got, ok, err := q.Dequeue()
+				if err != nil {
+					t.Errorf("Dequeue() error = %v", err)
+					return
+				}
+				if !ok {
+					return
+				}
+				mu.Lock()
+				seen[got.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	consumers.Wait()
+
+	if len(seen) != tasks {
+		t.Errorf("dequeued %d distinct tasks, want %d", len(seen), tasks)
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("task %v dequeued %d times", id, n)
+		}
+	}
+}
+
+func TestRequeueScheduled(t *testing.T) {
+	db := newTestDb(t)
+	q := NewDbQueue(db, "worker")
+
+	queued := task.Task{ID: uuid.New(), Name: "queued", State: task.Scheduled.String()}
+	lost := task.Task{ID: uuid.New(), Name: "lost", State: task.Scheduled.String()}
+	running := task.Task{ID: uuid.New(), Name: "running", State: task.Running.String()}
+	for _, tk := range []task.Task{queued, lost, running} {
+		db.Create(&tk)
+	}
+	q.Enqueue(queued)
+
+	n, err := q.RequeueScheduled()
+	if err != nil {
+		t.Fatalf("RequeueScheduled() error = %v", err)
+	}
+	if n != 1 || q.Len() != 2 {
+		t.Fatalf("RequeueScheduled() = %d, queue length %d, want 1 and 2", n, q.Len())
+	}
+
+	q.Dequeue()
+	got, _, _ := q.Dequeue()
+	if got.ID != lost.ID {
+		t.Errorf("requeued task = %v, want %v", got.Name, lost.Name)
+	}
+}
+
+func TestRequeueScheduledWhere(t *testing.T) {
+	db := newTestDb(t)
+	q := NewDbQueue(db, "manager")
+
+	unsent := task.Task{ID: uuid.New(), Name: "unsent", State: task.Scheduled.String()}
+	sent := task.Task{ID: uuid.New(), Name: "sent", State: task.Scheduled.String(), Worker: "10.0.0.11:8070"}
+	for _, tk := range []task.Task{unsent, sent} {
+		db.Create(&tk)
+	}
+
+	n, err := q.RequeueScheduledWhere("worker = ''")
+	if err != nil {
+		t.Fatalf("RequeueScheduledWhere() error = %v", err)
+	}
+
+	got, _, _ := q.Dequeue()
+	if n != 1 || got.ID != unsent.ID {
+		t.Errorf("RequeueScheduledWhere() = %d, requeued %v, want 1 and %v", n, got.Name, unsent.Name)
+	}
+}
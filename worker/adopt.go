@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+// AdoptContainers takes over the task containers a previous joyboy left
+// behind, as it does when shut down in detach mode. Containers are matched
+// to their task by ContainerID, or by the joyboy.task.id label for tasks that
+// were still Scheduled because joyboy exited between creating the container
+// and recording it. Running containers keep, or now get, a Running task and
+// those that exited meanwhile complete or fail their task by exit code.
+// Containers no task is waiting for are left to the scheduler to flag as
+// orphans. It returns how many containers were adopted.
+func (w *Worker) AdoptContainers() (int, error) {
+	ctx := context.Background()
+	containers, err := w.Runtime.List(ctx, containerTypes.ListOptions{All: true, Filters: dkrclient.ManagedFilter()})
+	if err != nil {
+		return 0, err
+	}
+
+	adopted := 0
+	for _, c := range containers {
+		var t task.Task
+		result := w.DB.Where(&task.Task{ContainerID: c.ID}).Limit(1).Find(&t)
+		if result.Error != nil {
+			return adopted, result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			id, err := uuid.Parse(c.Labels[dkrclient.TaskIDLabel])
+			if err != nil {
+				continue
+			}
+
+			result = w.DB.Where("id = ? AND state = ?", id, task.Scheduled.String()).Limit(1).Find(&t)
+			if result.Error != nil {
+				return adopted, result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+		}
+
+		if t.State != task.Running.String() && t.State != task.Scheduled.String() {
+			continue
+		}
+
+		if err := w.adopt(ctx, &t, c.ID); err != nil {
+			log.Printf("Failed to adopt container %v of task %v: %v\n", c.ID, t.Name, err)
+			continue
+		}
+		adopted++
+	}
+
+	return adopted, nil
+}
+
+// adopt records the container as the task's and moves the task to the
+// state the container is in.
+func (w *Worker) adopt(ctx context.Context, t *task.Task, containerId string) error {
+	info, err := w.Runtime.Inspect(ctx, containerId)
+	if err != nil {
+		return err
+	}
+
+	t.ContainerID = containerId
+	if info.State.Running || info.State.Restarting {
+		d := task.Docker{Runtime: w.Runtime}
+		ports, err := d.AssignedPorts(containerId)
+		if err != nil {
+			log.Printf("Failed to read the ports of container %v: %v\n", containerId, err)
+		} else {
+			t.Ports = ports
+		}
+
+		if t.State == task.Scheduled.String() && t.StartTime.IsZero() {
+			t.StartTime = time.Now().UTC()
+		}
+		return task.TransitionDb(w.DB, t, task.Running, "container adopted after joyboy restarted", "container_id", "ports")
+	}
+
+	t.FinishTime = time.Now().UTC()
+	if info.State.ExitCode == 0 {
+		return task.TransitionDb(w.DB, t, task.Completed, "container exited while joyboy was down", "container_id")
+	}
+	return task.TransitionDb(w.DB, t, task.Failed, fmt.Sprintf("container exited with code %d while joyboy was down", info.State.ExitCode), "container_id")
+}
@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+func TestAdoptContainers(t *testing.T) {
+	w, rt := newTestWorker(t)
+
+	labels := func(id uuid.UUID, name string) container.Config {
+		return container.Config{Labels: map[string]string{
+			dkrclient.ManagedLabel:  "true",
+			dkrclient.TaskIDLabel:   id.String(),
+			dkrclient.TaskNameLabel: name,
+		}}
+	}
+
+	tasks := map[string]*task.Task{
+		"detached":  {State: task.Running.String(), ContainerID: "c-detached"},
+		"created":   {State: task.Scheduled.String()},
+		"crashed":   {State: task.Running.String(), ContainerID: "c-crashed"},
+		"finished":  {State: task.Running.String(), ContainerID: "c-finished"},
+		"forgotten": {State: task.Stopped.String(), ContainerID: "c-forgotten"},
+		"queued":    {State: task.Scheduled.String()},
+	}
+	for name, tk := range tasks {
+		tk.ID = uuid.New()
+		tk.Name = name
+		w.DB.Create(tk)
+	}
+
+	ports := nat.PortMap{"80/tcp": {{HostIP: "0.0.0.0", HostPort: "8080"}}}
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-detached", Name: "detached", Config: labels(tasks["detached"].ID, "detached"), Running: true, Ports: ports})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-created", Name: "created", Config: labels(tasks["created"].ID, "created"), Running: true})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-crashed", Name: "crashed", Config: labels(tasks["crashed"].ID, "crashed"), ExitCode: 137})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-finished", Name: "finished", Config: labels(tasks["finished"].ID, "finished")})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-forgotten", Name: "forgotten", Config: labels(tasks["forgotten"].ID, "forgotten"), Running: true})
+	rt.SetContainer(dkrclient.FakeContainer{ID: "c-foreign", Name: "queued", Running: true})
+
+	n, err := w.AdoptContainers()
+	if err != nil {
+		t.Fatalf("AdoptContainers() error = %v", err)
+	}
+	if n != 4 {
+		t.Errorf("AdoptContainers() = %d, want 4", n)
+	}
+
+	tests := []struct {
+		name        string
+		state       task.State
+		containerId string
+	}{
+		{"detached", task.Running, "c-detached"},
+		{"created", task.Running, "c-created"},
+		{"crashed", task.Failed, "c-crashed"},
+		{"finished", task.Completed, "c-finished"},
+		{"forgotten", task.Stopped, "c-forgotten"},
+		{"queued", task.Scheduled, ""},
+	}
+	for _, tt := range tests {
+		var stored task.Task
+		w.DB.Take(&stored, tasks[tt.name].ID)
+		if stored.State != tt.state.String() || stored.ContainerID != tt.containerId {
+			t.Errorf("task %v is %v with container %q, want %v with %q", tt.name, stored.State, stored.ContainerID, tt.state, tt.containerId)
+		}
+	}
+
+	var detached task.Task
+	w.DB.Take(&detached, tasks["detached"].ID)
+	if len(detached.Ports) != 1 || detached.Ports[0].HostPort != "8080" {
+		t.Errorf("ports of the adopted task = %+v, want 80 on 8080", detached.Ports)
+	}
+
+	// The task adopted while Scheduled may still be queued, and must not
+	// get a second container.
+	created := *tasks["created"]
+	if result := w.runTask(created); result.Error == nil {
+		t.Errorf("runTask() started a task that was adopted")
+	}
+	if c, ok := rt.Container("created"); !ok || c.ID != "c-created" {
+		t.Errorf("container of the adopted task = %+v, want c-created", c)
+	}
+}
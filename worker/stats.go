@@ -0,0 +1,305 @@
+package worker
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shashank-mugiwara/joyboy/node"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+// Sizes are reported in MiB, the same unit tasks ask for memory in.
+const mib = 1024 * 1024
+
+var (
+	procMemInfo = "/proc/meminfo"
+	procStat    = "/proc/stat"
+	procLoadAvg = "/proc/loadavg"
+	diskPath    = "/"
+)
+
+type MemInfo struct {
+	TotalKb     uint64 `json:"totalKb"`
+	AvailableKb uint64 `json:"availableKb"`
+}
+
+type DiskInfo struct {
+	Total uint64 `json:"total"`
+	Free  uint64 `json:"free"`
+}
+
+// CpuTimes are the jiffies of the aggregate cpu line in /proc/stat.
+type CpuTimes struct {
+	Idle  uint64 `json:"idle"`
+	Total uint64 `json:"total"`
+}
+
+type LoadAvg struct {
+	Last1Min  float64 `json:"last1Min"`
+	Last5Min  float64 `json:"last5Min"`
+	Last15Min float64 `json:"last15Min"`
+}
+
+type Stats struct {
+	Name        string
+	QueueLength int
+	TaskCount   int
+	Node        node.Node
+	Mem         MemInfo
+	Disk        DiskInfo
+	Cpu         CpuTimes
+	CpuUsage    float64
+	Load        LoadAvg
+	CollectedAt time.Time
+}
+
+// CollectStats takes a fresh snapshot of the host and of the tasks this
+// worker is responsible for, and keeps it as the latest snapshot. Anything
+// that cannot be read is logged and left at zero.
+func (w *Worker) CollectStats() Stats {
+	stats := Stats{
+		Name:        w.Name,
+		QueueLength: w.Queue.Len(),
+		CollectedAt: time.Now().UTC(),
+	}
+
+	mem, err := readMemInfo(procMemInfo)
+	if err != nil {
+		log.Printf("Failed to read memory info: %v\n", err)
+	}
+	stats.Mem = mem
+
+	cpu, cores, err := readCpuTimes(procStat)
+	if err != nil {
+		log.Printf("Failed to read cpu times: %v\n", err)
+	}
+	stats.Cpu = cpu
+
+	load, err := readLoadAvg(procLoadAvg)
+	if err != nil {
+		log.Printf("Failed to read load average: %v\n", err)
+	}
+	stats.Load = load
+
+	disk, err := readDiskInfo(diskPath)
+	if err != nil {
+		log.Printf("Failed to read disk info: %v\n", err)
+	}
+	stats.Disk = disk
+
+	var tasks []task.Task
+	result := w.DB.Where("state IN ?", []string{task.Scheduled.String(), task.Running.String()}).Find(&tasks)
+	if result.Error != nil {
+		log.Printf("Failed to fetch tasks for stats: %v\n", result.Error)
+	}
+
+	var memoryAllocated, diskAllocated int64
+	for _, t := range tasks {
+		memoryAllocated += t.Memory
+		diskAllocated += t.Disk
+		if t.State == task.Running.String() {
+			stats.TaskCount++
+		}
+	}
+
+	stats.Node = node.Node{
+		Name:            w.Name,
+		Cores:           cores,
+		Memory:          int(mem.TotalKb / 1024),
+		MemoryAllocated: int(memoryAllocated),
+		Disk:            int(disk.Total / mib),
+		DiskAllocated:   int(diskAllocated),
+		Load:            load.Last1Min,
+		Role:            "worker",
+		TaskCount:       stats.TaskCount,
+	}
+
+	w.statsMu.Lock()
+	defer w.statsMu.Unlock()
+
+	if w.stats != nil {
+		stats.CpuUsage = cpuUsage(w.stats.Cpu, stats.Cpu)
+	}
+	w.TaskCount = stats.TaskCount
+	w.stats = &stats
+
+	return stats
+}
+
+// LatestStats returns the last snapshot taken by CollectStats, collecting
+// one first if there is none yet.
+func (w *Worker) LatestStats() Stats {
+	w.statsMu.RLock()
+	stats := w.stats
+	w.statsMu.RUnlock()
+
+	if stats == nil {
+		return w.CollectStats()
+	}
+
+	return *stats
+}
+
+// canFit checks the task against the host's size from the latest snapshot
+// and what the Scheduled and Running tasks in the database are allocated
+// right now, as the snapshot is only taken every few seconds. A worker that
+// could not read its own resources accepts everything. The caller holds
+// admitMu.
+func (w *Worker) canFit(t task.Task) error {
+	n := w.LatestStats().Node
+
+	var allocated struct {
+		Memory int64
+		Disk   int64
+	}
+	result := w.DB.Model(&task.Task{}).Select("COALESCE(SUM(memory), 0) AS memory, COALESCE(SUM(disk), 0) AS disk").
+		Where("state IN ? AND id <> ?", []string{task.Scheduled.String(), task.Running.String()}, t.ID).Scan(&allocated)
+	if result.Error != nil {
+		return fmt.Errorf("failed to sum the resources of the tasks: %w", result.Error)
+	}
+
+	if left := int64(n.Memory) - allocated.Memory; n.Memory > 0 && t.Memory > left {
+		return fmt.Errorf("%w: task needs %d MiB of memory but only %d MiB is left on %s", task.ErrNoCapacity, t.Memory, left, w.Name)
+	}
+
+	if left := int64(n.Disk) - allocated.Disk; n.Disk > 0 && t.Disk > left {
+		return fmt.Errorf("%w: task needs %d MiB of disk but only %d MiB is left on %s", task.ErrNoCapacity, t.Disk, left, w.Name)
+	}
+
+	if n.Cores > 0 && t.Cpus > float32(n.Cores) {
+		return fmt.Errorf("%w: task needs %.2f cpus but %s only has %d cores", task.ErrNoCapacity, t.Cpus, w.Name, n.Cores)
+	}
+
+	return nil
+}
+
+func RunCollectStats(w *Worker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		w.CollectStats()
+		<-ticker.C
+	}
+}
+
+func cpuUsage(prev CpuTimes, cur CpuTimes) float64 {
+	total := float64(cur.Total) - float64(prev.Total)
+	idle := float64(cur.Idle) - float64(prev.Idle)
+	if total <= 0 {
+		return 0
+	}
+
+	return (total - idle) / total * 100
+}
+
+func readMemInfo(path string) (MemInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return MemInfo{}, err
+	}
+	defer f.Close()
+
+	var mem MemInfo
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return MemInfo{}, fmt.Errorf("malformed line in %s: %q", path, scanner.Text())
+		}
+
+		switch fields[0] {
+		case "MemTotal:":
+			mem.TotalKb = value
+		case "MemAvailable:":
+			mem.AvailableKb = value
+		}
+	}
+
+	return mem, scanner.Err()
+}
+
+// readCpuTimes returns the aggregate cpu times and the number of cpus listed
+// in /proc/stat.
+func readCpuTimes(path string) (CpuTimes, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return CpuTimes{}, 0, err
+	}
+	defer f.Close()
+
+	var times CpuTimes
+	cores := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		if fields[0] != "cpu" {
+			cores++
+			continue
+		}
+
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return CpuTimes{}, 0, fmt.Errorf("malformed cpu line in %s: %q", path, scanner.Text())
+			}
+
+			times.Total += value
+			// idle and iowait are the fourth and fifth columns
+			if i == 3 || i == 4 {
+				times.Idle += value
+			}
+		}
+	}
+
+	return times, cores, scanner.Err()
+}
+
+func readLoadAvg(path string) (LoadAvg, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return LoadAvg{}, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return LoadAvg{}, fmt.Errorf("malformed %s: %q", path, data)
+	}
+
+	var values [3]float64
+	for i := range values {
+		values[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return LoadAvg{}, fmt.Errorf("malformed %s: %q", path, data)
+		}
+	}
+
+	return LoadAvg{Last1Min: values[0], Last5Min: values[1], Last15Min: values[2]}, nil
+}
+
+func readDiskInfo(path string) (DiskInfo, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return DiskInfo{}, err
+	}
+
+	return DiskInfo{
+		Total: fs.Blocks * uint64(fs.Bsize),
+		Free:  fs.Bavail * uint64(fs.Bsize),
+	}, nil
+}
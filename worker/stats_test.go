@@ -0,0 +1,171 @@
+package worker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/node"
+	"github.com/shashank-mugiwara/joyboy/task"
+)
+
+func writeProcFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "proc")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write proc file: %v", err)
+	}
+	return path
+}
+
+func TestReadMemInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    MemInfo
+		wantErr bool
+	}{
+		{
+			name:    "total and available",
+			content: "MemTotal:       16318044 kB\nMemFree:         1017164 kB\nMemAvailable:    9021840 kB\nHugePages_Total:       0\n",
+			want:    MemInfo{TotalKb: 16318044, AvailableKb: 9021840},
+		},
+		{
+			name:    "no available line",
+			content: "MemTotal:       2048 kB\n",
+			want:    MemInfo{TotalKb: 2048},
+		},
+		{
+			name:    "malformed value",
+			content: "MemTotal:       lots kB\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readMemInfo(writeProcFile(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readMemInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("readMemInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCpuTimes(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		want      CpuTimes
+		wantCores int
+		wantErr   bool
+	}{
+		{
+			name:      "two cores",
+			content:   "cpu  10 0 5 80 5 0 0 0 0 0\ncpu0 5 0 2 40 3 0 0 0 0 0\ncpu1 5 0 3 40 2 0 0 0 0 0\nintr 12345\n",
+			want:      CpuTimes{Idle: 85, Total: 100},
+			wantCores: 2,
+		},
+		{
+			name:    "malformed value",
+			content: "cpu  10 x 5 80\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cores, err := readCpuTimes(writeProcFile(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readCpuTimes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want || cores != tt.wantCores {
+				t.Errorf("readCpuTimes() = %+v, %d, want %+v, %d", got, cores, tt.want, tt.wantCores)
+			}
+		})
+	}
+}
+
+func TestReadLoadAvg(t *testing.T) {
+	got, err := readLoadAvg(writeProcFile(t, "0.52 0.58 0.59 1/1234 56789\n"))
+	if err != nil {
+		t.Fatalf("readLoadAvg() error = %v", err)
+	}
+
+	want := LoadAvg{Last1Min: 0.52, Last5Min: 0.58, Last15Min: 0.59}
+	if got != want {
+		t.Errorf("readLoadAvg() = %+v, want %+v", got, want)
+	}
+
+	if _, err := readLoadAvg(writeProcFile(t, "0.52\n")); err == nil {
+		t.Errorf("readLoadAvg() on truncated file error = nil, want error")
+	}
+}
+
+func TestCpuUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		prev CpuTimes
+		cur  CpuTimes
+		want float64
+	}{
+		{name: "half busy", prev: CpuTimes{Idle: 100, Total: 200}, cur: CpuTimes{Idle: 150, Total: 300}, want: 50},
+		{name: "idle", prev: CpuTimes{Idle: 100, Total: 200}, cur: CpuTimes{Idle: 200, Total: 300}, want: 0},
+		{name: "no time passed", prev: CpuTimes{Idle: 100, Total: 200}, cur: CpuTimes{Idle: 100, Total: 200}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cpuUsage(tt.prev, tt.cur); got != tt.want {
+				t.Errorf("cpuUsage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdmitCountsTasksSinceLastStats(t *testing.T) {
+	w, _ := newTestWorker(t)
+	w.stats = &Stats{Node: node.Node{Memory: 1000, Disk: 1000, Cores: 4}}
+
+	// Saved after the snapshot was taken.
+	w.DB.Create(&task.Task{ID: uuid.New(), Name: "db", State: task.Running.String(), Memory: 600})
+	w.DB.Create(&task.Task{ID: uuid.New(), Name: "done", State: task.Completed.String(), Memory: 1000})
+
+	saved := 0
+	save := func() error { saved++; return nil }
+	if err := w.Admit(&task.Task{ID: uuid.New(), Memory: 401}, save); !errors.Is(err, task.ErrNoCapacity) || saved != 0 {
+		t.Errorf("Admit() for more than is left error = %v, saved %d times, want ErrNoCapacity and no save", err, saved)
+	}
+
+	// Of two tasks that each fit on their own only the first is saved.
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tk := task.Task{ID: uuid.New(), Name: "cache", State: task.Scheduled.String(), Memory: 300}
+			errs[i] = w.Admit(&tk, func() error { return w.DB.Create(&tk).Error })
+		}(i)
+	}
+	wg.Wait()
+
+	if (errs[0] == nil) == (errs[1] == nil) {
+		t.Errorf("Admit() errors = %v, want exactly one ErrNoCapacity", errs)
+	}
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, task.ErrNoCapacity) {
+			t.Errorf("Admit() error = %v, want ErrNoCapacity", err)
+		}
+	}
+}
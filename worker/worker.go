@@ -4,34 +4,110 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"sync"
 	"time"
 
 	containerTypes "github.com/docker/docker/api/types/container"
-	"github.com/golang-collections/collections/queue"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/pkg/metrics"
+	"github.com/shashank-mugiwara/joyboy/portalloc"
 	"github.com/shashank-mugiwara/joyboy/task"
-	"github.com/shashank-mugiwara/joyboy/utils"
+	"github.com/shashank-mugiwara/joyboy/taskqueue"
 	"gorm.io/gorm"
 )
 
-type Worker struct {
-	Name      string
-	Queue     *queue.Queue
-	DB        *gorm.DB
-	TaskCount int
+// startDuration is how long tasks took from being picked up to running,
+// pulling their image included.
+var startDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "joyboy_task_start_duration_seconds",
+	Help:    "Time from a task being picked up until its container runs, image pull included.",
+	Buckets: []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+})
+
+func init() {
+	prometheus.MustRegister(startDuration)
 }
 
-func (w *Worker) CollectStats() {
-	fmt.Println("I will collect stats")
+type Worker struct {
+	Name    string
+	Queue   taskqueue.TaskQueue
+	DB      *gorm.DB
+	Runtime dkrclient.Runtime
+	// Ports is nil when host ports are left entirely to Docker.
+	Ports *portalloc.Allocator
+	// CredentialKey decrypts the passwords of registry credentials.
+	CredentialKey []byte
+	TaskCount     int
+
+	stats   *Stats
+	statsMu sync.RWMutex
+
+	// admitMu is held from checking that a task fits until it is saved, so
+	// two tasks cannot both take the room that is left.
+	admitMu sync.Mutex
+
+	// starting holds the tasks taken off the queue that are still being
+	// run, so they are not mistaken for tasks the queue lost.
+	starting   map[uuid.UUID]bool
+	startingMu sync.Mutex
 }
 
 func (w *Worker) RunTask() task.DockerResult {
-	if w.Queue.Len() == 0 {
+	t, ok, err := w.dequeue()
+	if err != nil {
+		log.Printf("Failed to take a task off the queue: %v\n", err)
+		return task.DockerResult{Error: err}
+	}
+
+	if !ok {
 		log.Println("No tasks in queue")
 		return task.DockerResult{Error: nil}
 	}
+	defer w.finished(t.ID)
+
+	return w.runTask(t)
+}
+
+// dequeue takes the next task off the queue and marks it as being run, in
+// one step as far as Pending can tell.
+func (w *Worker) dequeue() (task.Task, bool, error) {
+	w.startingMu.Lock()
+	defer w.startingMu.Unlock()
+
+	t, ok, err := w.Queue.Dequeue()
+	if ok {
+		if w.starting == nil {
+			w.starting = make(map[uuid.UUID]bool)
+		}
+		w.starting[t.ID] = true
+	}
+	return t, ok, err
+}
+
+func (w *Worker) finished(id uuid.UUID) {
+	w.startingMu.Lock()
+	defer w.startingMu.Unlock()
+
+	delete(w.starting, id)
+}
+
+// Pending reports whether the task is waiting in the queue or being run.
+func (w *Worker) Pending(id uuid.UUID) (bool, error) {
+	w.startingMu.Lock()
+	defer w.startingMu.Unlock()
+
+	if w.starting[id] {
+		return true, nil
+	}
+	return w.Queue.Contains(id)
+}
 
-	t := w.Queue.Dequeue().(task.Task)
+// runTask moves a task taken off the queue to the state it was queued with.
+func (w *Worker) runTask(t task.Task) task.DockerResult {
 	var taskPersisted task.Task
 	taskPerResult := w.DB.Where(&task.Task{ID: t.ID}).Find(&taskPersisted)
 	if taskPerResult.RowsAffected == 0 || taskPerResult.Error != nil {
@@ -42,40 +118,34 @@ func (w *Worker) RunTask() task.DockerResult {
 		}
 	}
 
-	var result task.DockerResult
-	if task.ValidStateTransition(taskPersisted.State, t.State) {
-		switch t.State {
-		case task.Scheduled.String():
-			result = w.StartTask(&t)
-		case task.Completed.String():
-			result = w.StopTask(&t)
-		default:
-			result.Error = errors.New("we should not run this task")
+	if !task.ValidStateTransition(taskPersisted.State, t.State) {
+		return task.DockerResult{
+			Error: fmt.Errorf("invalid transition from %v to %v", taskPersisted.State, t.State),
 		}
-	} else {
-		err := fmt.Errorf("invalid transition from %v to %v", taskPersisted.State, t.State)
-		result.Error = err
 	}
 
-	t.ContainerID = result.ContainerId
-	updatedTask := w.DB.Save(&t)
-	if updatedTask.Error != nil {
-		log.Println("Failed to update task in DB after stopping it.")
-		return task.DockerResult{
-			Error:   updatedTask.Error,
-			Message: "Please check the container might still be running. You can use 'docker stop [container-id]' to stop and 'docker rm [container-id]'",
+	switch t.State {
+	case task.Scheduled.String():
+		// A task whose container was adopted meanwhile is already running.
+		if taskPersisted.State != task.Scheduled.String() {
+			return task.DockerResult{
+				Error: fmt.Errorf("task %v is already %v", t.ID, taskPersisted.State),
+			}
 		}
+		return w.StartTask(&taskPersisted)
+	case task.Completed.String():
+		return w.StopTask(&t)
+	default:
+		return task.DockerResult{Error: errors.New("we should not run this task")}
 	}
-
-	return result
 }
 
+// StopTask stops the task's container and removes the task. A task that has
+// not been started yet is only removed, and a failed one is removed without
+// touching Docker.
 func (w *Worker) StopTask(t *task.Task) task.DockerResult {
 	config := t.NewConfig(t)
-	d, err := t.NewDocker(config)
-	if err != nil {
-		return task.DockerResult{Error: err}
-	}
+	d := t.NewDocker(config, w.Runtime)
 
 	var runningTask task.Task
 	getResult := w.DB.First(&runningTask, t.ID)
@@ -86,102 +156,248 @@ func (w *Worker) StopTask(t *task.Task) task.DockerResult {
 		}
 	}
 
-	if !utils.IsBlank(runningTask.State) {
-		if runningTask.State == "Failed" {
-			log.Println("The given task was found in failed state. Removing the task as per request")
-			w.DB.Delete(runningTask)
+	switch runningTask.State {
+	case task.Failed.String():
+		log.Println("The given task was found in failed state. Removing the task as per request")
+		w.DB.Delete(runningTask)
+		return task.DockerResult{
+			Error:   errors.New("failed task was found, so deleted as per request"),
+			Message: "Failed Task found with given id: " + t.ID.String() + " deleted.",
+		}
+	case task.Scheduled.String():
+		runningTask.FinishTime = time.Now().UTC()
+		if err := task.TransitionDb(w.DB, &runningTask, task.Completed, "stopped before it was started"); err != nil {
 			return task.DockerResult{
-				Error:   errors.New("failed task was found, so deleted as per request"),
-				Message: "Failed Task found with given id: " + t.ID.String() + " deleted.",
+				Error:   err,
+				Message: "Failed to stop task " + t.ID.String() + ", it may have just been started. Please try again.",
 			}
 		}
-	} else {
+
+		*t = runningTask
+		return w.removeStoppedTask(t, task.DockerResult{Action: "stop", Result: "success", Message: "Task stopped before it was started."})
+	case task.Running.String():
+		// Stopped below.
+	case "":
 		return task.DockerResult{
 			Error:   errors.New("no tasks found for the given Id"),
 			Message: "Failed to stop task. No Task found with given id: " + t.ID.String(),
 		}
+	default:
+		return task.DockerResult{
+			Error:   fmt.Errorf("task is %s and cannot be stopped", runningTask.State),
+			Message: "Failed to stop task with given id: " + t.ID.String(),
+		}
 	}
 
 	result := d.Stop(runningTask.ContainerID)
 	if result.Error != nil {
-		log.Printf("Error stopping container %v: %v", t.ContainerID, result.Error)
+		log.Printf("Error stopping container %v: %v", runningTask.ContainerID, result.Error)
 		return task.DockerResult{
 			Error:   result.Error,
 			Message: "Please check the container might still be running. You can use 'docker stop [container-id]' to stop and 'docker rm [container-id]'",
 		}
 	}
 
-	t.FinishTime = time.Now().UTC()
-	t.State = task.Completed.String()
-	t.ID = runningTask.ID
-	updatedTask := w.DB.Save(&t)
-	if updatedTask.Error != nil {
+	runningTask.FinishTime = time.Now().UTC()
+	if err := task.TransitionDb(w.DB, &runningTask, task.Completed, "container stopped on request"); err != nil {
 		log.Println("Failed to update task in DB after stopping it.")
 		return task.DockerResult{
-			Error:   updatedTask.Error,
-			Message: "Please check the container might still be running. You can use 'docker stop [container-id]' to stop and 'docker rm [container-id]'",
+			Error:   err,
+			Message: "The container was stopped but the task could not be updated.",
 		}
 	}
 
-	log.Printf("Stopped and removed the container %v for task %v", t.ContainerID, t.ID)
+	log.Printf("Stopped and removed the container %v for task %v", runningTask.ContainerID, runningTask.ID)
+	*t = runningTask
 	result.ContainerId = runningTask.ContainerID
 	result.Message = "Container stopped successfully!"
-	deleteResult := w.DB.Delete(&t)
+	return w.removeStoppedTask(t, result)
+}
+
+func (w *Worker) removeStoppedTask(t *task.Task, result task.DockerResult) task.DockerResult {
+	deleteResult := w.DB.Delete(&task.Task{ID: t.ID})
 	if deleteResult.Error != nil {
 		log.Println("Failed to delete task in DB after stopping it.")
 		return task.DockerResult{
 			Error:   deleteResult.Error,
-			Message: "Please check the container might still be running. You can use 'docker stop [container-id]' to stop and 'docker rm [container-id]'",
+			Message: "The task was stopped but could not be removed from the database.",
 		}
 	}
 
 	return result
 }
 
+// StartTask runs the task's container and moves the task to Running, or to
+// Failed when the container could not be started.
 func (w *Worker) StartTask(t *task.Task) task.DockerResult {
 	t.StartTime = time.Now().UTC()
 	config := t.NewConfig(t)
-	d, err := t.NewDocker(config)
-	if err != nil {
-		return task.DockerResult{Error: err}
-	}
 
-	result := d.Run()
+	auth, err := w.registryAuth(t)
+	config.RegistryAuth = auth
+
+	d := t.NewDocker(config, w.Runtime)
+	d.PullProgress = func(percent int) { w.recordPullProgress(t, percent) }
+
+	result := task.DockerResult{Error: err}
+	if err == nil {
+		result = d.Run()
+	}
 
 	if result.Error != nil {
 		log.Printf("Error running task %v: %v\n", t.ID, result.Error)
-		t.State = task.Failed.String()
 
-		err := d.Client.ContainerRemove(context.Background(), d.Config.Name, containerTypes.RemoveOptions{Force: true})
+		err := d.Runtime.Remove(context.Background(), d.Config.Name, containerTypes.RemoveOptions{Force: true})
 		if err != nil {
 			log.Printf("Failed to remove container. Error is %+v\n", err)
 		}
 
+		t.FinishTime = time.Now().UTC()
+		if err := task.TransitionDb(w.DB, t, task.Failed, "failed to start container: "+result.Error.Error()); err != nil {
+			log.Printf("Failed to mark task %v as failed: %v\n", t.ID, err)
+		}
+
 		return task.DockerResult{
 			Error:       result.Error,
 			ContainerId: t.ContainerID,
 			Action:      "Failed",
 		}
+	}
 
+	t.ContainerID = result.ContainerId
+	ports, err := d.AssignedPorts(result.ContainerId)
+	if err != nil {
+		log.Printf("Failed to read the ports of container %v: %v\n", result.ContainerId, err)
+	}
+	t.Ports = ports
+
+	if err := task.TransitionDb(w.DB, t, task.Running, "container started", "container_id", "ports"); err != nil {
+		// The task was stopped while its container was starting, so the
+		// container has no task left to belong to.
+		log.Printf("Failed to mark task %v as running: %v\n", t.ID, err)
+		d.Stop(result.ContainerId)
+		return task.DockerResult{Error: err, ContainerId: result.ContainerId}
 	}
+	startDuration.Observe(time.Since(t.StartTime).Seconds())
 
-	t.State = task.Running.String()
 	return result
 }
 
-func (w *Worker) AddTask(t task.Task) {
-	w.Queue.Enqueue(t)
+// registryAuth returns the encoded login of the registry credential the task
+// pulls its image with, if any.
+func (w *Worker) registryAuth(t *task.Task) (string, error) {
+	if t.RegistryCredential == "" {
+		return "", nil
+	}
+
+	cred, err := task.FindRegistryCredential(w.DB, t.RegistryCredential)
+	if err != nil {
+		return "", err
+	}
+	return cred.EncodedAuth(w.CredentialKey)
+}
+
+// recordPullProgress stores how far the pull of the task's image has got,
+// so it can be followed through the API while the task is Scheduled.
+func (w *Worker) recordPullProgress(t *task.Task, percent int) {
+	t.PullProgress = percent
+	result := w.DB.Model(&task.Task{}).Where("id = ? AND state = ?", t.ID, task.Scheduled.String()).Update("pull_progress", percent)
+	if result.Error != nil {
+		log.Printf("Failed to record pull progress of task %v: %v\n", t.ID, result.Error)
+	}
+}
+
+func (w *Worker) AddTask(t task.Task) error {
+	return w.Queue.Enqueue(t)
+}
+
+// TaskLogs returns the logs of the task's container, multiplexed the way
+// Docker sends them.
+func (w *Worker) TaskLogs(ctx context.Context, t task.Task, options containerTypes.LogsOptions) (io.ReadCloser, error) {
+	return w.Runtime.Logs(ctx, t.ContainerID, options)
+}
+
+// TaskUsage reads what the task's container is using.
+func (w *Worker) TaskUsage(ctx context.Context, t task.Task) (metrics.Usage, error) {
+	stat, err := w.Runtime.Stats(ctx, t.ContainerID)
+	if err != nil {
+		return metrics.Usage{}, err
+	}
+	return metrics.NewUsage(stat), nil
+}
+
+// Admit checks the task fits in what is left of the worker, then reserves
+// its host ports and saves it before any other task is checked.
+func (w *Worker) Admit(t *task.Task, save func() error) error {
+	w.admitMu.Lock()
+	defer w.admitMu.Unlock()
+
+	if err := w.canFit(*t); err != nil {
+		return err
+	}
+	return w.ReservePorts(t, save)
+}
+
+func (w *Worker) ReservePorts(t *task.Task, save func() error) error {
+	if w.Ports == nil {
+		return save()
+	}
+	return w.Ports.Reserve(t, save)
+}
+
+func (w *Worker) CheckPorts(bindings task.PortBindings) error {
+	if w.Ports == nil {
+		return nil
+	}
+	return w.Ports.Check(bindings)
 }
 
-func RunTasks(w Worker) {
-	for {
-		if w.Queue.Len() != 0 {
-			result := w.RunTask()
-			if result.Error != nil {
+// RunTasks runs queued tasks on a pool of the given number of goroutines,
+// each picking up work as soon as it is enqueued. It returns once ctx is
+// cancelled and the tasks that were already being run have finished.
+func RunTasks(ctx context.Context, w *Worker, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runQueuedTasks(ctx, w)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func runQueuedTasks(ctx context.Context, w *Worker) {
+	// Tasks enqueued by another process sharing the database do not wake
+	// this one, so the queue is still checked every now and then.
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		ready := w.Queue.Ready()
+
+		t, ok, err := w.dequeue()
+		if err != nil {
+			log.Printf("Failed to take a task off the queue: %v\n", err)
+		}
+
+		if ok {
+			if result := w.runTask(t); result.Error != nil {
 				log.Printf("Error running task: %v", result.Error)
 			}
+			w.finished(t.ID)
+			continue
 		}
 
-		time.Sleep(5 * time.Second)
+		select {
+		case <-ctx.Done():
+		case <-ready:
+		case <-ticker.C:
+		}
 	}
 }
@@ -0,0 +1,321 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/errdefs"
+	"github.com/google/uuid"
+	"github.com/shashank-mugiwara/joyboy/database/dbtest"
+	"github.com/shashank-mugiwara/joyboy/dkrclient"
+	"github.com/shashank-mugiwara/joyboy/task"
+	"github.com/shashank-mugiwara/joyboy/taskqueue"
+)
+
+func newTestWorker(t *testing.T) (*Worker, *dkrclient.FakeRuntime) {
+	t.Helper()
+
+	db := dbtest.Open(t, &task.Task{}, &task.TaskEvent{}, &task.RegistryCredential{}, &taskqueue.QueuedTask{})
+
+	rt := dkrclient.NewFakeRuntime()
+	return &Worker{Name: "test", Queue: taskqueue.NewDbQueue(db, "worker"), DB: db, Runtime: rt}, rt
+}
+
+func TestRunTasksPicksUpWorkImmediately(t *testing.T) {
+	w, _ := newTestWorker(t)
+	q := w.Queue
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunTasks(ctx, w, 3)
+		close(done)
+	}()
+
+	// The tasks have no row, so each is dropped as soon as it is taken off
+	// the queue without ever reaching docker.
+	for i := 0; i < 10; i++ {
+		if err := w.AddTask(task.Task{ID: uuid.New(), State: task.Scheduled.String()}); err != nil {
+			t.Fatalf("AddTask() error = %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for q.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue length after a second = %d, want 0", q.Len())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("RunTasks() did not return after its context was cancelled")
+	}
+}
+
+func TestStartAndStopTask(t *testing.T) {
+	tests := []struct {
+		name           string
+		state          task.State
+		pullErr        error
+		stop           bool
+		wantState      string
+		wantContainers int
+	}{
+		{name: "start", state: task.Scheduled, wantState: task.Running.String(), wantContainers: 1},
+		{name: "image pull fails", state: task.Scheduled, pullErr: errors.New("pull access denied"), wantState: task.Failed.String()},
+		{name: "stop running task", state: task.Scheduled, stop: true},
+		{name: "stop task that never started", state: task.Scheduled, pullErr: errors.New("not reached"), stop: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, rt := newTestWorker(t)
+
+			tk := task.Task{ID: uuid.New(), Name: "nginx", Image: "nginx:stable", State: tt.state.String(), PortBindings: task.PortBindings{{ContainerPort: "80", HostPort: "8080"}}}
+			w.DB.Create(&tk)
+
+			if !tt.stop || tt.pullErr == nil {
+				rt.FailOn("Pull", tt.pullErr)
+				w.AddTask(tk)
+				w.RunTask()
+			}
+
+			if tt.stop {
+				if result := w.StopTask(&task.Task{ID: tk.ID}); result.Error != nil {
+					t.Fatalf("StopTask() error = %v", result.Error)
+				}
+
+				var count int64
+				w.DB.Model(&task.Task{}).Where("id = ?", tk.ID).Count(&count)
+				if count != 0 {
+					t.Errorf("stopped task is still in the db")
+				}
+			} else {
+				var stored task.Task
+				w.DB.First(&stored, "id = ?", tk.ID)
+				if stored.State != tt.wantState {
+					t.Errorf("task state = %v, want %v", stored.State, tt.wantState)
+				}
+				if tt.wantContainers > 0 && stored.ContainerID == "" {
+					t.Errorf("running task has no container id")
+				}
+			}
+
+			if got := len(rt.Containers()); got != tt.wantContainers {
+				t.Errorf("containers = %d, want %d", got, tt.wantContainers)
+			}
+
+			events, _ := task.GetTaskEvents(w.DB, tk.ID)
+			if tt.wantState != "" && (len(events) != 1 || events[0].NewState != tt.wantState) {
+				t.Errorf("events = %+v, want one move to %v", events, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestStartTaskAppliesContainerConfig(t *testing.T) {
+	w, rt := newTestWorker(t)
+
+	tk := task.Task{
+		ID:           uuid.New(),
+		Name:         "echo",
+		Image:        "busybox",
+		State:        task.Scheduled.String(),
+		Command:      []string{"-c", "echo $GREETING"},
+		Entrypoint:   []string{"/bin/sh"},
+		Env:          []string{"GREETING=hello"},
+		WorkingDir:   "/tmp",
+		User:         "nobody",
+		Network:      "demo",
+		PortBindings: task.PortBindings{{ContainerPort: "53", Protocol: "udp", HostIP: "127.0.0.1"}},
+		HealthCheck:  &task.HealthCheck{Cmd: []string{"CMD-SHELL", "test -f /tmp/ready"}, Retries: 2},
+		Mounts: []task.Mount{
+			{Type: "volume", Source: "echo-data", Target: "/data"},
+			{Type: "tmpfs", Target: "/scratch", Size: 16},
+		},
+	}
+	w.DB.Create(&tk)
+
+	if result := w.StartTask(&tk); result.Error != nil {
+		t.Fatalf("StartTask() error = %v", result.Error)
+	}
+
+	var stored task.Task
+	w.DB.First(&stored, "id = ?", tk.ID)
+	if !reflect.DeepEqual(stored.Command, tk.Command) || !reflect.DeepEqual(stored.Env, tk.Env) {
+		t.Errorf("stored command %v and env %v, want %v and %v", stored.Command, stored.Env, tk.Command, tk.Env)
+	}
+
+	wantPorts := []task.PortBinding{{ContainerPort: "53", Protocol: "udp", HostIP: "127.0.0.1", HostPort: "32768"}}
+	if !reflect.DeepEqual(stored.Ports, wantPorts) {
+		t.Errorf("assigned ports = %+v, want %+v", stored.Ports, wantPorts)
+	}
+
+	c, ok := rt.Container("echo")
+	if !ok {
+		t.Fatalf("no container was created")
+	}
+
+	got := c.Config
+	if !reflect.DeepEqual([]string(got.Cmd), tk.Command) || !reflect.DeepEqual([]string(got.Entrypoint), tk.Entrypoint) ||
+		!reflect.DeepEqual(got.Env, tk.Env) || got.WorkingDir != tk.WorkingDir || got.User != tk.User {
+		t.Errorf("container config = %+v", got)
+	}
+
+	if got.Healthcheck == nil || !reflect.DeepEqual(got.Healthcheck.Test, tk.HealthCheck.Cmd) || got.Healthcheck.Retries != 2 {
+		t.Errorf("container healthcheck = %+v, want %+v", got.Healthcheck, tk.HealthCheck)
+	}
+
+	wantLabels := map[string]string{dkrclient.ManagedLabel: "true", dkrclient.TaskIDLabel: tk.ID.String(), dkrclient.TaskNameLabel: "echo"}
+	if !reflect.DeepEqual(got.Labels, wantLabels) {
+		t.Errorf("container labels = %v, want %v", got.Labels, wantLabels)
+	}
+
+	mounts := c.HostConfig.Mounts
+	if len(mounts) != 2 || mounts[0].Source != "echo-data" || mounts[1].TmpfsOptions == nil || mounts[1].TmpfsOptions.SizeBytes != 16*1024*1024 {
+		t.Errorf("mounts = %+v", mounts)
+	}
+
+	v, err := rt.InspectVolume(context.Background(), "echo-data")
+	if err != nil || v.Labels[dkrclient.ManagedLabel] != "true" {
+		t.Errorf("volume = %+v, %v, want one labelled as managed", v, err)
+	}
+
+	endpoint, ok := c.Endpoints["demo"]
+	if !ok || c.HostConfig.NetworkMode != "demo" || !reflect.DeepEqual(endpoint.Aliases, []string{"echo"}) {
+		t.Errorf("network mode %v, endpoints %+v, want demo with alias echo", c.HostConfig.NetworkMode, c.Endpoints)
+	}
+
+	n, err := rt.InspectNetwork(context.Background(), "demo")
+	if err != nil || n.Labels[dkrclient.ManagedLabel] != "true" {
+		t.Errorf("network = %+v, %v, want one labelled as managed", n, err)
+	}
+}
+
+func TestStartTaskAppliesLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		createErr error
+		wantState string
+		wantErr   error
+	}{
+		{name: "limits applied", wantState: task.Running.String()},
+		{
+			name:      "disk limit unsupported",
+			createErr: errdefs.InvalidParameter(errors.New("--storage-opt is supported only for overlay over xfs with 'pquota' mount option")),
+			wantState: task.Failed.String(),
+			wantErr:   task.ErrDiskUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, rt := newTestWorker(t)
+			rt.FailOn("Create", tt.createErr)
+
+			tk := task.Task{
+				ID:            uuid.New(),
+				Name:          "limited",
+				Image:         "busybox",
+				State:         task.Scheduled.String(),
+				Cpus:          1.5,
+				Memory:        64,
+				Disk:          512,
+				RestartPolicy: "on-failure:3",
+			}
+			w.DB.Create(&tk)
+
+			result := w.StartTask(&tk)
+			if !errors.Is(result.Error, tt.wantErr) {
+				t.Fatalf("StartTask() error = %v, want %v", result.Error, tt.wantErr)
+			}
+
+			var stored task.Task
+			w.DB.First(&stored, "id = ?", tk.ID)
+			if stored.State != tt.wantState {
+				t.Errorf("task state = %v, want %v", stored.State, tt.wantState)
+			}
+
+			if tt.createErr != nil {
+				return
+			}
+
+			c, _ := rt.Container("limited")
+			hc := c.HostConfig
+			if hc.NanoCPUs != 1.5e9 || hc.Memory != 64*1024*1024 || hc.StorageOpt["size"] != "512M" {
+				t.Errorf("resources = cpus %d, memory %d, storage %v", hc.NanoCPUs, hc.Memory, hc.StorageOpt)
+			}
+			if hc.RestartPolicy.Name != "on-failure" || hc.RestartPolicy.MaximumRetryCount != 3 {
+				t.Errorf("restart policy = %+v", hc.RestartPolicy)
+			}
+		})
+	}
+}
+
+func TestStartTaskPullsImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		credential string
+		present    bool
+		wantPulls  int
+		wantAuth   bool
+		wantState  string
+	}{
+		{name: "always", policy: task.PullAlways, present: true, wantPulls: 1, wantState: task.Running.String()},
+		{name: "if not present, present", policy: task.PullIfNotPresent, present: true, wantState: task.Running.String()},
+		{name: "if not present, missing", policy: task.PullIfNotPresent, wantPulls: 1, wantState: task.Running.String()},
+		{name: "never, present", policy: task.PullNever, present: true, wantState: task.Running.String()},
+		{name: "never, missing", policy: task.PullNever, wantState: task.Failed.String()},
+		{name: "private registry", credential: "gitlab", wantPulls: 1, wantAuth: true, wantState: task.Running.String()},
+		{name: "unknown credential", credential: "github", wantState: task.Failed.String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, rt := newTestWorker(t)
+			w.CredentialKey = make([]byte, 32)
+			cred := task.RegistryCredential{ID: uuid.New(), Name: "gitlab", Server: "registry.gitlab.com", Username: "deploy"}
+			cred.SetPassword(w.CredentialKey, "s3cret")
+			w.DB.Create(&cred)
+
+			image := "registry.gitlab.com/shop/api:1.4"
+			if tt.present {
+				rt.AddImage(image)
+			}
+
+			tk := task.Task{ID: uuid.New(), Name: "api", Image: image, State: task.Scheduled.String(), PullPolicy: tt.policy, RegistryCredential: tt.credential}
+			w.DB.Create(&tk)
+			w.StartTask(&tk)
+
+			var stored task.Task
+			w.DB.First(&stored, "id = ?", tk.ID)
+			if stored.State != tt.wantState {
+				t.Errorf("task state = %v, want %v", stored.State, tt.wantState)
+			}
+
+			pulls := rt.Pulls(image)
+			if len(pulls) != tt.wantPulls {
+				t.Fatalf("pulls = %d, want %d", len(pulls), tt.wantPulls)
+			}
+			if tt.wantPulls > 0 && stored.PullProgress != 100 {
+				t.Errorf("pull progress = %d, want 100", stored.PullProgress)
+			}
+
+			if tt.wantAuth {
+				auth, err := registry.DecodeAuthConfig(pulls[0].RegistryAuth)
+				if err != nil || auth.Username != "deploy" || auth.Password != "s3cret" || auth.ServerAddress != "registry.gitlab.com" {
+					t.Errorf("registry auth = %+v, %v", auth, err)
+				}
+			}
+		})
+	}
+}